@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -15,6 +16,7 @@ import (
 // AggregateResult allows you to access the results of an aggregate query
 type AggregateResult struct {
 	reduction []reflect.Value // always pointers
+	keys      [][]byte        // the keys of the reduction records
 	group     []reflect.Value
 	sortby    string
 }
@@ -63,6 +65,7 @@ type aggregateResultSort AggregateResult
 func (a *aggregateResultSort) Len() int { return len(a.reduction) }
 func (a *aggregateResultSort) Swap(i, j int) {
 	a.reduction[i], a.reduction[j] = a.reduction[j], a.reduction[i]
+	a.keys[i], a.keys[j] = a.keys[j], a.keys[i]
 }
 func (a *aggregateResultSort) Less(i, j int) bool {
 	//reduction values are always pointers
@@ -148,6 +151,9 @@ func (a *AggregateResult) Sum(field string) float64 {
 		if !fVal.IsValid() {
 			panic(fmt.Sprintf("The field %s does not exist in the type %s", field, a.reduction[i].Type()))
 		}
+		if kind := fVal.Kind(); !isIntKind(kind) && !isUintKind(kind) && !isFloatKind(kind) {
+			panic(fmt.Sprintf("The field %s is of Kind %s and cannot be converted to a float64", field, kind))
+		}
 
 		sum += tryFloat(fVal)
 	}
@@ -165,7 +171,7 @@ func (a *AggregateResult) Count() uint64 {
 func (s *Store) FindAggregate(dataType interface{}, query *Query, groupBy ...string) ([]*AggregateResult, error) {
 	var result []*AggregateResult
 	var err error
-	err = s.Badger().View(func(tx *badger.Txn) error {
+	err = s.view(func(tx *badger.Txn) error {
 		result, err = s.TxFindAggregate(tx, dataType, query, groupBy...)
 		return err
 	})
@@ -184,6 +190,399 @@ func (s *Store) TxFindAggregate(tx *badger.Txn, dataType interface{}, query *Que
 	return s.aggregateQuery(tx, dataType, query, groupBy...)
 }
 
+// CountBy returns the number of records that match the passed in query for each distinct value of the passed in
+// field.  The field must be of a type that can be used as a map key
+func (s *Store) CountBy(dataType interface{}, query *Query, field string) (map[interface{}]uint64, error) {
+	var result map[interface{}]uint64
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		result, txErr = s.TxCountBy(tx, dataType, query, field)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TxCountBy is the same as CountBy, but you specify your own transaction
+func (s *Store) TxCountBy(tx *badger.Txn, dataType interface{}, query *Query,
+	field string) (map[interface{}]uint64, error) {
+	aggs, err := s.aggregateQuery(tx, dataType, query, field)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[interface{}]uint64, len(aggs))
+	for i := range aggs {
+		group := aggs[i].group[0]
+		if !group.Type().Comparable() {
+			return nil, fmt.Errorf("The field %s of type %s cannot be used to count by", field, group.Type())
+		}
+		result[group.Interface()] = aggs[i].Count()
+	}
+
+	return result, nil
+}
+
+// CountDistinct returns the number of distinct values of the passed in field among the records that match the
+// passed in query
+func (s *Store) CountDistinct(dataType interface{}, query *Query, field string) (uint64, error) {
+	var count uint64
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		count, txErr = s.TxCountDistinct(tx, dataType, query, field)
+		return txErr
+	})
+	return count, err
+}
+
+// TxCountDistinct is the same as CountDistinct, but you specify your own transaction
+func (s *Store) TxCountDistinct(tx *badger.Txn, dataType interface{}, query *Query, field string) (uint64, error) {
+	return s.countDistinctQuery(tx, dataType, query, field)
+}
+
+// FindGrouped returns the records that match the passed in query grouped by each distinct value of the passed in
+// field.  The records in each group are pointers to dataType, with their key field set, in the order the query
+// returns them.  The field must be of a type that can be used as a map key
+func (s *Store) FindGrouped(dataType interface{}, query *Query, groupBy string) (map[interface{}][]interface{},
+	error) {
+	var result map[interface{}][]interface{}
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		result, txErr = s.TxFindGrouped(tx, dataType, query, groupBy)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TxFindGrouped is the same as FindGrouped, but you specify your own transaction
+func (s *Store) TxFindGrouped(tx *badger.Txn, dataType interface{}, query *Query,
+	groupBy string) (map[interface{}][]interface{}, error) {
+	aggs, err := s.aggregateQuery(tx, dataType, query, groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	storer := s.newStorer(dataType)
+	keyField, hasKeyField := getKeyField(dereference(reflect.TypeOf(dataType)))
+
+	result := make(map[interface{}][]interface{}, len(aggs))
+	for i := range aggs {
+		group := aggs[i].group[0]
+		if !group.Type().Comparable() {
+			return nil, fmt.Errorf("The field %s of type %s cannot be used to group by", groupBy, group.Type())
+		}
+
+		records := make([]interface{}, len(aggs[i].reduction))
+		for j, record := range aggs[i].reduction {
+			if hasKeyField {
+				err = s.setKeyField(aggs[i].keys[j], record, keyField, storer.Type())
+				if err != nil {
+					return nil, err
+				}
+			}
+			records[j] = record.Interface()
+		}
+		result[group.Interface()] = records
+	}
+
+	return result, nil
+}
+
+// Aggregate runs the query and fills the fields of the into struct with aggregates of the matching records.  The
+// aggregate each field is filled with is specified by the badgerholdAgg struct tag:
+//
+//	type Summary struct {
+//		Orders  int       `badgerholdAgg:"count"`
+//		Total   float64   `badgerholdAgg:"sum=Amount"`
+//		Average float64   `badgerholdAgg:"avg=Amount"`
+//		Largest float64   `badgerholdAgg:"max=Amount"`
+//		First   time.Time `badgerholdAgg:"min=Created"`
+//	}
+//
+// count, sum and avg fields must be numeric, and sum and avg can only be used on numeric fields.  min and max fields
+// must be the same type as the field they're taken from.  If no records match, min, max and avg are left as zero
+// values.  Fields without the tag are left unchanged
+func (s *Store) Aggregate(dataType interface{}, query *Query, into interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxAggregate(tx, dataType, query, into)
+	})
+}
+
+// TxAggregate is the same as Aggregate, but you specify your own transaction
+func (s *Store) TxAggregate(tx *badger.Txn, dataType interface{}, query *Query, into interface{}) error {
+	intoVal := reflect.ValueOf(into)
+	if intoVal.Kind() != reflect.Ptr || intoVal.Elem().Kind() != reflect.Struct {
+		panic("into argument must be a struct address")
+	}
+	intoVal = intoVal.Elem()
+
+	tp := dereference(reflect.TypeOf(dataType))
+
+	// validate the tags before running the query
+	type aggregateField struct {
+		index  int
+		op     string
+		source string
+	}
+	var fields []aggregateField
+
+	for i := 0; i < intoVal.NumField(); i++ {
+		tag, ok := intoVal.Type().Field(i).Tag.Lookup(BadgerholdAggregateTag)
+		if !ok {
+			continue
+		}
+
+		field := aggregateField{index: i}
+		parts := strings.SplitN(tag, "=", 2)
+		field.op = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			field.source = strings.TrimSpace(parts[1])
+		}
+
+		target := intoVal.Type().Field(i)
+		switch field.op {
+		case "count":
+			if !isNumber(target.Type) {
+				return fmt.Errorf("The count field %s must be numeric", target.Name)
+			}
+			fields = append(fields, field)
+			continue
+		case "sum", "avg", "min", "max":
+		default:
+			return fmt.Errorf("The aggregate %s on the field %s is not valid", tag, target.Name)
+		}
+
+		source, ok := tp.FieldByName(field.source)
+		if !ok {
+			return fmt.Errorf("The field %s does not exist in the type %s", field.source, tp)
+		}
+
+		if field.op == "sum" || field.op == "avg" {
+			if !isNumber(source.Type) || !isNumber(target.Type) {
+				return fmt.Errorf("The %s field %s and the field %s it's taken from must be numeric", field.op,
+					target.Name, source.Name)
+			}
+		} else if !source.Type.AssignableTo(target.Type) {
+			return fmt.Errorf("The %s field %s must be the same type as %s", field.op, target.Name, source.Name)
+		}
+
+		fields = append(fields, field)
+	}
+
+	aggs, err := s.aggregateQuery(tx, dataType, query)
+	if err != nil {
+		return err
+	}
+	agg := &AggregateResult{}
+	if len(aggs) > 0 {
+		// the only group can be filtered out by Having
+		agg = aggs[0]
+	}
+
+	for _, field := range fields {
+		target := intoVal.Field(field.index)
+		switch field.op {
+		case "count":
+			target.Set(reflect.ValueOf(agg.Count()).Convert(target.Type()))
+		case "sum":
+			target.Set(reflect.ValueOf(agg.Sum(field.source)).Convert(target.Type()))
+		case "avg":
+			if agg.Count() > 0 {
+				target.Set(reflect.ValueOf(agg.Avg(field.source)).Convert(target.Type()))
+			}
+		case "min", "max":
+			if agg.Count() == 0 {
+				continue
+			}
+			agg.Sort(field.source)
+			record := agg.reduction[0]
+			if field.op == "max" {
+				record = agg.reduction[len(agg.reduction)-1]
+			}
+			target.Set(record.Elem().FieldByName(field.source))
+		}
+	}
+
+	return nil
+}
+
+// FindAbovePercentile runs the query, and puts the records whose numeric field is greater than the pct percentile
+// of that field across all of the records the query returns into result.  pct is between 0 and 100, and the
+// percentile is interpolated between the two closest values, so FindAbovePercentile(&Task{}, query, "Duration", 90,
+// &result) returns the slowest 10% of tasks.  Records are returned in the order of the query
+func (s *Store) FindAbovePercentile(dataType interface{}, query *Query, field string, pct float64,
+	result interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindAbovePercentile(tx, dataType, query, field, pct, result)
+	})
+}
+
+// TxFindAbovePercentile is the same as FindAbovePercentile, but you specify your own transaction
+func (s *Store) TxFindAbovePercentile(tx *badger.Txn, dataType interface{}, query *Query, field string,
+	pct float64, result interface{}) error {
+	if pct < 0 || pct > 100 {
+		return fmt.Errorf("The percentile %v must be between 0 and 100", pct)
+	}
+
+	tp := dereference(reflect.TypeOf(dataType))
+	sf, ok := tp.FieldByName(field)
+	if !ok {
+		return fmt.Errorf("The field %s does not exist in the type %s", field, tp)
+	}
+	if !isNumber(sf.Type) {
+		return fmt.Errorf("The field %s must be numeric to take a percentile of it", field)
+	}
+
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+	// like Find, the records are appended to any already in result
+	existing := resultVal.Elem().Len()
+
+	err := s.findQuery(tx, result, query)
+	if err != nil {
+		return err
+	}
+
+	records := resultVal.Elem()
+	values := make([]float64, records.Len()-existing)
+	for i := range values {
+		values[i] = tryFloat(reflect.Indirect(records.Index(existing + i)).FieldByName(field))
+	}
+
+	threshold := percentile(values, pct)
+	above := records.Slice(0, existing)
+	for i := range values {
+		if values[i] > threshold {
+			above = reflect.Append(above, records.Index(existing+i))
+		}
+	}
+
+	records.Set(above)
+	return nil
+}
+
+// percentile returns the pct percentile of the values, interpolated between the two closest values
+func percentile(values []float64, pct float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := pct / 100 * float64(len(sorted)-1)
+	lower := int(rank)
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(rank-float64(lower))
+}
+
+// FindWithRunningTotal runs the query sorted by sortField, ahead of any sort the query already has, and puts the
+// records into result with totalField of each set to the sum of valueField across that record and those before it
+// in result, such as for a running balance.  Both fields must be numeric, and totalField can only be an integer if
+// valueField is too.  Skip and Limit are applied before the totals, so they only add up the records returned
+func (s *Store) FindWithRunningTotal(query *Query, sortField, valueField, totalField string,
+	result interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindWithRunningTotal(tx, query, sortField, valueField, totalField, result)
+	})
+}
+
+// TxFindWithRunningTotal is the same as FindWithRunningTotal, but you specify your own transaction
+func (s *Store) TxFindWithRunningTotal(tx *badger.Txn, query *Query, sortField, valueField, totalField string,
+	result interface{}) error {
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+
+	tp := dereference(resultVal.Elem().Type().Elem())
+	for _, field := range []string{valueField, totalField} {
+		sf, ok := tp.FieldByName(field)
+		if !ok {
+			return fmt.Errorf("The field %s does not exist in the type %s", field, tp)
+		}
+		if !isNumber(sf.Type) {
+			return fmt.Errorf("The field %s must be numeric for a running total", field)
+		}
+	}
+	value, _ := tp.FieldByName(valueField)
+	total, _ := tp.FieldByName(totalField)
+	if isFloatKind(value.Type.Kind()) && !isFloatKind(total.Type.Kind()) {
+		return fmt.Errorf("The field %s must be a float to hold a running total of %s", totalField, valueField)
+	}
+
+	if query == nil {
+		query = &Query{}
+	}
+	sortBy := query.sort
+	if len(sortBy) == 0 || sortBy[0] != sortField {
+		query.sort = append([]string{sortField}, sortBy...)
+	}
+	defer func() {
+		query.sort = sortBy
+	}()
+
+	// like Find, the records are appended to any already in result
+	existing := resultVal.Elem().Len()
+	err := s.findQuery(tx, result, query)
+	if err != nil {
+		return err
+	}
+
+	var intTotal int64
+	var floatTotal float64
+	records := resultVal.Elem()
+	for i := existing; i < records.Len(); i++ {
+		record := reflect.Indirect(records.Index(i))
+
+		v := record.FieldByName(valueField)
+		switch {
+		case isFloatKind(v.Kind()):
+			floatTotal += v.Float()
+		case isUintKind(v.Kind()):
+			intTotal += int64(v.Uint())
+			floatTotal += float64(v.Uint())
+		default:
+			intTotal += v.Int()
+			floatTotal += float64(v.Int())
+		}
+
+		t := record.FieldByName(totalField)
+		switch {
+		case isFloatKind(t.Kind()):
+			t.SetFloat(floatTotal)
+		case isUintKind(t.Kind()):
+			t.SetUint(uint64(intTotal))
+		default:
+			t.SetInt(intTotal)
+		}
+	}
+
+	return nil
+}
+
+func isNumber(tp reflect.Type) bool {
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
 func tryFloat(val reflect.Value) float64 {
 	switch val.Kind() {
 	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int8:
@@ -6,6 +6,7 @@ package badgerhold_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/timshannon/badgerhold/v4"
@@ -476,6 +477,38 @@ func TestFindAggregateBadSumFieldPanic(t *testing.T) {
 	})
 }
 
+func TestFindAggregateSumKinds(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Reading struct {
+			Sensor string
+			Small  int8
+			Count  uint32
+			Level  float32
+		}
+
+		for i := 0; i < 4; i++ {
+			ok(t, store.Insert(i, &Reading{Sensor: "a", Small: int8(-i), Count: uint32(i * 10), Level: float32(i) / 2}))
+		}
+
+		result, err := store.FindAggregate(&Reading{}, nil, "Sensor")
+		ok(t, err)
+		equals(t, 1, len(result))
+
+		equals(t, float64(-6), result[0].Sum("Small"))
+		equals(t, float64(60), result[0].Sum("Count"))
+		equals(t, float64(15), result[0].Avg("Count"))
+		equals(t, float64(3), result[0].Sum("Level"))
+		equals(t, 0.75, result[0].Avg("Level"))
+
+		defer func() {
+			r := recover()
+			assert(t, r != nil, "Running Sum on a non-numeric field did not panic")
+			assert(t, strings.Contains(fmt.Sprint(r), "Sensor"), "The panic doesn't name the field: %v", r)
+		}()
+		result[0].Avg("Sensor")
+	})
+}
+
 func TestFindAggregateBadGroupField(t *testing.T) {
 	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
 		insertTestData(t, store)
@@ -520,3 +553,263 @@ func TestFindAggregateWithNoGroupBy(t *testing.T) {
 
 	})
 }
+
+func TestCountBy(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		result, err := store.CountBy(&ItemTest{}, nil, "Category")
+		ok(t, err)
+
+		equals(t, map[interface{}]uint64{
+			"animal":  7,
+			"food":    5,
+			"vehicle": 5,
+		}, result)
+
+		result, err = store.CountBy(&ItemTest{}, badgerhold.Where("Category").Ne("animal"), "Category")
+		ok(t, err)
+
+		equals(t, map[interface{}]uint64{
+			"food":    5,
+			"vehicle": 5,
+		}, result)
+	})
+}
+
+func TestCountByNonComparableField(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		_, err := store.CountBy(&ItemTest{}, nil, "Tags")
+		if err == nil {
+			t.Fatalf("CountBy on a slice field did not return an error")
+		}
+	})
+}
+
+func TestCountDistinct(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		// counted from the Category index
+		count, err := store.CountDistinct(&ItemTest{}, nil, "Category")
+		ok(t, err)
+		equals(t, uint64(3), count)
+
+		count, err = store.CountDistinct(&ItemTest{}, badgerhold.Where("Category").Ne("animal"), "Category")
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		names := make(map[string]bool)
+		for i := range testData {
+			names[testData[i].Name] = true
+		}
+		count, err = store.CountDistinct(&ItemTest{}, nil, "Name")
+		ok(t, err)
+		equals(t, uint64(len(names)), count)
+
+		count, err = store.CountDistinct(&ItemTest{}, badgerhold.Where("Name").Eq("nothing"), "Name")
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		_, err = store.CountDistinct(&ItemTest{}, nil, "BadField")
+		assert(t, err != nil, "CountDistinct on a missing field did not return an error")
+	})
+}
+
+func TestAggregateInto(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		type Summary struct {
+			Count    int     `badgerholdAgg:"count"`
+			Sum      int     `badgerholdAgg:"sum=ID"`
+			Avg      float64 `badgerholdAgg:"avg=ID"`
+			MinName  string  `badgerholdAgg:"min=Name"`
+			MaxID    int     `badgerholdAgg:"max=ID"`
+			Untagged string
+		}
+
+		expected := Summary{MinName: "zzz", Untagged: "unchanged"}
+		for i := range testData {
+			if testData[i].Category != "food" {
+				continue
+			}
+			expected.Count++
+			expected.Sum += testData[i].ID
+			if testData[i].Name < expected.MinName {
+				expected.MinName = testData[i].Name
+			}
+			if testData[i].ID > expected.MaxID {
+				expected.MaxID = testData[i].ID
+			}
+		}
+		expected.Avg = float64(expected.Sum) / float64(expected.Count)
+
+		result := Summary{Untagged: "unchanged"}
+		ok(t, store.Aggregate(&ItemTest{}, badgerhold.Where("Category").Eq("food"), &result))
+		equals(t, expected, result)
+
+		result = Summary{}
+		ok(t, store.Aggregate(&ItemTest{}, badgerhold.Where("Category").Eq("none"), &result))
+		equals(t, Summary{}, result)
+
+		bad := struct {
+			Sum int `badgerholdAgg:"sum=Name"`
+		}{}
+		assert(t, store.Aggregate(&ItemTest{}, nil, &bad) != nil, "Summing a string field didn't fail")
+
+		missing := struct {
+			Max int `badgerholdAgg:"max=Missing"`
+		}{}
+		assert(t, store.Aggregate(&ItemTest{}, nil, &missing) != nil, "Aggregating a missing field didn't fail")
+
+		mismatch := struct {
+			Max string `badgerholdAgg:"max=ID"`
+		}{}
+		assert(t, store.Aggregate(&ItemTest{}, nil, &mismatch) != nil, "Aggregating into a different type didn't fail")
+
+		invalid := struct {
+			Median int `badgerholdAgg:"median=ID"`
+		}{}
+		assert(t, store.Aggregate(&ItemTest{}, nil, &invalid) != nil, "An invalid aggregate didn't fail")
+	})
+}
+
+func TestFindAggregateHaving(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		result, err := store.FindAggregate(&ItemTest{}, (&badgerhold.Query{}).Having(
+			func(r *badgerhold.AggregateResult) bool {
+				return r.Count() > 5
+			}), "Category")
+		ok(t, err)
+		equals(t, 1, len(result))
+
+		var group string
+		result[0].Group(&group)
+		equals(t, "animal", group)
+
+		counts, err := store.CountBy(&ItemTest{}, badgerhold.Where("Category").Ne("animal").Having(
+			func(r *badgerhold.AggregateResult) bool {
+				return r.Count() > 5
+			}), "Category")
+		ok(t, err)
+		equals(t, 0, len(counts))
+
+		var summary struct {
+			Count int `badgerholdAgg:"count"`
+		}
+		ok(t, store.Aggregate(&ItemTest{}, (&badgerhold.Query{}).Having(func(r *badgerhold.AggregateResult) bool {
+			return false
+		}), &summary))
+		equals(t, 0, summary.Count)
+	})
+}
+
+func TestFindGrouped(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		result, err := store.FindGrouped(&ItemTest{}, badgerhold.Where("Category").Ne("vehicle"), "Category")
+		ok(t, err)
+		equals(t, 2, len(result))
+
+		for category, records := range result {
+			var expected []ItemTest
+			ok(t, store.Find(&expected, badgerhold.Where("Category").Eq(category)))
+			equals(t, len(expected), len(records))
+			for i := range records {
+				item := records[i].(*ItemTest)
+				equals(t, expected[i].Key, item.Key)
+				equals(t, expected[i].Name, item.Name)
+			}
+		}
+
+		_, err = store.FindGrouped(&ItemTest{}, nil, "Tags")
+		assert(t, err != nil, "FindGrouped on a slice field did not return an error")
+	})
+}
+
+func TestFindAbovePercentile(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		for i := 1; i <= 10; i++ {
+			ok(t, store.Insert(i, &ItemTest{ID: i, Category: "numbered"}))
+		}
+		ok(t, store.Insert(11, &ItemTest{ID: 100, Category: "other"}))
+
+		query := func() *badgerhold.Query { return badgerhold.Where("Category").Eq("numbered") }
+		ids := func(items []ItemTest) []int {
+			var result []int
+			for i := range items {
+				result = append(result, items[i].ID)
+			}
+			return result
+		}
+
+		var result []ItemTest
+		ok(t, store.FindAbovePercentile(&ItemTest{}, query(), "ID", 90, &result))
+		equals(t, []int{10}, ids(result))
+
+		result = nil
+		ok(t, store.FindAbovePercentile(&ItemTest{}, query(), "ID", 50, &result))
+		equals(t, []int{6, 7, 8, 9, 10}, ids(result))
+
+		result = nil
+		ok(t, store.FindAbovePercentile(&ItemTest{}, query(), "ID", 0, &result))
+		equals(t, 9, len(result))
+
+		result = nil
+		ok(t, store.FindAbovePercentile(&ItemTest{}, query(), "ID", 100, &result))
+		equals(t, 0, len(result))
+
+		var pointers []*ItemTest
+		ok(t, store.FindAbovePercentile(&ItemTest{}, nil, "ID", 90, &pointers))
+		equals(t, 1, len(pointers))
+		equals(t, 100, pointers[0].ID)
+
+		assert(t, store.FindAbovePercentile(&ItemTest{}, query(), "ID", 101, &result) != nil,
+			"a percentile over 100 did not return an error")
+		assert(t, store.FindAbovePercentile(&ItemTest{}, query(), "Name", 50, &result) != nil,
+			"a percentile of a string field did not return an error")
+	})
+}
+
+func TestFindWithRunningTotal(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Transaction struct {
+			Day     int
+			Account string
+			Amount  int
+			Balance int
+			Running float64
+		}
+
+		for i, amount := range []int{50, -20, 10, 30, -5} {
+			ok(t, store.Insert(i, &Transaction{Day: 5 - i, Account: "a", Amount: amount}))
+		}
+		ok(t, store.Insert(10, &Transaction{Day: 1, Account: "b", Amount: 1000}))
+
+		var result []Transaction
+		ok(t, store.FindWithRunningTotal(badgerhold.Where("Account").Eq("a"), "Day", "Amount", "Balance",
+			&result))
+		balances := make([]int, len(result))
+		for i := range result {
+			balances[i] = result[i].Balance
+		}
+		equals(t, []int{-5, 25, 35, 15, 65}, balances)
+
+		// totals only add up the records returned
+		var limited []*Transaction
+		ok(t, store.FindWithRunningTotal(badgerhold.Where("Account").Eq("a").Skip(1).Limit(2), "Day", "Amount",
+			"Running", &limited))
+		equals(t, 2, len(limited))
+		equals(t, 30.0, limited[0].Running)
+		equals(t, 40.0, limited[1].Running)
+
+		err := store.FindWithRunningTotal(nil, "Day", "Account", "Balance", &result)
+		assert(t, err != nil, "A running total of a string field did not fail")
+	})
+}
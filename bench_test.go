@@ -310,3 +310,168 @@ func BenchmarkFindIndexedWithAdditionalCriteria(b *testing.B) {
 		}
 	})
 }
+
+type BenchDataBlob struct {
+	ID       int
+	Category string `badgerholdIndex:"Category"`
+	Blob     []byte
+}
+
+func benchBlobData(b *testing.B, store *badgerhold.Store) {
+	blob := make([]byte, 64*1024)
+	for i := 0; i < 300; i++ {
+		category := "test category"
+		if i%100 == 0 {
+			category = "findCategory"
+		}
+		err := store.Insert(id(), &BenchDataBlob{
+			ID:       i,
+			Category: category,
+			Blob:     blob,
+		})
+		if err != nil {
+			b.Fatalf("Error inserting benchmarking data: %s", err)
+		}
+	}
+}
+
+func BenchmarkFindIndexedRangeBlob(b *testing.B) {
+	benchWrap(b, nil, func(store *badgerhold.Store, b *testing.B) {
+		benchBlobData(b, store)
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			var result []BenchDataBlob
+
+			err := store.Find(
+				&result,
+				badgerhold.Where("Category").Ge("findCategory").Index("Category"),
+			)
+			if err != nil {
+				b.Fatalf("Error finding data in store: %s", err)
+			}
+		}
+	})
+}
+
+func BenchmarkFindLazyIndexedRangeBlob(b *testing.B) {
+	benchWrap(b, nil, func(store *badgerhold.Store, b *testing.B) {
+		benchBlobData(b, store)
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			count := 0
+			err := store.FindLazy(
+				&BenchDataBlob{},
+				badgerhold.Where("Category").Ge("findCategory").Index("Category"),
+				func(record *badgerhold.LazyRecord) error {
+					// only decode the first match in full
+					count++
+					if count > 1 {
+						return nil
+					}
+					return record.Decode(&BenchDataBlob{})
+				},
+			)
+			if err != nil {
+				b.Fatalf("Error finding data in store: %s", err)
+			}
+		}
+	})
+}
+
+type BenchDataTwoIndexes struct {
+	ID       int
+	Category string `badgerholdIndex:"Category"`
+	Owner    string `badgerholdIndex:"Owner"`
+}
+
+func benchTwoIndexes(b *testing.B, query func() *badgerhold.Query) {
+	benchWrap(b, nil, func(store *badgerhold.Store, b *testing.B) {
+		for i := 0; i < 1000; i++ {
+			err := store.Insert(id(), &BenchDataTwoIndexes{
+				ID:       i,
+				Category: "common",
+				Owner:    strconv.Itoa(i),
+			})
+			if err != nil {
+				b.Fatalf("Error inserting benchmarking data: %s", err)
+			}
+		}
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			var result []BenchDataTwoIndexes
+
+			err := store.Find(&result, query())
+			if err != nil {
+				b.Fatalf("Error finding data in store: %s", err)
+			}
+		}
+	})
+}
+
+func BenchmarkFindFirstIndexOfTwo(b *testing.B) {
+	benchTwoIndexes(b, func() *badgerhold.Query {
+		return badgerhold.Where("Category").Eq("common").Index("Category").And("Owner").Eq("500")
+	})
+}
+
+func BenchmarkFindAutoIndexOfTwo(b *testing.B) {
+	benchTwoIndexes(b, func() *badgerhold.Query {
+		return badgerhold.Where("Category").Eq("common").Index("Category").And("Owner").Eq("500").AutoIndex()
+	})
+}
+
+type BenchDataWide struct {
+	ID     int
+	Name   string
+	Tags   []string
+	Values map[string]float64
+	Nested []BenchData
+}
+
+func benchFindWide(b *testing.B, decodeWorkers int) {
+	opt := badgerhold.DefaultOptions
+	opt.DecodeWorkers = decodeWorkers
+	benchWrap(b, &opt, func(store *badgerhold.Store, b *testing.B) {
+		for i := 0; i < 1000; i++ {
+			item := &BenchDataWide{
+				ID:     i,
+				Name:   strconv.Itoa(i),
+				Values: make(map[string]float64),
+			}
+			for k := 0; k < 50; k++ {
+				item.Tags = append(item.Tags, strconv.Itoa(k))
+				item.Values[strconv.Itoa(k)] = float64(k)
+				item.Nested = append(item.Nested, benchItem)
+			}
+			err := store.Insert(id(), item)
+			if err != nil {
+				b.Fatalf("Error inserting benchmarking data: %s", err)
+			}
+		}
+
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			var result []BenchDataWide
+
+			err := store.Find(&result, nil)
+			if err != nil {
+				b.Fatalf("Error finding data in store: %s", err)
+			}
+		}
+	})
+}
+
+func BenchmarkFindWide(b *testing.B) {
+	benchFindWide(b, 0)
+}
+
+func BenchmarkFindWideDecodeWorkers(b *testing.B) {
+	benchFindWide(b, 4)
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// badgerholdBucketOption is the badgerholdIndex tag option setting the bucket size of an index on a time field
+const badgerholdBucketOption = "bucket="
+
+// maxBucketExpansion is the most buckets a time range is expanded into before the whole index is scanned instead
+const maxBucketExpansion = 10000
+
+// indexBucket parses the bucket size out of the options of a badgerholdIndex tag, such as "CreatedHour;bucket=1h".
+// Options that aren't recognized are skipped, but still returned as an error along with the bucket, so that
+// ValidateType can report them while the index itself keeps working
+func indexBucket(tag string) (time.Duration, error) {
+	var bucket time.Duration
+	var err error
+
+	options := strings.Split(tag, ";")
+	for _, option := range options[1:] {
+		option = strings.TrimSpace(option)
+		if !strings.HasPrefix(option, badgerholdBucketOption) {
+			if err == nil {
+				err = fmt.Errorf("The index option %q is not recognized", option)
+			}
+			continue
+		}
+
+		parsed, parseErr := time.ParseDuration(strings.TrimPrefix(option, badgerholdBucketOption))
+		if parseErr != nil {
+			return 0, parseErr
+		}
+		if parsed <= 0 {
+			return 0, fmt.Errorf("The index bucket %s must be greater than zero", parsed)
+		}
+		bucket = parsed
+	}
+
+	return bucket, err
+}
+
+// asTime returns the value as a time.Time, if it is one or points to one
+func asTime(value interface{}) (time.Time, bool) {
+	switch value := value.(type) {
+	case time.Time:
+		return value, true
+	case *time.Time:
+		if value != nil {
+			return *value, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// bucketValue returns the start of the bucket the time value falls in, other values are returned unchanged
+func bucketValue(value interface{}, bucket time.Duration) interface{} {
+	t, ok := asTime(value)
+	if !ok {
+		return value
+	}
+	return t.UTC().Truncate(bucket)
+}
+
+// bucketMatches returns whether any time in the bucket starting at start could match all of the criteria.  Criteria
+// that can't be tested against a range of times match every bucket, and are tested against the records instead
+func bucketMatches(criteria []*Criterion, start time.Time, bucket time.Duration) bool {
+	last := start.Add(bucket - 1)
+
+	for _, c := range criteria {
+		if c.operator == in {
+			found := false
+			for i := range c.values {
+				if t, ok := asTime(c.values[i]); !ok || bucketValue(t, bucket).(time.Time).Equal(start) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+			continue
+		}
+
+		value, ok := asTime(c.value)
+		if !ok {
+			continue
+		}
+
+		switch c.operator {
+		case eq:
+			ok = bucketValue(value, bucket).(time.Time).Equal(start)
+		case gt:
+			ok = last.After(value)
+		case ge:
+			ok = !last.Before(value)
+		case lt:
+			ok = start.Before(value)
+		case le:
+			ok = !start.After(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bucketStarts expands the time range the criteria are bounded by into the start of each bucket the range covers.
+// ok is false if the range isn't bounded on both ends, or covers too many buckets
+func bucketStarts(criteria []*Criterion, bucket time.Duration) (starts []interface{}, ok bool) {
+	var from, to time.Time
+	hasFrom, hasTo := false, false
+
+	for _, c := range criteria {
+		value, isTime := asTime(c.value)
+		if !isTime {
+			continue
+		}
+
+		switch c.operator {
+		case eq:
+			if !hasFrom || value.After(from) {
+				from, hasFrom = value, true
+			}
+			if !hasTo || value.Before(to) {
+				to, hasTo = value, true
+			}
+		case gt, ge:
+			if !hasFrom || value.After(from) {
+				from, hasFrom = value, true
+			}
+		case lt, le:
+			if !hasTo || value.Before(to) {
+				to, hasTo = value, true
+			}
+		}
+	}
+
+	if !hasFrom || !hasTo {
+		return nil, false
+	}
+
+	first := bucketValue(from, bucket).(time.Time)
+	last := bucketValue(to, bucket).(time.Time)
+	if last.Sub(first)/bucket >= maxBucketExpansion {
+		return nil, false
+	}
+
+	for start := first; !start.After(last); start = start.Add(bucket) {
+		starts = append(starts, start)
+	}
+	return starts, true
+}
+
+// isTimeType returns whether the type is a time.Time or a pointer to one
+func isTimeType(tp reflect.Type) bool {
+	return dereference(tp) == reflect.TypeOf(time.Time{})
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// cascade is a type whose records are deleted along with the record they reference
+type cascade struct {
+	childType reflect.Type
+	field     reflect.StructField
+}
+
+// RegisterCascade declares that the childField of childType holds the key of a parentType record, so deleting a
+// parent record with Delete, DeleteMatching or any of the other delete methods also deletes the child records that
+// reference it, in the same transaction, as if DeleteMatching(childType, Where(childField).Eq(parentKey)) had been
+// run.  The parent's key is decoded into the type of childField to query on.  Child records are deleted the same
+// way, so their own cascades are followed too.  Will panic if childField isn't an exported field of childType
+func (s *Store) RegisterCascade(parentType, childType interface{}, childField string) {
+	child := dereference(reflect.TypeOf(childType))
+	field, ok := child.FieldByName(childField)
+	if !ok || !startsUpper(childField) {
+		panic(fmt.Sprintf("The type %s has no exported field %s", child, childField))
+	}
+
+	parent := dereference(reflect.TypeOf(parentType))
+	var cascades []cascade
+	if existing, ok := s.cascades.Load(parent); ok {
+		cascades = existing.([]cascade)
+	}
+	// copied, so deletes reading the cascades concurrently don't see them change
+	cascades = append(cascades[:len(cascades):len(cascades)], cascade{childType: child, field: field})
+	s.cascades.Store(parent, cascades)
+}
+
+// deleteCascades deletes the records that reference the deleted parent record with the encoded key
+func (s *Store) deleteCascades(tx *badger.Txn, parent Storer, parentType reflect.Type, key []byte) error {
+	cascades, ok := s.cascades.Load(dereference(parentType))
+	if !ok {
+		return nil
+	}
+
+	for _, c := range cascades.([]cascade) {
+		parentKey := reflect.New(dereference(c.field.Type))
+		err := s.decodeKey(key, parentKey.Interface(), parent.Type())
+		if err != nil {
+			return fmt.Errorf("The key can't be decoded into the field %s of %s: %s", c.field.Name, c.childType, err)
+		}
+
+		_, err = s.deleteQuery(tx, reflect.New(c.childType).Interface(),
+			Where(c.field.Name).Eq(parentKey.Elem().Interface()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
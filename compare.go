@@ -6,6 +6,7 @@ package badgerhold
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"reflect"
 	"time"
@@ -39,14 +40,20 @@ func (c *Criterion) compare(rowValue, criterionValue interface{}, currentRow int
 		return 0, &ErrTypeMismatch{rowValue, criterionValue}
 	}
 
-	if _, ok := criterionValue.(Field); ok {
-		fVal := reflect.ValueOf(currentRow).Elem().FieldByName(string(criterionValue.(Field)))
-		if !fVal.IsValid() {
-			return 0, fmt.Errorf("The field %s does not exist in the type %s", criterionValue,
-				reflect.TypeOf(currentRow))
+	if field, ok := criterionValue.(Field); ok {
+		if currentRow == nil {
+			return 0, fmt.Errorf("The field %s can't be compared without a record", field)
+		}
+
+		fVal, err := fieldValue(reflect.ValueOf(currentRow), string(field))
+		if err != nil {
+			return 0, err
 		}
 
 		criterionValue = fVal.Interface()
+		if criterionValue == nil {
+			return c.compare(rowValue, nil, currentRow)
+		}
 	}
 
 	value := rowValue
@@ -64,6 +71,10 @@ func (c *Criterion) compare(rowValue, criterionValue interface{}, currentRow int
 }
 
 func compare(value, other interface{}) (int, error) {
+	if v, o, ok := underlyingValues(value, other); ok {
+		value, other = v, o
+	}
+
 	switch t := value.(type) {
 	case time.Time:
 		tother, ok := other.(time.Time)
@@ -295,6 +306,10 @@ func compare(value, other interface{}) (int, error) {
 	case Comparer:
 		return value.(Comparer).Compare(other)
 	default:
+		if isSlice(value) && isSlice(other) {
+			return compareSlices(reflect.ValueOf(value), reflect.ValueOf(other))
+		}
+
 		valS := fmt.Sprintf("%s", value)
 		otherS := fmt.Sprintf("%s", other)
 		if valS == otherS {
@@ -309,3 +324,163 @@ func compare(value, other interface{}) (int, error) {
 	}
 
 }
+
+func isSlice(value interface{}) bool {
+	kind := reflect.TypeOf(value).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+// compareSlices compares slices element by element, and then by length, so equal slices have the same elements in
+// the same order
+func compareSlices(value, other reflect.Value) (int, error) {
+	for i := 0; i < value.Len() && i < other.Len(); i++ {
+		elem, otherElem := indirectValue(value.Index(i)), indirectValue(other.Index(i))
+		if !elem.IsValid() || !otherElem.IsValid() {
+			// nil elements sort first
+			if elem.IsValid() {
+				return 1, nil
+			}
+			if otherElem.IsValid() {
+				return -1, nil
+			}
+			continue
+		}
+
+		c, err := compare(elem.Interface(), otherElem.Interface())
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			return c, nil
+		}
+	}
+
+	switch {
+	case value.Len() < other.Len():
+		return -1, nil
+	case value.Len() > other.Len():
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// indirectValue follows pointers and interfaces, returning an invalid value if any are nil
+func indirectValue(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// basicTypes are the predeclared types that values of named types with the same kind are converted to for comparing
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// underlyingValues converts a value of a named type, such as an enum of typed constants, and the value it's being
+// compared with to the named type's underlying type, so a field of type Status can be compared with an int.  Values
+// of two different named types, or that implement Comparer, aren't converted
+func underlyingValues(value, other interface{}) (interface{}, interface{}, bool) {
+	valueType, otherType := reflect.TypeOf(value), reflect.TypeOf(other)
+	valueBasic, otherBasic := basicTypes[valueType.Kind()], basicTypes[otherType.Kind()]
+	if valueBasic == nil || otherBasic == nil {
+		return nil, nil, false
+	}
+	if valueType == valueBasic && otherType == otherBasic {
+		// already handled by compare
+		return nil, nil, false
+	}
+	if valueType != valueBasic && otherType != otherBasic && valueType != otherType {
+		return nil, nil, false
+	}
+	if _, ok := value.(Comparer); ok {
+		return nil, nil, false
+	}
+	if _, ok := other.(Comparer); ok {
+		return nil, nil, false
+	}
+
+	to := valueBasic
+	if valueType == valueBasic {
+		to = otherBasic
+	}
+
+	v, ok := convertBasic(reflect.ValueOf(value), to)
+	if !ok {
+		return nil, nil, false
+	}
+	o, ok := convertBasic(reflect.ValueOf(other), to)
+	if !ok {
+		return nil, nil, false
+	}
+	return v.Interface(), o.Interface(), true
+}
+
+// convertBasic converts the value to the basic type, if it can hold the value without overflowing
+func convertBasic(value reflect.Value, to reflect.Type) (reflect.Value, bool) {
+	target := reflect.New(to).Elem()
+	switch {
+	case isIntKind(value.Kind()) && isIntKind(to.Kind()):
+		if target.OverflowInt(value.Int()) {
+			return target, false
+		}
+		target.SetInt(value.Int())
+	case isIntKind(value.Kind()) && isUintKind(to.Kind()):
+		if value.Int() < 0 || target.OverflowUint(uint64(value.Int())) {
+			return target, false
+		}
+		target.SetUint(uint64(value.Int()))
+	case isUintKind(value.Kind()) && isIntKind(to.Kind()):
+		if value.Uint() > math.MaxInt64 || target.OverflowInt(int64(value.Uint())) {
+			return target, false
+		}
+		target.SetInt(int64(value.Uint()))
+	case isUintKind(value.Kind()) && isUintKind(to.Kind()):
+		if target.OverflowUint(value.Uint()) {
+			return target, false
+		}
+		target.SetUint(value.Uint())
+	case isIntKind(value.Kind()) && isFloatKind(to.Kind()):
+		target.SetFloat(float64(value.Int()))
+	case isUintKind(value.Kind()) && isFloatKind(to.Kind()):
+		target.SetFloat(float64(value.Uint()))
+	case isFloatKind(value.Kind()) && isFloatKind(to.Kind()):
+		if target.OverflowFloat(value.Float()) {
+			return target, false
+		}
+		target.SetFloat(value.Float())
+	case value.Kind() == reflect.String && to.Kind() == reflect.String:
+		target.SetString(value.String())
+	default:
+		return target, false
+	}
+	return target, true
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uint64
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
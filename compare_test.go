@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -303,3 +304,202 @@ func TestFindWithBuiltinTypes(t *testing.T) {
 		}
 	})
 }
+
+func TestFindWithFieldComparisons(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Nested struct {
+			Limit int
+		}
+		type FieldCompare struct {
+			Name     string
+			Count    int `badgerhold:"index"`
+			Max      int
+			Start    time.Time
+			End      time.Time
+			Amount   float64
+			Other    float64
+			Settings Nested
+		}
+
+		now := time.Now()
+		records := []FieldCompare{
+			{Name: "equal", Count: 5, Max: 5, Start: now, End: now, Amount: 1.5, Other: 1.5,
+				Settings: Nested{Limit: 5}},
+			{Name: "under", Count: 3, Max: 5, Start: now, End: now.Add(time.Hour), Amount: 1, Other: 2,
+				Settings: Nested{Limit: 1}},
+			{Name: "over", Count: 7, Max: 5, Start: now.Add(time.Hour), End: now, Amount: 3, Other: 2,
+				Settings: Nested{Limit: 7}},
+		}
+		for i := range records {
+			ok(t, store.Insert(i, records[i]))
+		}
+
+		tests := []struct {
+			name   string
+			query  *badgerhold.Query
+			result []string
+		}{
+			{"Int Eq", badgerhold.Where("Count").Eq(badgerhold.Field("Max")), []string{"equal"}},
+			{"Int Ne", badgerhold.Where("Count").Ne(badgerhold.Field("Max")), []string{"under", "over"}},
+			{"Int Gt", badgerhold.Where("Count").Gt(badgerhold.Field("Max")), []string{"over"}},
+			{"Int Le", badgerhold.Where("Count").Le(badgerhold.Field("Max")), []string{"equal", "under"}},
+			{"Int Indexed", badgerhold.Where("Count").Lt(badgerhold.Field("Max")).Index("Count"),
+				[]string{"under"}},
+			{"Int Indexed Eq", badgerhold.Where("Count").Eq(badgerhold.Field("Max")).Index("Count"),
+				[]string{"equal"}},
+			{"Int In", badgerhold.Where("Count").In(badgerhold.Field("Max"), 3), []string{"equal", "under"}},
+			{"Time Eq", badgerhold.Where("Start").Eq(badgerhold.Field("End")), []string{"equal"}},
+			{"Time Lt", badgerhold.Where("Start").Lt(badgerhold.Field("End")), []string{"under"}},
+			{"Float Ge", badgerhold.Where("Amount").Ge(badgerhold.Field("Other")), []string{"equal", "over"}},
+			{"Nested", badgerhold.Where("Count").Eq(badgerhold.Field("Settings.Limit")), []string{"equal", "over"}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				var result []FieldCompare
+				ok(t, store.Find(&result, tst.query))
+
+				names := make([]string, len(result))
+				for i := range result {
+					names[i] = result[i].Name
+				}
+				equals(t, tst.result, names)
+			})
+		}
+
+		var result []FieldCompare
+		err := store.Find(&result, badgerhold.Where("Count").Eq(badgerhold.Field("Name")))
+		assert(t, err != nil, "Comparing fields of different types did not return an error")
+
+		err = store.Find(&result, badgerhold.Where("Count").Eq(badgerhold.Field("Missing")))
+		assert(t, err != nil, "Comparing against a missing field did not return an error")
+	})
+}
+
+func TestFindFieldMismatch(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Contact struct {
+			Raw        string
+			Normalized string `badgerhold:"index"`
+		}
+
+		ok(t, store.Insert(1, &Contact{Raw: "alice", Normalized: "alice"}))
+		ok(t, store.Insert(2, &Contact{Raw: " Bob ", Normalized: " Bob "}))
+		ok(t, store.Insert(3, &Contact{Raw: "CAROL", Normalized: "carol"}))
+		ok(t, store.Insert(4, &Contact{Raw: "dave", Normalized: ""}))
+
+		normalize := func(value string) string {
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+
+		// records whose normalized value is stale
+		var stale []Contact
+		ok(t, store.Find(&stale, badgerhold.Where("Normalized").Ne(badgerhold.Field("Raw"))))
+		equals(t, []Contact{{Raw: "CAROL", Normalized: "carol"}, {Raw: "dave", Normalized: ""}}, stale)
+
+		var indexed []Contact
+		ok(t, store.Find(&indexed, badgerhold.Where("Normalized").Ne(badgerhold.Field("Raw")).Index("Normalized")))
+		equals(t, len(stale), len(indexed))
+
+		// the cleanup job normalizes every record, then checks which still differ from their raw value
+		ok(t, store.UpdateMatching(&Contact{}, nil, func(record interface{}) error {
+			contact := record.(*Contact)
+			contact.Normalized = normalize(contact.Raw)
+			return nil
+		}))
+
+		var changed []Contact
+		ok(t, store.Find(&changed, badgerhold.Where("Normalized").Ne(badgerhold.Field("Raw"))))
+		equals(t, []Contact{{Raw: " Bob ", Normalized: "bob"}, {Raw: "CAROL", Normalized: "carol"}}, changed)
+	})
+}
+
+func TestFindSliceEquality(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Tagged struct {
+			Tags  []string
+			Array [2]int
+		}
+
+		ok(t, store.Insert(1, &Tagged{Tags: []string{"a", "b"}, Array: [2]int{1, 2}}))
+		ok(t, store.Insert(2, &Tagged{Tags: []string{"b", "a"}, Array: [2]int{2, 1}}))
+		ok(t, store.Insert(3, &Tagged{Tags: []string{"a", "b", "c"}, Array: [2]int{1, 3}}))
+		ok(t, store.Insert(4, &Tagged{Tags: []string{"a"}}))
+
+		count, err := store.Count(&Tagged{}, badgerhold.Where("Tags").Eq([]string{"a", "b"}))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Tagged{}, badgerhold.Where("Tags").Ne([]string{"a", "b"}))
+		ok(t, err)
+		equals(t, uint64(3), count)
+
+		count, err = store.Count(&Tagged{}, badgerhold.Where("Tags").Eq([]interface{}{"b", "a"}))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Tagged{}, badgerhold.Where("Tags").Gt([]string{"a", "b"}))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		count, err = store.Count(&Tagged{}, badgerhold.Where("Array").Eq([2]int{1, 2}))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Tagged{}, badgerhold.Where("Tags").Eq([]string{}))
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		_, err = store.Count(&Tagged{}, badgerhold.Where("Tags").Eq([]int{1, 2}))
+		assert(t, err != nil, "Comparing slices with different element types didn't fail")
+	})
+}
+
+type enumStatus uint8
+
+const (
+	enumStatusNew enumStatus = iota + 1
+	enumStatusActive
+	enumStatusClosed
+)
+
+type enumLevel int
+
+func TestFindEnumValues(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Ticket struct {
+			Status enumStatus
+			Level  enumLevel
+		}
+
+		ok(t, store.Insert(1, &Ticket{Status: enumStatusNew, Level: 9}))
+		ok(t, store.Insert(2, &Ticket{Status: enumStatusActive, Level: 10}))
+		ok(t, store.Insert(3, &Ticket{Status: enumStatusClosed, Level: 11}))
+
+		count, err := store.Count(&Ticket{}, badgerhold.Where("Status").Eq(2))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Ticket{}, badgerhold.Where("Status").Eq(enumStatusActive))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		// compared by value rather than as strings
+		count, err = store.Count(&Ticket{}, badgerhold.Where("Level").Gt(enumLevel(9)))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		count, err = store.Count(&Ticket{}, badgerhold.Where("Status").Gt(enumStatusNew).And("Status").Lt(3))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		// values the field's type can't hold, and other enum types, aren't converted
+		count, err = store.Count(&Ticket{}, badgerhold.Where("Status").Eq(257))
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		count, err = store.Count(&Ticket{}, badgerhold.Where("Status").Eq(enumLevel(1)))
+		ok(t, err)
+		equals(t, uint64(0), count)
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// badgerholdDefaultPrefix is the badgerhold tag value prefix setting the default value of a field
+const badgerholdDefaultPrefix = "default="
+
+type fieldDefault struct {
+	index int
+	value reflect.Value
+}
+
+// typeDefaults are the default values of the fields of a type, or the error parsing them
+type typeDefaults struct {
+	fields []fieldDefault
+	err    error
+}
+
+// fieldDefaults returns the default values set with the badgerhold:"default=..." tag on the fields of the type
+func (s *Store) fieldDefaults(tp reflect.Type) ([]fieldDefault, error) {
+	if cached, ok := s.defaults.Load(tp); ok {
+		return cached.(typeDefaults).fields, cached.(typeDefaults).err
+	}
+
+	var result typeDefaults
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		tag := field.Tag.Get(badgerholdPrefixTag)
+		if !strings.HasPrefix(tag, badgerholdDefaultPrefix) {
+			continue
+		}
+
+		value, err := parseDefault(field.Type, strings.TrimPrefix(tag, badgerholdDefaultPrefix))
+		if err != nil {
+			result = typeDefaults{
+				err: fmt.Errorf("The default value of the field %s is invalid: %s", field.Name, err),
+			}
+			break
+		}
+		result.fields = append(result.fields, fieldDefault{index: i, value: value})
+	}
+
+	s.defaults.Store(tp, result)
+	return result.fields, result.err
+}
+
+// parseDefault parses the default value of a field of the type from its tag
+func parseDefault(tp reflect.Type, value string) (reflect.Value, error) {
+	result := reflect.New(tp).Elem()
+
+	if tp == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.SetInt(int64(d))
+		return result, nil
+	}
+
+	switch tp.Kind() {
+	case reflect.String:
+		result.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, tp.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, tp.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, tp.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.SetFloat(f)
+	default:
+		return reflect.Value{}, fmt.Errorf("fields of type %s can't have a default value", tp)
+	}
+
+	return result, nil
+}
+
+// decodeRecord decodes a record being read, and sets any fields with a default value that decoded to their zero
+// value to the default.  Records being written are decoded without defaults, so their indexes are updated with the
+// values that were stored
+func (s *Store) decodeRecord(data []byte, value interface{}) error {
+	err := s.decode(data, value)
+	if err != nil {
+		return err
+	}
+
+	record := reflect.ValueOf(value)
+	for record.Kind() == reflect.Ptr {
+		if record.IsNil() {
+			return nil
+		}
+		record = record.Elem()
+	}
+	if record.Kind() != reflect.Struct {
+		return nil
+	}
+
+	defaults, err := s.fieldDefaults(record.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, d := range defaults {
+		field := record.Field(d.index)
+		if field.IsZero() {
+			field.Set(d.value)
+		}
+	}
+
+	return nil
+}
+
+// recordDecoder returns the function to decode the records read by the query with
+func (s *Store) recordDecoder(query *Query) DecodeFunc {
+	if query.covering {
+		// the data is the encoded value of the index
+		return func(data []byte, value interface{}) error {
+			return s.decode(data, reflect.ValueOf(value).Elem().FieldByName(query.index).Addr().Interface())
+		}
+	}
+	if query.writable {
+		return s.decode
+	}
+	return s.decodeRecord
+}
@@ -5,62 +5,149 @@
 package badgerhold
 
 import (
+	"reflect"
+
 	"github.com/dgraph-io/badger/v4"
 )
 
 // Delete deletes a record from the badgerhold, datatype just needs to be an example of the type stored so that
 // the proper bucket and indexes are updated
 func (s *Store) Delete(key, dataType interface{}) error {
-	return s.Badger().Update(func(tx *badger.Txn) error {
+	return s.update(func(tx *badger.Txn) error {
 		return s.TxDelete(tx, key, dataType)
 	})
 }
 
 // TxDelete is the same as Delete except it allows you to specify your own transaction
 func (s *Store) TxDelete(tx *badger.Txn, key, dataType interface{}) error {
-	storer := s.newStorer(dataType)
-	gk, err := s.encodeKey(key, storer.Type())
+	_, err := s.deleteValue(tx, key, newElemType(dataType))
+	return err
+}
+
+// DeleteReturn deletes a record from the badgerhold, and puts the record that was deleted into result, including
+// its key field.  Returns ErrNotFound if there is no record with the key
+func (s *Store) DeleteReturn(key, result interface{}) error {
+	return s.update(func(tx *badger.Txn) error {
+		return s.TxDeleteReturn(tx, key, result)
+	})
+}
 
+// TxDeleteReturn is the same as DeleteReturn except it allows you to specify your own transaction
+func (s *Store) TxDeleteReturn(tx *badger.Txn, key, result interface{}) error {
+	gk, err := s.deleteValue(tx, key, result)
 	if err != nil {
 		return err
 	}
 
-	value := newElemType(dataType)
+	keyField, ok := getKeyField(dereference(reflect.TypeOf(result)))
+	if !ok {
+		return nil
+	}
+
+	return s.setKeyField(gk, reflect.ValueOf(result), keyField, s.newStorer(result).Type())
+}
+
+// deleteValue decodes the record with the passed in key into value, then deletes it and its indexes
+func (s *Store) deleteValue(tx *badger.Txn, key, value interface{}) ([]byte, error) {
+	storer := s.newStorer(value)
+	gk, err := s.encodeKey(key, storer.Type())
+
+	if err != nil {
+		return nil, err
+	}
 
 	item, err := tx.Get(gk)
 	if err == badger.ErrKeyNotFound {
-		return ErrNotFound
+		return nil, ErrNotFound
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = item.Value(func(bVal []byte) error {
 		return s.decode(bVal, value)
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// delete data
 	err = tx.Delete(gk)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// remove any indexes
-	return s.indexDelete(storer, tx, gk, value)
+	err = s.indexDelete(storer, tx, gk, value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.insertOrderDelete(storer, tx, gk)
+	if err != nil {
+		return nil, err
+	}
+
+	return gk, s.deleteCascades(tx, storer, reflect.TypeOf(value), gk)
 }
 
 // DeleteMatching deletes all the records that match the passed in query
+// If the BatchSize option is set, the records are deleted in batches, each in their own transaction
 func (s *Store) DeleteMatching(dataType interface{}, query *Query) error {
-	return s.Badger().Update(func(tx *badger.Txn) error {
+	if s.batchSize > 0 {
+		storer := s.newStorer(dataType)
+		return s.batchQuery(dataType, query, func(tx *badger.Txn, r *record) error {
+			return s.deleteRecord(storer, tx, r)
+		})
+	}
+
+	return s.update(func(tx *badger.Txn) error {
 		return s.TxDeleteMatching(tx, dataType, query)
 	})
 }
 
 // TxDeleteMatching does the same as DeleteMatching, but allows you to specify your own transaction
 func (s *Store) TxDeleteMatching(tx *badger.Txn, dataType interface{}, query *Query) error {
-	return s.deleteQuery(tx, dataType, query)
+	_, err := s.deleteQuery(tx, dataType, query)
+	return err
+}
+
+// DeleteMatchingKeys deletes all the records that match the passed in query, and returns the keys of the deleted
+// records.  dataType must have a field tagged as the key, which is the type the keys are decoded into
+func (s *Store) DeleteMatchingKeys(dataType interface{}, query *Query) ([]interface{}, error) {
+	var keys []interface{}
+	err := s.update(func(tx *badger.Txn) error {
+		var txErr error
+		keys, txErr = s.TxDeleteMatchingKeys(tx, dataType, query)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// TxDeleteMatchingKeys does the same as DeleteMatchingKeys, but allows you to specify your own transaction
+func (s *Store) TxDeleteMatchingKeys(tx *badger.Txn, dataType interface{}, query *Query) ([]interface{}, error) {
+	decodeKey, err := s.keyDecoder(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.deleteQuery(tx, dataType, query)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]interface{}, len(records))
+	for i := range records {
+		keys[i], err = decodeKey(records[i].key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
 }
@@ -41,6 +41,30 @@ func TestDelete(t *testing.T) {
 	})
 }
 
+func TestDeleteReturn(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		expected := testData[3]
+		var result ItemTest
+		ok(t, store.DeleteReturn(expected.Key, &result))
+		equals(t, expected.Key, result.Key)
+		equals(t, expected.Name, result.Name)
+		equals(t, expected.Category, result.Category)
+
+		equals(t, badgerhold.ErrNotFound, store.Get(expected.Key, &ItemTest{}))
+
+		// the index entries are removed too
+		var found []ItemTest
+		ok(t, store.Find(&found, badgerhold.Where("Category").Eq(expected.Category).Index("Category")))
+		for i := range found {
+			assert(t, found[i].Key != expected.Key, "deleted record was found through its index")
+		}
+
+		equals(t, badgerhold.ErrNotFound, store.DeleteReturn(expected.Key, &ItemTest{}))
+	})
+}
+
 func TestDeleteMatching(t *testing.T) {
 	for _, tst := range testResults {
 		t.Run(tst.name, func(t *testing.T) {
@@ -196,3 +220,220 @@ func TestDeleteDecodeError(t *testing.T) {
 		}
 	})
 }
+
+func TestDeleteMatchingKeys(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type KeyTest struct {
+			Key   int `badgerholdKey:"Key"`
+			Value int
+		}
+
+		for i := 0; i < 10; i++ {
+			ok(t, store.Insert(i, &KeyTest{Value: i * 10}))
+		}
+
+		keys, err := store.DeleteMatchingKeys(&KeyTest{}, badgerhold.Where("Value").Ge(70))
+		ok(t, err)
+		equals(t, []interface{}{7, 8, 9}, keys)
+
+		count, err := store.Count(&KeyTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(7), count)
+
+		keys, err = store.DeleteMatchingKeys(&KeyTest{}, badgerhold.Where("Value").Ge(70))
+		ok(t, err)
+		equals(t, []interface{}{}, keys)
+
+		_, err = store.DeleteMatchingKeys(&ItemTest{}, nil)
+		assert(t, err != nil, "DeleteMatchingKeys on a type without a key field did not return an error")
+	})
+}
+
+func TestDeleteMatchingByIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type IndexedKeyTest struct {
+			Key      int    `badgerholdKey:"Key"`
+			Category string `badgerholdIndex:"Category"`
+		}
+
+		categories := []string{"a", "b", "c"}
+		for i := 0; i < 9; i++ {
+			ok(t, store.Insert(i, &IndexedKeyTest{Category: categories[i%3]}))
+		}
+
+		keys, err := store.DeleteMatchingKeys(&IndexedKeyTest{}, badgerhold.Where("Category").Eq("a").Index("Category"))
+		ok(t, err)
+		equals(t, []interface{}{0, 3, 6}, keys)
+
+		keys, err = store.DeleteMatchingKeys(&IndexedKeyTest{},
+			badgerhold.Where("Category").In("b", "b", "z").Index("Category"))
+		ok(t, err)
+		equals(t, []interface{}{1, 4, 7}, keys)
+
+		// the deleted records are removed from the index too
+		for _, category := range categories {
+			indexed, err := store.Count(&IndexedKeyTest{}, badgerhold.Where("Category").Eq(category).Index("Category"))
+			ok(t, err)
+			scanned, err := store.Count(&IndexedKeyTest{}, badgerhold.Where("Category").Eq(category))
+			ok(t, err)
+			equals(t, scanned, indexed)
+		}
+
+		count, err := store.Count(&IndexedKeyTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(3), count)
+
+		ok(t, store.DeleteMatching(&IndexedKeyTest{}, badgerhold.Where("Category").Eq("c").Index("Category")))
+		count, err = store.Count(&IndexedKeyTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(0), count)
+	})
+}
+
+func TestBatchedUpdateAndDeleteMatching(t *testing.T) {
+	opt := testOptions()
+	opt.BatchSize = 10
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		type Batched struct {
+			ID       int    `badgerhold:"key"`
+			Category string `badgerhold:"index"`
+		}
+
+		for i := 0; i < 105; i++ {
+			ok(t, store.Insert(i, &Batched{Category: "old"}))
+		}
+
+		ok(t, store.UpdateMatching(&Batched{}, badgerhold.Where("Category").Eq("old").Index("Category"),
+			func(record interface{}) error {
+				record.(*Batched).Category = "new"
+				return nil
+			}))
+
+		count, err := store.Count(&Batched{}, badgerhold.Where("Category").Eq("new").Index("Category"))
+		ok(t, err)
+		equals(t, uint64(105), count)
+
+		ok(t, store.DeleteMatching(&Batched{}, badgerhold.Where(badgerhold.Key).Ge(50)))
+
+		count, err = store.Count(&Batched{}, badgerhold.Where("Category").Eq("new").Index("Category"))
+		ok(t, err)
+		equals(t, uint64(50), count)
+
+		// batches committed before an error are kept
+		updated := 0
+		err = store.UpdateMatching(&Batched{}, nil, func(record interface{}) error {
+			if updated == 25 {
+				return errors.New("stop")
+			}
+			updated++
+			record.(*Batched).Category = "partial"
+			return nil
+		})
+		assert(t, err != nil, "UpdateMatching did not return the error from the update func")
+
+		count, err = store.Count(&Batched{}, badgerhold.Where("Category").Eq("partial"))
+		ok(t, err)
+		equals(t, uint64(20), count)
+
+		// skips and limits carry across batches
+		ok(t, store.UpdateMatching(&Batched{}, badgerhold.Where("Category").Ne("limited").Skip(5).Limit(25),
+			func(record interface{}) error {
+				record.(*Batched).Category = "limited"
+				return nil
+			}))
+
+		count, err = store.Count(&Batched{}, badgerhold.Where("Category").Eq("limited").Index("Category"))
+		ok(t, err)
+		equals(t, uint64(25), count)
+	})
+}
+
+func TestBatchedUpdateMatchingTxnTooBig(t *testing.T) {
+	type Batched struct {
+		ID       int    `badgerhold:"key"`
+		Category string `badgerhold:"index"`
+		Payload  []byte
+	}
+
+	const records = 2000
+	insert := func(t *testing.T, store *badgerhold.Store) {
+		for i := 0; i < records; i++ {
+			ok(t, store.Insert(i, &Batched{Category: "old", Payload: make([]byte, 256)}))
+		}
+	}
+	update := func(record interface{}) error {
+		record.(*Batched).Category = "new"
+		return nil
+	}
+
+	opt := testOptions()
+	opt.MemTableSize = 1 << 20
+	opt.ValueThreshold = 1 << 10
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insert(t, store)
+		err := store.UpdateMatching(&Batched{}, badgerhold.Where("Category").Eq("old"), update)
+		equals(t, badger.ErrTxnTooBig, err)
+	})
+
+	opt = testOptions()
+	opt.MemTableSize = 1 << 20
+	opt.ValueThreshold = 1 << 10
+	opt.BatchSize = records
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insert(t, store)
+		ok(t, store.UpdateMatching(&Batched{}, badgerhold.Where("Category").Eq("old"), update))
+
+		count, err := store.Count(&Batched{}, badgerhold.Where("Category").Eq("new").Index("Category"))
+		ok(t, err)
+		equals(t, uint64(records), count)
+	})
+}
+
+func TestDeleteCascade(t *testing.T) {
+	type Order struct {
+		ID       int `badgerhold:"key"`
+		Customer string
+	}
+	type Line struct {
+		ID      int `badgerhold:"key"`
+		OrderID int `badgerholdIndex:"OrderID"`
+	}
+	type Note struct {
+		LineID *int
+	}
+
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		store.RegisterCascade(&Order{}, Line{}, "OrderID")
+		store.RegisterCascade(Line{}, &Note{}, "LineID")
+
+		for i := 1; i <= 3; i++ {
+			ok(t, store.Insert(i, &Order{Customer: "c"}))
+			for k := 0; k < 2; k++ {
+				lineID := i*10 + k
+				ok(t, store.Insert(lineID, &Line{OrderID: i}))
+				ok(t, store.Insert(badgerhold.NextSequence(), &Note{LineID: &lineID}))
+			}
+		}
+
+		ok(t, store.Delete(1, &Order{}))
+
+		var lines []Line
+		ok(t, store.Find(&lines, nil))
+		equals(t, 4, len(lines))
+		for i := range lines {
+			assert(t, lines[i].OrderID != 1, "A line of the deleted order was not deleted")
+		}
+
+		var notes []Note
+		ok(t, store.Find(&notes, nil))
+		equals(t, 4, len(notes))
+
+		ok(t, store.DeleteMatching(&Order{}, badgerhold.Where(badgerhold.Key).Gt(1)))
+		lines = nil
+		ok(t, store.Find(&lines, nil))
+		equals(t, 0, len(lines))
+		notes = nil
+		ok(t, store.Find(&notes, nil))
+		equals(t, 0, len(notes))
+	})
+}
@@ -6,7 +6,12 @@ package badgerhold
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
 )
 
 // EncodeFunc is a function for encoding a value into bytes
@@ -42,6 +47,135 @@ func DefaultDecode(data []byte, value interface{}) error {
 	return de.Decode(value)
 }
 
+// orderedEncode encodes the value so the bytes of values of the same type sort in the same order as the values, and
+// no value's bytes are a prefix of another's, for the columns of ordered composite indexes.  Integers are encoded as
+// 8 big-endian bytes with the sign bit flipped, floats as their IEEE 754 bits with the bits of negative values
+// flipped, times as their Unix seconds and nanoseconds, and strings and byte slices with their 0 bytes escaped
+// and a terminator
+func orderedEncode(value interface{}) ([]byte, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.IsValid() && v.Type() == reflect.TypeOf(time.Time{}) {
+		t := v.Interface().(time.Time)
+		result := make([]byte, 12)
+		binary.BigEndian.PutUint64(result, uint64(t.Unix())^(1<<63))
+		binary.BigEndian.PutUint32(result[8:], uint32(t.Nanosecond()))
+		return result, nil
+	}
+
+	result := make([]byte, 8)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.BigEndian.PutUint64(result, uint64(v.Int())^(1<<63))
+		return result, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.BigEndian.PutUint64(result, v.Uint())
+		return result, nil
+	case reflect.Float32, reflect.Float64:
+		bits := math.Float64bits(v.Float())
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		binary.BigEndian.PutUint64(result, bits)
+		return result, nil
+	case reflect.String:
+		return orderedBytes([]byte(v.String())), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return orderedBytes(v.Bytes()), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v (%T) can't be encoded in an ordered composite index", value, value)
+}
+
+// orderedBytes escapes each 0 byte as 0x00 0xFF and terminates the bytes with 0x00 0x01, so shorter values sort
+// before longer ones they're a prefix of
+func orderedBytes(value []byte) []byte {
+	result := make([]byte, 0, len(value)+2)
+	for _, b := range value {
+		result = append(result, b)
+		if b == 0 {
+			result = append(result, 0xFF)
+		}
+	}
+	return append(result, 0, 1)
+}
+
+type codec struct {
+	encode EncodeFunc
+	decode DecodeFunc
+}
+
+// RegisterCodec has values of dataType encoded and decoded with the passed in functions rather than the store's
+// Encoder and Decoder, so types can be stored in different formats, such as protobuf for types shared with other
+// languages.  The codec is used wherever a value of the type is encoded, including keys and index values of the
+// type, so register it before any values of the type are written
+func (s *Store) RegisterCodec(dataType interface{}, encode EncodeFunc, decode DecodeFunc) {
+	if encode == nil || decode == nil {
+		panic("Both the encode and decode functions of a codec must be set")
+	}
+
+	s.codecs.Store(dereference(reflect.TypeOf(dataType)), codec{
+		encode: encode,
+		decode: decode,
+	})
+}
+
+// codec returns the codec registered for the type of the value, if there is one
+func (s *Store) codec(value interface{}) (codec, bool) {
+	tp := reflect.TypeOf(value)
+	if tp == nil {
+		return codec{}, false
+	}
+
+	c, ok := s.codecs.Load(dereference(tp))
+	if !ok {
+		return codec{}, false
+	}
+	return c.(codec), true
+}
+
+// encode encodes the value with the codec registered for its type, or the store's Encoder
+func (s *Store) encode(value interface{}) ([]byte, error) {
+	if c, ok := s.codec(value); ok {
+		return c.encode(value)
+	}
+	return s.encoder(value)
+}
+
+// decode decodes the data into value with the codec registered for its type, or the store's Decoder, falling back
+// to the FallbackDecoder if the Decoder fails
+func (s *Store) decode(data []byte, value interface{}) error {
+	if c, ok := s.codec(value); ok {
+		return c.decode(data, value)
+	}
+
+	err := s.decoder(data, value)
+	if err == nil || s.fallbackDecoder == nil {
+		return err
+	}
+
+	// clear anything the failed decode set before it failed
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	if s.fallbackDecoder(data, value) != nil {
+		return err
+	}
+	return nil
+}
+
 // encodeKey encodes key values with a type prefix which allows multiple different types
 // to exist in the badger DB
 func (s *Store) encodeKey(key interface{}, typeName string) ([]byte, error) {
@@ -57,3 +191,20 @@ func (s *Store) encodeKey(key interface{}, typeName string) ([]byte, error) {
 func (s *Store) decodeKey(data []byte, key interface{}, typeName string) error {
 	return s.decode(data[len(typePrefix(typeName)):], key)
 }
+
+// EncodeKey returns the badger key a record of the passed in type is stored under for the passed in key value.
+// typeName is the type's name as returned by its Storer, which for types that don't implement Storer is the name
+// of the struct.  The key is within the namespace of the store, if it has one
+func (s *Store) EncodeKey(key interface{}, typeName string) ([]byte, error) {
+	return s.encodeKey(key, s.namespaced(typeName))
+}
+
+// DecodeKey decodes a badger key of a record of the passed in type into key, which must be a pointer to the type
+// the key was stored as.  Returns an error if the badger key isn't for a record of the type
+func (s *Store) DecodeKey(data []byte, key interface{}, typeName string) error {
+	typeName = s.namespaced(typeName)
+	if !bytes.HasPrefix(data, typePrefix(typeName)) {
+		return fmt.Errorf("The key %x is not a key for the type %s", data, typeName)
+	}
+	return s.decodeKey(data, key, typeName)
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// exportVersion is the version of the format written by ExportType
+const exportVersion = 1
+
+// exportHeader starts the data written by ExportType, describing the type of the records that follow
+type exportHeader struct {
+	Version int
+	Type    string   // the type name, without the namespace of the store it was exported from
+	Unique  []string // the names of the unique indexes of the type
+}
+
+// exportEntry is a record or an index entry written by ExportType.  Keys are written without their type prefix, so
+// they can be imported into a different namespace
+type exportEntry struct {
+	Key   []byte   // the encoded key of a record, or the value of an index entry
+	Value []byte   // the encoded record
+	Index string   // the name of the index, for index entries
+	Keys  [][]byte // the encoded keys of the records with the value, for index entries
+}
+
+// typeNameStorer is the Storer of a type that's only known by its name, and has no indexes
+type typeNameStorer string
+
+func (t typeNameStorer) Type() string              { return string(t) }
+func (t typeNameStorer) Indexes() map[string]Index { return nil }
+
+// ExportType writes every record of dataType, along with their index entries, to w, so they can be imported into
+// another store with ImportType.  The records are written as they're stored, so the store they're imported into
+// must use the same Encoder and Decoder.  The records are read in a single read transaction
+func (s *Store) ExportType(dataType interface{}, w io.Writer) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxExportType(tx, dataType, w)
+	})
+}
+
+// TxExportType is the same as ExportType, but you specify your own transaction
+func (s *Store) TxExportType(tx *badger.Txn, dataType interface{}, w io.Writer) error {
+	storer := s.newStorer(dataType)
+	typeName := storer.Type()
+
+	header := exportHeader{
+		Version: exportVersion,
+		Type:    storerType(storer),
+	}
+	for name, index := range storer.Indexes() {
+		if index.Unique {
+			header.Unique = append(header.Unique, name)
+		}
+	}
+
+	enc := gob.NewEncoder(w)
+	err := enc.Encode(header)
+	if err != nil {
+		return err
+	}
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	prefix := typePrefix(typeName)
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		item := iter.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		err = enc.Encode(exportEntry{
+			Key:   item.KeyCopy(nil)[len(prefix):],
+			Value: value,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(storer.Indexes()))
+	for name := range storer.Indexes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		index := s.indexKeyPrefix(typeName, name)
+		for iter.Seek(index); iter.ValidForPrefix(index); iter.Next() {
+			item := iter.Item()
+			keys := KeyList{}
+			err := item.Value(func(val []byte) error {
+				return s.decode(val, &keys)
+			})
+			if err != nil {
+				return err
+			}
+
+			entry := exportEntry{
+				Key:   item.KeyCopy(nil)[len(index):],
+				Index: name,
+				Keys:  make([][]byte, len(keys)),
+			}
+			for i := range keys {
+				entry.Keys[i] = keys[i][len(prefix):]
+			}
+
+			err = enc.Encode(entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ImportType reads the records and index entries written by ExportType from r, and adds them to the store, in the
+// namespace of the store if it has one.  Returns ErrKeyExists if a record with the same key already exists, and
+// ErrUniqueExists if a unique index value is already used by another record.  Records are imported in as many
+// transactions as they need, so if an error occurs, the records already committed are kept.  Records are added to
+// the insertion order in key order
+func (s *Store) ImportType(r io.Reader) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	dec := gob.NewDecoder(r)
+
+	var header exportHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return err
+	}
+	if header.Version != exportVersion {
+		return fmt.Errorf("The export version %d is not supported", header.Version)
+	}
+
+	storer := typeNameStorer(s.namespaced(header.Type))
+	s.queryCache.beginWrite()
+	defer s.queryCache.endWrite()
+	unique := make(map[string]bool, len(header.Unique))
+	for _, name := range header.Unique {
+		unique[name] = true
+	}
+
+	tx, done := s.newTransaction(true)
+	defer func() {
+		tx.Discard()
+		done()
+	}()
+
+	// the entries written in the current transaction.  An entry that doesn't fit in the transaction may have been
+	// partly written, so the transaction is thrown away and the entries before it are written again in a new one
+	var written []exportEntry
+	for {
+		var entry exportEntry
+		err = dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.importEntry(tx, storer, unique, entry)
+		if err == badger.ErrTxnTooBig {
+			tx.Discard()
+			done()
+			tx, done = s.newTransaction(true)
+			for i := range written {
+				err = s.importEntry(tx, storer, unique, written[i])
+				if err != nil {
+					return err
+				}
+			}
+			err = tx.Commit()
+			if err != nil {
+				return err
+			}
+			done()
+
+			written = written[:0]
+			tx, done = s.newTransaction(true)
+			err = s.importEntry(tx, storer, unique, entry)
+		}
+		if err != nil {
+			return err
+		}
+		written = append(written, entry)
+	}
+
+	return tx.Commit()
+}
+
+// importEntry adds an exported record or index entry
+func (s *Store) importEntry(tx *badger.Txn, storer Storer, unique map[string]bool, entry exportEntry) error {
+	prefix := typePrefix(storer.Type())
+
+	if entry.Index == "" {
+		key := append(prefix, entry.Key...)
+		_, err := tx.Get(key)
+		if err == nil {
+			return ErrKeyExists
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		err = tx.Set(key, entry.Value)
+		if err != nil {
+			return err
+		}
+		s.queryCache.invalidate(storer.Type())
+		return s.insertOrderAdd(storer, tx, key)
+	}
+
+	indexKey := s.newIndexKey(storer.Type(), entry.Index, entry.Key)
+	s.invalidateIndexCache(storer.Type(), entry.Index, indexKey)
+
+	keys := KeyList{}
+	item, err := tx.Get(indexKey)
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+	if err == nil {
+		if unique[entry.Index] {
+			return ErrUniqueExists
+		}
+		err = item.Value(func(val []byte) error {
+			return s.decode(val, &keys)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range entry.Keys {
+		keys.Add(append(append([]byte(nil), prefix...), entry.Keys[i]...))
+	}
+
+	value, err := s.encode(keys)
+	if err != nil {
+		return err
+	}
+	return tx.Set(indexKey, value)
+}
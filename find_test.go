@@ -5,12 +5,16 @@
 package badgerhold_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/badger/v4"
 	"github.com/timshannon/badgerhold/v4"
 )
 
@@ -300,6 +304,11 @@ var testResults = []test{
 		query:  badgerhold.Where("Name").RegExp(regexp.MustCompile("ea")),
 		result: []int{2, 9, 12},
 	},
+	{
+		name:   "Regular Expression String",
+		query:  badgerhold.Where("ID").RegExpString(regexp.MustCompile("^1")),
+		result: []int{1, 5, 11, 12, 14, 15},
+	},
 	{
 		name: "Function Field",
 		query: badgerhold.Where("Name").MatchFunc(func(ra *badgerhold.RecordAccess) (bool, error) {
@@ -1223,6 +1232,36 @@ func TestCount(t *testing.T) {
 	})
 }
 
+func TestCountApprox(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		count, err := store.CountApprox(ItemTest{})
+		ok(t, err)
+		equals(t, uint64(len(testData)), count)
+
+		type Sample struct {
+			ID int
+		}
+
+		const total = 12000
+		for i := 0; i < total; i += 1000 {
+			ok(t, store.Badger().Update(func(tx *badger.Txn) error {
+				for k := i; k < i+1000; k++ {
+					if err := store.TxInsert(tx, k, &Sample{ID: k}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}))
+		}
+
+		count, err = store.CountApprox(&Sample{})
+		ok(t, err)
+		assert(t, count >= 10000 && count <= 2*total, fmt.Sprintf("The approximate count %d is too far off", count))
+	})
+}
+
 func TestIssue74HasPrefixOnKeys(t *testing.T) {
 	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
 		type Item struct {
@@ -1411,3 +1450,1524 @@ func TestQueryMatch(t *testing.T) {
 		}
 	})
 }
+
+func TestMatchingQueries(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		item := queryMatchTest{
+			Key:   1,
+			Age:   2,
+			Color: "color",
+		}
+		queries := []*badgerhold.Query{
+			badgerhold.Where("Key").Eq(1),
+			badgerhold.Where("Key").Eq(2),
+			nil,
+			badgerhold.Where("Age").Gt(5).Or(badgerhold.Where("Color").Eq("color")),
+			badgerhold.Where("Color").Eq("notcolor"),
+		}
+
+		matching, err := store.MatchingQueries(&item, queries)
+		ok(t, err)
+		equals(t, []int{0, 2, 3}, matching)
+
+		matching, err = store.MatchingQueries(item, queries[1:2])
+		ok(t, err)
+		equals(t, 0, len(matching))
+	})
+}
+
+func TestFindStoredValue(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		type Config struct {
+			Limit    int
+			Category string
+		}
+		ok(t, store.Insert("config", &Config{Limit: 10, Category: "food"}))
+
+		over := func(limit int) uint64 {
+			count := uint64(0)
+			for i := range testData {
+				if testData[i].ID > limit {
+					count++
+				}
+			}
+			return count
+		}
+
+		query := badgerhold.Where("ID").Gt(badgerhold.StoredValue(&Config{}, "config", "Limit"))
+		count, err := store.Count(&ItemTest{}, query)
+		ok(t, err)
+		equals(t, over(10), count)
+
+		// read again each time the query is run
+		ok(t, store.Update("config", &Config{Limit: 5, Category: "food"}))
+		count, err = store.Count(&ItemTest{}, query)
+		ok(t, err)
+		equals(t, over(5), count)
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq(
+			badgerhold.StoredValue(Config{}, "config", "Category")).Index("Category")))
+		equals(t, 5, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("vehicle",
+			badgerhold.StoredValue(Config{}, "config", "Category"))))
+		count = 0
+		for i := range testData {
+			if testData[i].Category == "vehicle" || testData[i].Category == "food" {
+				count++
+			}
+		}
+		equals(t, int(count), len(result))
+
+		matches, err := badgerhold.Where("Name").Eq(badgerhold.StoredValue(Config{}, "config", "Category")).
+			Matches(store, &ItemTest{Name: "food"})
+		ok(t, err)
+		assert(t, matches, "The record did not match the stored value")
+
+		_, err = store.Count(&ItemTest{}, badgerhold.Where("ID").Gt(badgerhold.StoredValue(&Config{}, "missing",
+			"Limit")))
+		equals(t, badgerhold.ErrNotFound, err)
+
+		_, err = json.Marshal(query)
+		assert(t, err != nil, "A query with a StoredValue was marshalled")
+	})
+}
+
+func TestFindMapped(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		type Summary struct {
+			Key  int
+			Name string
+		}
+
+		var result []Summary
+		ok(t, store.FindMapped(&ItemTest{}, badgerhold.Where("Category").Eq("vehicle").SortBy("Name"),
+			func(record interface{}) (interface{}, error) {
+				item := record.(*ItemTest)
+				return Summary{Key: item.Key, Name: strings.ToUpper(item.Name)}, nil
+			}, &result))
+
+		var want []ItemTest
+		ok(t, store.Find(&want, badgerhold.Where("Category").Eq("vehicle").SortBy("Name")))
+		equals(t, len(want), len(result))
+		for i := range want {
+			equals(t, Summary{Key: want[i].Key, Name: strings.ToUpper(want[i].Name)}, result[i])
+		}
+
+		var names []string
+		err := store.FindMapped(&ItemTest{}, nil, func(record interface{}) (interface{}, error) {
+			return record.(*ItemTest).ID, nil
+		}, &names)
+		assert(t, err != nil, "Appending ints to a slice of strings did not fail")
+
+		fail := errors.New("fail")
+		equals(t, fail, store.FindMapped(&ItemTest{}, nil, func(record interface{}) (interface{}, error) {
+			return nil, fail
+		}, &names))
+	})
+}
+
+func TestTypedFind(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query := badgerhold.Where("Category").Eq("food").SortBy("Name")
+
+		var want []ItemTest
+		ok(t, store.Find(&want, query))
+
+		items, err := badgerhold.Find[ItemTest](store, query)
+		ok(t, err)
+		equals(t, want, items)
+
+		pointers, err := badgerhold.Find[*ItemTest](store, query)
+		ok(t, err)
+		equals(t, len(want), len(pointers))
+		equals(t, want[0], *pointers[0])
+
+		item, err := badgerhold.FindOne[ItemTest](store, query)
+		ok(t, err)
+		equals(t, want[0], item)
+
+		_, err = badgerhold.FindOne[ItemTest](store, badgerhold.Where("Name").Eq("missing"))
+		equals(t, badgerhold.ErrNotFound, err)
+
+		count, err := badgerhold.Count[ItemTest](store, query)
+		ok(t, err)
+		equals(t, uint64(len(want)), count)
+	})
+}
+
+func TestFindNoIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var indexed []ItemTest
+		ok(t, store.Find(&indexed, badgerhold.Where("Category").Eq("food").Index("Category")))
+
+		var scanned []ItemTest
+		query := badgerhold.Where("Category").Eq("food").Index("Category").NoIndex()
+		before, err := json.Marshal(query)
+		ok(t, err)
+		ok(t, store.Find(&scanned, query))
+
+		// running the query doesn't change it
+		after, err := json.Marshal(query)
+		ok(t, err)
+		equals(t, string(before), string(after))
+
+		equals(t, len(indexed), len(scanned))
+		for i := range indexed {
+			assert(t, indexed[i].equal(&scanned[i]), "Expected %v got %v", indexed[i], scanned[i])
+		}
+
+		// an invalid index is never used, so it isn't an error
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food").NoIndex().Index("BadIndex")))
+		equals(t, len(indexed), len(result))
+	})
+}
+
+func TestFindWithValueFunc(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		category := "animal"
+		query := badgerhold.Where("Category").Eq(badgerhold.ValueFunc(func() interface{} {
+			return category
+		}))
+
+		count, err := store.Count(&ItemTest{}, query)
+		ok(t, err)
+		equals(t, uint64(7), count)
+
+		category = "food"
+		count, err = store.Count(&ItemTest{}, query)
+		ok(t, err)
+		equals(t, uint64(5), count)
+
+		index := badgerhold.Where("Category").In("vehicle", func() interface{} {
+			return category
+		}).Index("Category")
+
+		var result []ItemTest
+		ok(t, store.Find(&result, index))
+		equals(t, 10, len(result))
+
+		count, err = store.Count(&ItemTest{}, badgerhold.Where("Created").Lt(badgerhold.Now()))
+		ok(t, err)
+		equals(t, uint64(12), count)
+
+		// the same query run from several goroutines resolves its values separately for each run
+		shared := badgerhold.Where("Created").Lt(badgerhold.Now()).Or(
+			badgerhold.Where("Category").Eq(badgerhold.ValueFunc(func() interface{} {
+				return "food"
+			})))
+		errs := make(chan error, 10)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				count, err := store.Count(&ItemTest{}, shared)
+				if err == nil && count != 12 {
+					err = fmt.Errorf("Count returned %d records, expected 12", count)
+				}
+				errs <- err
+			}()
+		}
+		for i := 0; i < cap(errs); i++ {
+			ok(t, <-errs)
+		}
+	})
+}
+
+func TestFindWithinLast(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Post struct {
+			Created time.Time
+		}
+
+		now := time.Now()
+		ok(t, store.Insert(1, &Post{Created: now.Add(-time.Hour)}))
+		ok(t, store.Insert(2, &Post{Created: now.Add(-48 * time.Hour)}))
+		ok(t, store.Insert(3, &Post{Created: now.Add(-24*time.Hour + 200*time.Millisecond)}))
+
+		within := badgerhold.Where("Created").WithinLast(24 * time.Hour)
+		older := badgerhold.Where("Created").OlderThan(24 * time.Hour)
+
+		count, err := store.Count(&Post{}, within)
+		ok(t, err)
+		equals(t, uint64(2), count)
+		count, err = store.Count(&Post{}, older)
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		// the window moves with each run of the query
+		time.Sleep(300 * time.Millisecond)
+		count, err = store.Count(&Post{}, within)
+		ok(t, err)
+		equals(t, uint64(1), count)
+		count, err = store.Count(&Post{}, older)
+		ok(t, err)
+		equals(t, uint64(2), count)
+	})
+}
+
+func TestSubQueryMaxDepth(t *testing.T) {
+	opt := testOptions()
+	opt.MaxSubQueryDepth = 2
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var nested func(depth int) *badgerhold.Query
+		nested = func(depth int) *badgerhold.Query {
+			return badgerhold.Where("Name").MatchFunc(func(ra *badgerhold.RecordAccess) (bool, error) {
+				if depth == 0 {
+					return true, nil
+				}
+				var result []ItemTest
+				err := ra.SubQuery(&result, nested(depth-1))
+				return len(result) > 0, err
+			}).Limit(1)
+		}
+
+		var result []ItemTest
+		ok(t, store.Find(&result, nested(2)))
+		equals(t, 1, len(result))
+
+		result = nil
+		err := store.Find(&result, nested(3))
+		equals(t, badgerhold.ErrSubQueryDepth, err)
+	})
+}
+
+func TestFindMap(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var result map[int]ItemTest
+		ok(t, store.FindMap(&result, badgerhold.Where("Category").Eq("food")))
+		equals(t, 5, len(result))
+		for key, item := range result {
+			assert(t, item.equal(&testData[key]), "Expected %v for key %d, got %v", testData[key], key, item)
+		}
+
+		ptrs := map[int]*ItemTest{}
+		ok(t, store.FindMap(&ptrs, badgerhold.Where("Category").Eq("vehicle").Limit(2)))
+		equals(t, 2, len(ptrs))
+		for key, item := range ptrs {
+			assert(t, item.equal(&testData[key]), "Expected %v for key %d, got %v", testData[key], key, item)
+		}
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatalf("Running FindMap with a non map pointer did not panic!")
+			}
+		}()
+		_ = store.FindMap(result, nil)
+	})
+}
+
+func TestFindMapKeyStructTag(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type KeyTest struct {
+			Key   string `badgerholdKey:"Key"`
+			Value int
+		}
+
+		ok(t, store.Insert("one", &KeyTest{Value: 1}))
+		ok(t, store.Insert("two", &KeyTest{Value: 2}))
+
+		var result map[string]*KeyTest
+		ok(t, store.FindMap(&result, nil))
+		equals(t, map[string]*KeyTest{
+			"one": {Key: "one", Value: 1},
+			"two": {Key: "two", Value: 2},
+		}, result)
+	})
+}
+
+func TestFindBytesPrefix(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Blob struct {
+			Hash  []byte
+			Array [4]byte
+			Name  string
+		}
+
+		ok(t, store.Insert(1, &Blob{Hash: []byte{0x00, 0xff, 0x10}, Array: [4]byte{0x00, 0xff}}))
+		ok(t, store.Insert(2, &Blob{Hash: []byte{0x00, 0xfe, 0x10}, Array: [4]byte{0x00, 0xfe}}))
+		ok(t, store.Insert(3, &Blob{Hash: []byte{0x01}, Array: [4]byte{0x01}}))
+
+		count, err := store.Count(&Blob{}, badgerhold.Where("Hash").BytesPrefix([]byte{0x00}))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		count, err = store.Count(&Blob{}, badgerhold.Where("Hash").BytesPrefix([]byte{0x00, 0xff}))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Blob{}, badgerhold.Where("Array").BytesPrefix([]byte{0x00, 0xfe}))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		_, err = store.Count(&Blob{}, badgerhold.Where("Name").BytesPrefix([]byte{0x00}))
+		assert(t, err != nil, "BytesPrefix on a string field did not return an error")
+	})
+}
+
+func TestFindHasBits(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Flagged struct {
+			Flags  uint8
+			Signed int
+			Opt    *uint32
+			Name   string
+		}
+
+		opt := uint32(0b1000)
+		ok(t, store.Insert(1, &Flagged{Flags: 0b0110, Signed: -1, Opt: &opt}))
+		ok(t, store.Insert(2, &Flagged{Flags: 0b0010, Signed: 0b0100}))
+		ok(t, store.Insert(3, &Flagged{Flags: 0b1001}))
+
+		count, err := store.Count(&Flagged{}, badgerhold.Where("Flags").HasBits(0b0110))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Flagged{}, badgerhold.Where("Flags").HasAnyBits(0b0110))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		count, err = store.Count(&Flagged{}, badgerhold.Where("Flags").HasBits(0))
+		ok(t, err)
+		equals(t, uint64(3), count)
+
+		count, err = store.Count(&Flagged{}, badgerhold.Where("Signed").HasBits(0b0100))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		count, err = store.Count(&Flagged{}, badgerhold.Where("Opt").HasAnyBits(0b1000))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		_, err = store.Count(&Flagged{}, badgerhold.Where("Name").HasBits(1))
+		assert(t, err != nil, "HasBits on a string field did not return an error")
+	})
+}
+
+func TestFindIndexedSkipLimit(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Paged struct {
+			ID       int    `badgerhold:"key"`
+			Category string `badgerhold:"index"`
+			Value    int
+		}
+
+		for i := 0; i < 500; i++ {
+			ok(t, store.Insert(i, &Paged{Category: fmt.Sprintf("%d", i%2), Value: i % 5}))
+		}
+
+		queries := []func() *badgerhold.Query{
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").Eq("1")
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").Eq("1").And("Value").Ne(3)
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").In("0", "1").And(badgerhold.Key).Gt(100)
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").Ge("1")
+			},
+		}
+
+		page := func(records []Paged, skip, limit int) []Paged {
+			if skip > len(records) {
+				skip = len(records)
+			}
+			end := skip + limit
+			if end > len(records) {
+				end = len(records)
+			}
+			return records[skip:end]
+		}
+
+		for i := range queries {
+			var scannedAll []Paged
+			ok(t, store.Find(&scannedAll, queries[i]()))
+
+			var indexedAll []Paged
+			ok(t, store.Find(&indexedAll, queries[i]().Index("Category")))
+
+			equals(t, len(scannedAll), len(indexedAll))
+
+			for _, p := range [][2]int{{0, 20}, {20, 20}, {190, 20}, {240, 20}, {1000, 20}} {
+				var scanned []Paged
+				ok(t, store.Find(&scanned, queries[i]().Skip(p[0]).Limit(p[1])))
+				equals(t, len(page(scannedAll, p[0], p[1])), len(scanned))
+				if len(scanned) > 0 {
+					equals(t, page(scannedAll, p[0], p[1]), scanned)
+				}
+
+				var indexed []Paged
+				ok(t, store.Find(&indexed, queries[i]().Index("Category").Skip(p[0]).Limit(p[1])))
+				equals(t, len(page(indexedAll, p[0], p[1])), len(indexed))
+				if len(indexed) > 0 {
+					equals(t, page(indexedAll, p[0], p[1]), indexed)
+				}
+			}
+		}
+	})
+}
+
+func TestFindRegisteredAccessor(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		store.RegisterAccessor(&ItemTest{}, "NameLength", func(record interface{}) interface{} {
+			return len(record.(*ItemTest).Name)
+		})
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("NameLength").Eq(4).And("Category").Eq("animal")))
+		equals(t, 5, len(result))
+		for i := range result {
+			equals(t, 4, len(result[i].Name))
+			equals(t, "animal", result[i].Category)
+		}
+
+		count, err := store.Count(&ItemTest{}, badgerhold.Where("NameLength").Gt(100))
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		// accessors are registered per type
+		ok(t, store.Insert(1, &BenchData{ID: 1, Category: "test"}))
+		_, err = store.Count(&BenchData{}, badgerhold.Where("NameLength").Eq(4))
+		assert(t, err != nil, "Querying an accessor on an unregistered type did not return an error")
+
+		defer func() {
+			assert(t, recover() != nil, "Registering a lower case accessor did not panic")
+		}()
+		store.RegisterAccessor(&ItemTest{}, "nameLength", func(record interface{}) interface{} { return nil })
+	})
+}
+
+func TestFindRegisteredComputed(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Person struct {
+			First string
+			Last  string
+		}
+
+		store.RegisterComputed(&Person{}, "FullName", func(record interface{}) interface{} {
+			return record.(*Person).First + " " + record.(*Person).Last
+		})
+
+		ok(t, store.Insert(1, &Person{First: "John", Last: "Doe"}))
+		ok(t, store.Insert(2, Person{First: "Jane", Last: "Doe"}))
+		ok(t, store.Insert(3, &Person{First: "John", Last: "Smith"}))
+
+		var result []Person
+		ok(t, store.Find(&result, badgerhold.Where("FullName").Eq("John Doe").Index("FullName")))
+		equals(t, []Person{{First: "John", Last: "Doe"}}, result)
+
+		count, err := store.Count(&Person{}, badgerhold.Where("FullName").Gt("Jane Doe").Index("FullName"))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		// the index follows updates and deletes
+		ok(t, store.Update(1, &Person{First: "Johnny", Last: "Doe"}))
+		ok(t, store.Delete(3, &Person{}))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("FullName").In("John Doe", "Johnny Doe", "John Smith").
+			Index("FullName")))
+		equals(t, []Person{{First: "Johnny", Last: "Doe"}}, result)
+
+		entries := 0
+		ok(t, store.Badger().View(func(tx *badger.Txn) error {
+			prefix := []byte("_bhIndex:Person:FullName:")
+			iter := tx.NewIterator(badger.IteratorOptions{Prefix: prefix})
+			defer iter.Close()
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+				entries++
+			}
+			return nil
+		}))
+		equals(t, 2, entries)
+
+		// still usable as a virtual field without the index
+		count, err = store.Count(&Person{}, badgerhold.Where("FullName").Eq("Jane Doe"))
+		ok(t, err)
+		equals(t, uint64(1), count)
+	})
+}
+
+func TestFindTimeNanoseconds(t *testing.T) {
+	type Event struct {
+		At      time.Time `badgerhold:"key"`
+		Created time.Time
+		Indexed time.Time `badgerholdIndex:"Indexed"`
+	}
+
+	test := func(store *badgerhold.Store, t *testing.T) {
+		// time.Now carries a monotonic clock reading, which is dropped when it's stored
+		now := time.Now()
+		exact := time.Date(2021, time.March, 4, 5, 6, 7, 123456789, time.FixedZone("test", 5*60*60))
+		for _, tm := range []time.Time{now, exact} {
+			ok(t, store.Insert(tm, &Event{Created: tm, Indexed: tm}))
+		}
+
+		for _, tm := range []time.Time{now, exact} {
+			for _, query := range []*badgerhold.Query{
+				badgerhold.Where("Created").Eq(tm),
+				badgerhold.Where("Indexed").Eq(tm).Index("Indexed"),
+				badgerhold.Where(badgerhold.Key).Eq(tm),
+			} {
+				var result []Event
+				ok(t, store.Find(&result, query))
+				equals(t, 1, len(result))
+				assert(t, result[0].Created.Equal(tm), fmt.Sprintf("%v was stored as %v", tm, result[0].Created))
+				assert(t, result[0].At.Equal(tm), fmt.Sprintf("The key %v was stored as %v", tm, result[0].At))
+				equals(t, tm.Nanosecond(), result[0].Created.Nanosecond())
+			}
+		}
+	}
+
+	t.Run("Gob", func(t *testing.T) {
+		testWrap(t, test)
+	})
+	t.Run("JSON", func(t *testing.T) {
+		opt := testOptions()
+		opt.Encoder = json.Marshal
+		opt.Decoder = json.Unmarshal
+		testWrapWithOpt(t, opt, test)
+	})
+}
+
+func TestFindTimeComponents(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Event struct {
+			Name    string
+			Created time.Time
+			Indexed time.Time `badgerholdIndex:"Indexed"`
+		}
+
+		// 2021-01-02 is a Saturday
+		times := []time.Time{
+			time.Date(2021, time.January, 2, 10, 0, 0, 0, time.UTC),  // saturday
+			time.Date(2021, time.January, 4, 9, 0, 0, 0, time.UTC),   // monday
+			time.Date(2021, time.January, 5, 17, 0, 0, 0, time.UTC),  // tuesday
+			time.Date(2021, time.February, 7, 23, 0, 0, 0, time.UTC), // sunday
+			time.Date(2021, time.March, 10, 3, 30, 0, 0, time.UTC),   // wednesday
+		}
+
+		for i := range times {
+			ok(t, store.Insert(i, &Event{Name: fmt.Sprintf("%d", i), Created: times[i], Indexed: times[i]}))
+		}
+
+		names := func(query *badgerhold.Query) []string {
+			var result []Event
+			ok(t, store.Find(&result, query))
+			found := []string{}
+			for i := range result {
+				found = append(found, result[i].Name)
+			}
+			return found
+		}
+
+		equals(t, []string{"0", "3"}, names(badgerhold.Where("Created").Weekday(time.Saturday, time.Sunday)))
+		equals(t, []string{"0", "3"},
+			names(badgerhold.Where("Indexed").Weekday(time.Saturday, time.Sunday).Index("Indexed")))
+		equals(t, []string{"0", "1"}, names(badgerhold.Where("Created").HourBetween(9, 17)))
+		equals(t, []string{"3", "4"}, names(badgerhold.Where("Created").HourBetween(22, 6)))
+		equals(t, []string{"3", "4"}, names(badgerhold.Where("Created").Month(time.February, time.March)))
+
+		_, err := store.Count(&Event{}, badgerhold.Where("Name").Weekday(time.Monday))
+		assert(t, err != nil, "Weekday on a string field did not return an error")
+	})
+}
+
+func TestPreloadIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		ok(t, store.PreloadIndex(&ItemTest{}, "Category"))
+		assert(t, store.PreloadIndex(&ItemTest{}, "Missing") != nil, "Preloading a missing index didn't fail")
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food").Index("Category")))
+		equals(t, 5, len(result))
+
+		// writes are reflected in queries against the preloaded index
+		ok(t, store.Insert(100, &ItemTest{ID: 100, Name: "pear", Category: "food"}))
+		ok(t, store.UpdateMatching(&ItemTest{}, badgerhold.Where("Name").Eq("seal"), func(record interface{}) error {
+			record.(*ItemTest).Category = "food"
+			return nil
+		}))
+		ok(t, store.Delete(4, &ItemTest{}))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("food", "animal").Index("Category")))
+		equals(t, 12, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food").Index("Category")))
+		equals(t, 6, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("animal").Index("Category")))
+		equals(t, 6, len(result))
+
+		// preloading again picks up the writes
+		ok(t, store.PreloadIndex(&ItemTest{}, "Category"))
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food").Index("Category")))
+		equals(t, 6, len(result))
+	})
+}
+
+func TestFindSubsetSuperset(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type User struct {
+			Name  string
+			Roles []string `badgerholdIndex:"Roles"`
+		}
+
+		ok(t, store.Insert(1, &User{Name: "admin", Roles: []string{"admin", "editor", "viewer"}}))
+		ok(t, store.Insert(2, &User{Name: "editor", Roles: []string{"editor"}}))
+		ok(t, store.Insert(3, &User{Name: "viewer", Roles: []string{"viewer"}}))
+		ok(t, store.Insert(4, &User{Name: "none", Roles: []string{}}))
+		ok(t, store.Insert(5, &User{Name: "both", Roles: []string{"admin", "editor"}}))
+
+		names := func(query *badgerhold.Query) []string {
+			var result []User
+			ok(t, store.Find(&result, query))
+			found := []string{}
+			for i := range result {
+				found = append(found, result[i].Name)
+			}
+			return found
+		}
+
+		equals(t, []string{"editor", "none", "both"}, names(badgerhold.Where("Roles").SubsetOf("admin", "editor")))
+		equals(t, []string{"editor", "none", "both"},
+			names(badgerhold.Where("Roles").SubsetOf("admin", "editor").Index("Roles")))
+		equals(t, []string{"none"}, names(badgerhold.Where("Roles").SubsetOf()))
+		equals(t, []string{"admin", "viewer"}, names(badgerhold.Where("Roles").SupersetOf("viewer")))
+		equals(t, []string{"admin", "both"}, names(badgerhold.Where("Roles").SupersetOf("editor", "admin")))
+		equals(t, []string{"admin", "editor", "viewer", "none", "both"}, names(badgerhold.Where("Roles").SupersetOf()))
+	})
+}
+
+func TestFindAutoIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Order struct {
+			ID       int    `badgerhold:"key"`
+			Status   string `badgerhold:"index"`
+			Customer string `badgerhold:"index"`
+		}
+
+		for i := 0; i < 200; i++ {
+			status := "done"
+			if i%50 == 0 {
+				status = "open"
+			}
+			ok(t, store.Insert(i, &Order{Status: status, Customer: fmt.Sprintf("c%d", i%20)}))
+		}
+
+		queries := []func() *badgerhold.Query{
+			func() *badgerhold.Query {
+				return badgerhold.Where("Status").Eq("done").And("Customer").Eq("c3")
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Status").Eq("open").And("Customer").In("c0", "c10")
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Status").Eq("done").And("Customer").Gt("c3").Index("Customer")
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Status").Eq("missing").And("Customer").Eq("c3").SortBy("ID")
+			},
+		}
+
+		for i := range queries {
+			var expected []Order
+			ok(t, store.Find(&expected, queries[i]().NoIndex()))
+
+			var result []Order
+			ok(t, store.Find(&result, queries[i]().AutoIndex().SortBy("ID")))
+			equals(t, len(expected), len(result))
+			if len(expected) > 0 {
+				equals(t, expected, result)
+			}
+
+			count, err := store.Count(&Order{}, queries[i]().AutoIndex())
+			ok(t, err)
+			equals(t, uint64(len(expected)), count)
+		}
+
+		// the index is picked for each run, so a shared query picks it for the values it's run with
+		status := "open"
+		shared := badgerhold.Where("Status").Eq(badgerhold.ValueFunc(func() interface{} {
+			return status
+		})).And("Customer").Eq("c0").AutoIndex()
+
+		errs := make(chan error, 10)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				count, err := store.Count(&Order{}, shared)
+				if err == nil && count != 2 {
+					err = fmt.Errorf("Count returned %d records, expected 2", count)
+				}
+				errs <- err
+			}()
+		}
+		for i := 0; i < cap(errs); i++ {
+			ok(t, <-errs)
+		}
+
+		status = "done"
+		count, err := store.Count(&Order{}, shared)
+		ok(t, err)
+		equals(t, uint64(8), count)
+	})
+}
+
+func TestFindDecodeWorkers(t *testing.T) {
+	opt := testOptions()
+	opt.DecodeWorkers = 4
+	testWrapWithOpt(t, opt, func(workerStore *badgerhold.Store, t *testing.T) {
+		testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+			insertTestData(t, store)
+			insertTestData(t, workerStore)
+			for i := 0; i < 200; i++ {
+				item := &ItemTest{ID: 100 + i, Name: fmt.Sprintf("generated %d", i), Category: "generated"}
+				ok(t, store.Insert(100+i, item))
+				ok(t, workerStore.Insert(100+i, item))
+			}
+
+			for _, tst := range testResults {
+				t.Run(tst.name, func(t *testing.T) {
+					var expected []ItemTest
+					ok(t, store.Find(&expected, tst.query))
+
+					var result []ItemTest
+					ok(t, workerStore.Find(&result, tst.query))
+					equals(t, expected, result)
+				})
+			}
+
+			queries := []*badgerhold.Query{
+				badgerhold.Where("Category").Eq("generated").Skip(30).Limit(50),
+				badgerhold.Where(badgerhold.Key).Ge(150).Limit(7),
+				badgerhold.Where("Name").RegExp(regexp.MustCompile("9$")).Or(badgerhold.Where("Category").Eq("food")),
+			}
+			for i := range queries {
+				var expected []ItemTest
+				ok(t, store.Find(&expected, queries[i]))
+
+				var result []ItemTest
+				ok(t, workerStore.Find(&result, queries[i]))
+				equals(t, expected, result)
+			}
+		})
+	})
+}
+
+func TestFindExcept(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		expectedFor := func(include func(item *ItemTest) bool) []ItemTest {
+			var expected []ItemTest
+			for i := range testData {
+				if include(&testData[i]) {
+					expected = append(expected, testData[i])
+				}
+			}
+			return expected
+		}
+
+		var result []ItemTest
+		ok(t, store.FindExcept(&result, badgerhold.Where("Category").Eq("animal"),
+			badgerhold.Where("Name").In("fish", "crow").Or(badgerhold.Where(badgerhold.Key).Eq(testData[2].Key))))
+		expected := expectedFor(func(item *ItemTest) bool {
+			return item.Category == "animal" && item.Name != "fish" && item.Name != "crow" && item.Key != testData[2].Key
+		})
+		equals(t, len(expected), len(result))
+		for i := range result {
+			assert(t, result[i].Category == "animal" && result[i].Name != "fish" && result[i].Name != "crow",
+				fmt.Sprintf("%v should have been excluded", result[i]))
+		}
+
+		// skip and limit apply after records are excluded, and the exclude index is ignored
+		result = nil
+		ok(t, store.FindExcept(&result, badgerhold.Where("Category").Eq("animal").Index("Category").
+			SortBy("Name").Skip(1).Limit(2), badgerhold.Where("Category").Eq("animal").Index("Category").
+			And("Name").Eq("bear")))
+		equals(t, 2, len(result))
+		equals(t, "fish", result[0].Name)
+		equals(t, "lion", result[1].Name)
+
+		result = nil
+		ok(t, store.FindExcept(&result, nil, nil))
+		equals(t, len(testData), len(result))
+	})
+}
+
+func TestFindKeyLookup(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		for i := range testData {
+			var lookup, scan []ItemTest
+			ok(t, store.Find(&lookup, badgerhold.Where(badgerhold.Key).Eq(testData[i].Key)))
+			ok(t, store.Find(&scan, badgerhold.Where(badgerhold.Key).Eq(testData[i].Key).And("Name").
+				Eq(testData[i].Name)))
+			equals(t, 1, len(lookup))
+			equals(t, scan, lookup)
+
+			var one ItemTest
+			ok(t, store.FindOne(&one, badgerhold.Where(badgerhold.Key).Eq(testData[i].Key)))
+			equals(t, testData[i].Key, one.Key)
+		}
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where(badgerhold.Key).Eq(10000)))
+		equals(t, 0, len(result))
+
+		ok(t, store.Find(&result, badgerhold.Where(badgerhold.Key).Eq(testData[0].Key).Skip(1)))
+		equals(t, 0, len(result))
+
+		var one ItemTest
+		equals(t, badgerhold.ErrNotFound, store.FindOne(&one, badgerhold.Where(badgerhold.Key).Eq(10000)))
+
+		count, err := store.Count(&ItemTest{}, badgerhold.Where(badgerhold.Key).Eq(testData[3].Key))
+		ok(t, err)
+		equals(t, uint64(1), count)
+	})
+}
+
+func TestFindMaxResults(t *testing.T) {
+	opt := testOptions()
+	opt.MaxFindResults = 5
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food")))
+		equals(t, 5, len(result))
+
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result, badgerhold.Where("Category").Eq("animal")))
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result,
+			badgerhold.Where("Category").Eq("animal").Index("Category")))
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result,
+			badgerhold.Where("Category").Eq("animal").Index("Category").SortBy("Name")))
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result, nil))
+
+		// sorted results stop being read as soon as more records match than can be returned
+		read := 0
+		counted := func(ra *badgerhold.RecordAccess) (bool, error) {
+			read++
+			return true, nil
+		}
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result,
+			badgerhold.Where("Name").MatchFunc(counted).SortBy("Category")))
+		equals(t, 6, read)
+
+		read = 0
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result,
+			badgerhold.Where("Name").MatchFunc(counted).SortBy("Category").Skip(2)))
+		equals(t, 8, read)
+
+		// limit is applied before the maximum is checked
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("animal").SortBy("Name").Limit(5)))
+		equals(t, 5, len(result))
+
+		// the query maximum overrides the option
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("animal").MaxResults(7)))
+		equals(t, 7, len(result))
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result,
+			badgerhold.Where("Category").Eq("animal").Index("Category").MaxResults(6)))
+	})
+}
+
+type BucketedEvent struct {
+	ID      int       `badgerhold:"key"`
+	Created time.Time `badgerholdIndex:"CreatedHour;bucket=1h"`
+}
+
+func TestFindBucketedIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 3*24*6; i++ {
+			// every 10 minutes for 3 days, in a zone other than UTC
+			ok(t, store.Insert(i, &BucketedEvent{
+				ID:      i,
+				Created: start.Add(time.Duration(i) * 10 * time.Minute).In(time.FixedZone("test", -5*60*60)),
+			}))
+		}
+
+		day := start.Add(24 * time.Hour)
+		for _, query := range []func() *badgerhold.Query{
+			func() *badgerhold.Query {
+				return badgerhold.Where("Created").Ge(day).And("Created").Lt(day.Add(24 * time.Hour))
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where("Created").Gt(day.Add(25 * time.Minute)).And("Created").
+					Le(day.Add(3 * time.Hour))
+			},
+			func() *badgerhold.Query { return badgerhold.Where("Created").Gt(day.Add(47*time.Hour + 5*time.Minute)) },
+			func() *badgerhold.Query { return badgerhold.Where("Created").Lt(start.Add(15 * time.Minute)) },
+			func() *badgerhold.Query { return badgerhold.Where("Created").Eq(day.Add(20 * time.Minute)) },
+			func() *badgerhold.Query {
+				return badgerhold.Where("Created").In(day.Add(20*time.Minute), day.Add(30*time.Minute),
+					day.Add(5*time.Hour))
+			},
+			func() *badgerhold.Query { return badgerhold.Where("Created").Ne(day) },
+			// the other records in the bucket aren't counted by the skip
+			func() *badgerhold.Query { return badgerhold.Where("Created").Eq(day.Add(20 * time.Minute)).Skip(1) },
+			func() *badgerhold.Query {
+				return badgerhold.Where("Created").In(day.Add(20*time.Minute), day.Add(5*time.Hour)).Skip(1)
+			},
+		} {
+			var expected []BucketedEvent
+			ok(t, store.Find(&expected, query().NoIndex()))
+
+			var result []BucketedEvent
+			ok(t, store.Find(&result, query().Index("Created")))
+			equals(t, len(expected), len(result))
+			for i := range expected {
+				equals(t, expected[i].ID, result[i].ID)
+			}
+		}
+
+		count, err := store.Count(&BucketedEvent{}, badgerhold.Where("Created").Ge(day).
+			And("Created").Lt(day.Add(24*time.Hour)).Index("Created"))
+		ok(t, err)
+		equals(t, uint64(24*6), count)
+
+		// records leave their bucket when they're updated
+		ok(t, store.Update(0, &BucketedEvent{ID: 0, Created: day.Add(72 * time.Hour)}))
+		var result []BucketedEvent
+		ok(t, store.Find(&result, badgerhold.Where("Created").Lt(start.Add(time.Hour)).Index("Created")))
+		equals(t, 5, len(result))
+	})
+}
+
+func TestWhereMap(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query, err := badgerhold.WhereMap(map[string]interface{}{
+			"Category": "animal",
+			"Name":     "fox",
+		})
+		ok(t, err)
+
+		var result, expected []ItemTest
+		ok(t, store.Find(&result, query))
+		ok(t, store.Find(&expected, badgerhold.Where("Category").Eq("animal").And("Name").Eq("fox")))
+		equals(t, expected, result)
+
+		query, err = badgerhold.WhereMap(map[string]interface{}{})
+		ok(t, err)
+		result = nil
+		ok(t, store.Find(&result, query))
+		equals(t, len(testData), len(result))
+
+		_, err = badgerhold.WhereMap(map[string]interface{}{"Category": "animal", "name": "fox"})
+		assert(t, err != nil, "WhereMap with a lower-case field did not return an error")
+	})
+}
+
+func TestAndWhere(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		query, err := (&badgerhold.Query{}).AndWhere("Category", "in", "animal", "food")
+		ok(t, err)
+		query, err = query.AndWhere("Name", "hasPrefix", "f")
+		ok(t, err)
+
+		var result, expected []ItemTest
+		ok(t, store.Find(&result, query))
+		ok(t, store.Find(&expected, badgerhold.Where("Category").In("animal", "food").And("Name").HasPrefix("f")))
+		assert(t, len(result) > 0, "AndWhere returned no records")
+		equals(t, expected, result)
+
+		type LineItem struct {
+			SKU string
+		}
+		type Order struct {
+			Items []LineItem
+		}
+		ok(t, store.Insert(1, &Order{Items: []LineItem{{"A"}, {"B"}}}))
+		ok(t, store.Insert(2, &Order{Items: []LineItem{{"C"}}}))
+
+		query, err = (&badgerhold.Query{}).AndWhere("Items", "containsMatch", badgerhold.Where("SKU").Eq("B"))
+		ok(t, err)
+		var orders []Order
+		ok(t, store.Find(&orders, query))
+		equals(t, 1, len(orders))
+		equals(t, "A", orders[0].Items[0].SKU)
+
+		for _, bad := range []struct {
+			field, op string
+			values    []interface{}
+		}{
+			{"name", "eq", []interface{}{"fox"}},
+			{"Name", "matches", []interface{}{"fox"}},
+			{"Name", "eq", nil},
+			{"Name", "isNil", []interface{}{"fox"}},
+			{"Name", "hasPrefix", []interface{}{1}},
+			{"Created", "hourBetween", []interface{}{9, 25}},
+			{"Created", "weekday", []interface{}{"Monday"}},
+			{"Category", "in", nil},
+			{"Created", "month", nil},
+			{"Tags", "containsAll", nil},
+			{"Items", "containsMatch", []interface{}{"fox"}},
+		} {
+			_, err = badgerhold.Where("Category").Eq("animal").AndWhere(bad.field, bad.op, bad.values...)
+			assert(t, err != nil, "AndWhere with "+bad.field+" "+bad.op+" did not return an error")
+		}
+	})
+}
+
+func TestFindEqFunc(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		equalFold := func(a, b interface{}) bool {
+			return strings.EqualFold(a.(string), b.(string))
+		}
+
+		for field, value := range map[string]string{"Name": "pizza", "Category": "animal"} {
+			var result, expected []ItemTest
+			ok(t, store.Find(&result, badgerhold.Where(field).EqFunc(strings.ToUpper(value), equalFold)))
+			ok(t, store.Find(&expected, badgerhold.Where(field).Eq(value)))
+			assert(t, len(expected) > 0, "No records matched "+field)
+			equals(t, expected, result)
+		}
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where(badgerhold.Key).EqFunc(3, func(a, b interface{}) bool {
+			return a.(int)%b.(int) == 0
+		})))
+		for i := range result {
+			assert(t, result[i].Key%3 == 0, "Key was not a multiple of 3")
+		}
+		assert(t, len(result) > 0, "No keys matched")
+	})
+}
+
+func TestFindCoveringIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, badgerhold.Where("Category").In("animal", "food").Index("Category")))
+		assert(t, len(expected) > 0, "No records matched")
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("animal", "food").Index("Category").
+			Fields("Category")))
+		// records are returned in index order
+		categories := make(map[string]int)
+		for i := range expected {
+			categories[expected[i].Category]++
+		}
+		for i := range result {
+			categories[result[i].Category]--
+			equals(t, "", result[i].Name)
+		}
+		equals(t, map[string]int{"animal": 0, "food": 0}, categories)
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("animal", "food").Index("Category").
+			Fields("Category").SortBy("Category").Reverse()))
+		equals(t, len(expected), len(result))
+		equals(t, "food", result[0].Category)
+		equals(t, "", result[0].Name)
+
+		// fields that aren't in the index return entire records
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("animal", "food").Index("Category").
+			Fields("Category", "Name")))
+		equals(t, len(expected), len(result))
+		for i := range result {
+			assert(t, result[i].Name != "", "A field not in the index did not return entire records")
+		}
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("animal", "food").Index("Category").
+			Fields("Category").SortBy("Name")))
+		for i := range result {
+			assert(t, result[i].Name != "", "Sorting by a field not in the index did not return entire records")
+		}
+
+		count, err := store.Count(&ItemTest{}, badgerhold.Where("Category").Eq("food").Index("Category").
+			Fields("Category"))
+		ok(t, err)
+		expectedCount, err := store.Count(&ItemTest{}, badgerhold.Where("Category").Eq("food"))
+		ok(t, err)
+		equals(t, expectedCount, count)
+	})
+}
+
+func TestFindContainsMatch(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type LineItem struct {
+			SKU      string
+			Quantity int
+		}
+		type Order struct {
+			Items []LineItem
+			Gifts []*LineItem
+		}
+
+		ok(t, store.Insert(1, &Order{Items: []LineItem{{"A", 1}, {"B", 3}}}))
+		ok(t, store.Insert(2, &Order{Items: []LineItem{{"B", 1}}, Gifts: []*LineItem{{"C", 1}}}))
+		ok(t, store.Insert(3, &Order{}))
+
+		count, err := store.Count(&Order{}, badgerhold.Where("Items").ContainsMatch(badgerhold.Where("SKU").Eq("B")))
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		var result []Order
+		ok(t, store.Find(&result, badgerhold.Where("Items").ContainsMatch(
+			badgerhold.Where("SKU").Eq("B").And("Quantity").Gt(1))))
+		equals(t, 1, len(result))
+		equals(t, "A", result[0].Items[0].SKU)
+
+		count, err = store.Count(&Order{}, badgerhold.Where("Gifts").ContainsMatch(badgerhold.Where("SKU").Eq("C")))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Order{}, badgerhold.Where("Items").ContainsMatch(
+			badgerhold.Where("SKU").Eq("X").Or(badgerhold.Where("Quantity").Ge(3))))
+		ok(t, err)
+		equals(t, uint64(1), count)
+	})
+}
+
+func TestFindQueryCache(t *testing.T) {
+	opt := testOptions()
+	opt.QueryCache = 2
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		animals := func() *badgerhold.Query { return badgerhold.Where("Category").Eq("animal") }
+		food := func() *badgerhold.Query { return badgerhold.Where("Category").Eq("food") }
+		vehicles := func() *badgerhold.Query { return badgerhold.Where("Category").Eq("vehicle") }
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, animals()))
+		var result []ItemTest
+		ok(t, store.Find(&result, food()))
+
+		// writes made directly to badger aren't seen by cached queries
+		ok(t, store.Badger().DropPrefix([]byte("bh_ItemTest:")))
+
+		result = []ItemTest{{Name: "existing"}}
+		ok(t, store.Find(&result, animals()))
+		equals(t, append([]ItemTest{{Name: "existing"}}, expected...), result)
+
+		result = nil
+		ok(t, store.Find(&result, animals().And("Name").MatchFunc(func(ra *badgerhold.RecordAccess) (bool, error) {
+			return true, nil
+		})))
+		equals(t, 0, len(result))
+
+		// the least recently used query is evicted
+		result = nil
+		ok(t, store.Find(&result, vehicles()))
+		equals(t, 0, len(result))
+		result = nil
+		ok(t, store.Find(&result, animals()))
+		equals(t, len(expected), len(result))
+		result = nil
+		ok(t, store.Find(&result, food()))
+		equals(t, 0, len(result))
+
+		// writes through the store drop the cached results
+		ok(t, store.Insert(100, &ItemTest{Name: "cat", Category: "animal"}))
+		result = nil
+		ok(t, store.Find(&result, animals()))
+		equals(t, []ItemTest{{Name: "cat", Category: "animal"}}, result)
+	})
+}
+
+func TestFindOrIndexUnion(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		union := func() *badgerhold.Query {
+			return badgerhold.Where("Category").Eq("vehicle").Or(badgerhold.Where("Category").Eq("animal")).
+				Or(badgerhold.Where("Category").Eq("vehicle"))
+		}
+		// the NoIndex or'd query runs as a scan, as it normally would
+		scan := func() *badgerhold.Query {
+			return badgerhold.Where("Category").Eq("vehicle").Or(badgerhold.Where("Category").Eq("animal").NoIndex())
+		}
+
+		var expected, result []ItemTest
+		ok(t, store.Find(&expected, scan()))
+		ok(t, store.Find(&result, union()))
+		equals(t, 12, len(result))
+		equals(t, expected, result)
+
+		count, err := store.Count(&ItemTest{}, union().Index("Category"))
+		ok(t, err)
+		equals(t, uint64(12), count)
+	})
+}
+
+func TestFindReverseWithoutSort(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		reversed := func(items []ItemTest) []ItemTest {
+			result := make([]ItemTest, len(items))
+			for i := range items {
+				result[len(items)-1-i] = items[i]
+			}
+			return result
+		}
+
+		for _, query := range []func() *badgerhold.Query{
+			func() *badgerhold.Query { return badgerhold.Where(badgerhold.Key).Gt(testData[3].Key) },
+			func() *badgerhold.Query { return badgerhold.Where("Category").Ge("animal").Index("Category") },
+			func() *badgerhold.Query { return badgerhold.Where("Category").Eq("food").Index("Category") },
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").In("food", "animal").Index("Category")
+			},
+		} {
+			var forward, result []ItemTest
+			ok(t, store.Find(&forward, query()))
+			ok(t, store.Find(&result, query().Reverse()))
+			assert(t, len(forward) > 1, "query returned too few records to test the order")
+			equals(t, reversed(forward), result)
+
+			result = nil
+			ok(t, store.Find(&result, query().Reverse().Skip(1).Limit(3)))
+			equals(t, reversed(forward)[1:4], result)
+
+			// a read-write transaction can only have one iterator open at a time
+			result = nil
+			ok(t, store.Badger().Update(func(tx *badger.Txn) error {
+				return store.TxFind(tx, &result, query().Reverse())
+			}))
+			equals(t, reversed(forward), result)
+		}
+
+		// or'd queries are reversed as a whole
+		var forward, result []ItemTest
+		ok(t, store.Find(&forward, badgerhold.Where("Category").In("food", "vehicle")))
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food").
+			Or(badgerhold.Where("Category").Eq("vehicle")).Reverse()))
+		equals(t, reversed(forward), result)
+	})
+}
+
+func TestFindInStream(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		stream := func(values ...interface{}) func() (interface{}, bool) {
+			return func() (interface{}, bool) {
+				if len(values) == 0 {
+					return nil, false
+				}
+				value := values[0]
+				values = values[1:]
+				return value, true
+			}
+		}
+
+		keys := []interface{}{testData[4].Key, testData[1].Key, 10000, testData[4].Key}
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where(badgerhold.Key).InStream(stream(keys...))))
+		equals(t, 2, len(result))
+		equals(t, testData[4].Key, result[0].Key)
+		equals(t, testData[1].Key, result[1].Key)
+
+		var expected []ItemTest
+		ok(t, store.Find(&expected, badgerhold.Where("Category").In("food", "vehicle").And("Name").Ne("pizza").
+			SortBy("Name")))
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").InStream(stream("food", "vehicle", "food")).
+			And("Name").Ne("pizza").SortBy("Name").Index("Category")))
+		equals(t, expected, result)
+
+		// the index is picked automatically
+		count, err := store.Count(&ItemTest{}, badgerhold.Where("Category").InStream(stream("animal")).AutoIndex())
+		ok(t, err)
+		animals, err := store.Count(&ItemTest{}, badgerhold.Where("Category").Eq("animal"))
+		ok(t, err)
+		equals(t, animals, count)
+
+		// the values are only read once
+		query := badgerhold.Where("Category").InStream(stream("animal")).Index("Category")
+		result = nil
+		ok(t, store.Find(&result, query))
+		equals(t, int(animals), len(result))
+		result = nil
+		ok(t, store.Find(&result, query))
+		equals(t, 0, len(result))
+
+		err = store.Find(&result, badgerhold.Where("Name").InStream(stream("fox")))
+		assert(t, err != nil, "InStream on a field that isn't indexed did not return an error")
+	})
+}
+
+func TestFindFormats(t *testing.T) {
+	for _, tst := range []struct {
+		format  *regexp.Regexp
+		valid   []string
+		invalid []string
+	}{
+		{
+			format:  badgerhold.FormatEmail,
+			valid:   []string{"john@example.com", "first.last+tag@sub.example.co.uk", "a@b"},
+			invalid: []string{"", "john", "john@", "@example.com", "john@example..com", "john doe@example.com"},
+		},
+		{
+			format:  badgerhold.FormatUUID,
+			valid:   []string{"123e4567-e89b-12d3-a456-426614174000", "123E4567-E89B-12D3-A456-426614174000"},
+			invalid: []string{"", "123e4567e89b12d3a456426614174000", "123e4567-e89b-12d3-a456-42661417400g"},
+		},
+		{
+			format:  badgerhold.FormatURL,
+			valid:   []string{"http://example.com", "HTTPS://example.com/path?q=1#frag", "https://localhost:8080"},
+			invalid: []string{"", "example.com", "ftp://example.com", "http://", "http:///path", "http://exa mple.com"},
+		},
+	} {
+		for _, value := range tst.valid {
+			assert(t, tst.format.MatchString(value), fmt.Sprintf("%s did not match %q", tst.format, value))
+		}
+		for _, value := range tst.invalid {
+			assert(t, !tst.format.MatchString(value), fmt.Sprintf("%s matched %q", tst.format, value))
+		}
+	}
+
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		ok(t, store.Insert(1, &ItemTest{Name: "john@example.com"}))
+		ok(t, store.Insert(2, &ItemTest{Name: "john"}))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Name").RegExp(badgerhold.FormatEmail)))
+		equals(t, 1, len(result))
+		equals(t, "john@example.com", result[0].Name)
+	})
+}
+
+func TestFindStreamReads(t *testing.T) {
+	opt := testOptions()
+	opt.StreamReads = true
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		byKey := func(items []ItemTest) []ItemTest {
+			sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+			return items
+		}
+
+		for _, query := range []func() *badgerhold.Query{
+			func() *badgerhold.Query { return nil },
+			func() *badgerhold.Query { return badgerhold.Where("Category").Eq("animal") },
+			func() *badgerhold.Query { return badgerhold.Where("Category").Eq("animal").Index("Category").NoIndex() },
+			func() *badgerhold.Query {
+				return badgerhold.Where("Name").Eq("fox").Or(badgerhold.Where("Category").Eq("vehicle"))
+			},
+			func() *badgerhold.Query { return badgerhold.Where(badgerhold.Key).Gt(10) },
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").MatchFunc(func(ra *badgerhold.RecordAccess) (bool, error) {
+					var matches []ItemTest
+					err := ra.SubQuery(&matches, badgerhold.Where("Name").Eq(ra.Record().(*ItemTest).Name))
+					return len(matches) > 1, err
+				})
+			},
+		} {
+			// the Tx variants always read in a transaction
+			var expected []ItemTest
+			ok(t, store.Badger().View(func(tx *badger.Txn) error {
+				return store.TxFind(tx, &expected, query())
+			}))
+
+			var result []ItemTest
+			ok(t, store.Find(&result, query()))
+			equals(t, byKey(expected), byKey(result))
+
+			result = nil
+			ok(t, store.ForEach(query(), func(record *ItemTest) error {
+				result = append(result, *record)
+				return nil
+			}))
+			equals(t, byKey(expected), byKey(result))
+		}
+
+		// errors from the query stop the stream
+		var result []ItemTest
+		equals(t, badgerhold.ErrResultTooLarge, store.Find(&result, badgerhold.Where("Category").Eq("animal").
+			MaxResults(2)))
+
+		stop := errors.New("stop")
+		equals(t, stop, store.ForEach(nil, func(record *ItemTest) error {
+			return stop
+		}))
+	})
+}
+
+func TestFindSizeGt(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Blob struct {
+			Kind string `badgerhold:"index"`
+			Data string
+		}
+
+		for i := 0; i < 10; i++ {
+			size := 10
+			if i%4 == 0 {
+				size = 10000
+			}
+			ok(t, store.Insert(i, &Blob{Kind: fmt.Sprintf("kind%d", i%2), Data: strings.Repeat("x", size)}))
+		}
+
+		var result []Blob
+		ok(t, store.Find(&result, (&badgerhold.Query{}).SizeGt(1000)))
+		equals(t, 3, len(result))
+		for i := range result {
+			equals(t, 10000, len(result[i].Data))
+		}
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Kind").Eq("kind0").Index("Kind").SizeGt(1000)))
+		equals(t, 3, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, (&badgerhold.Query{}).SortBy("Kind").SizeGt(1000).Limit(2)))
+		equals(t, 2, len(result))
+		equals(t, 10000, len(result[1].Data))
+
+		count, err := store.Count(&Blob{}, badgerhold.Where(badgerhold.Key).Eq(4).SizeGt(1000))
+		ok(t, err)
+		equals(t, uint64(1), count)
+
+		count, err = store.Count(&Blob{}, badgerhold.Where(badgerhold.Key).Eq(5).SizeGt(1000))
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		count, err = store.Count(&Blob{}, (&badgerhold.Query{}).SizeGt(100000))
+		ok(t, err)
+		equals(t, uint64(0), count)
+	})
+}
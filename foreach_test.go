@@ -5,6 +5,7 @@
 package badgerhold_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -50,6 +51,64 @@ func TestForEach(t *testing.T) {
 	})
 }
 
+func TestForEachSkipLimit(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var all []ItemTest
+		ok(t, store.Find(&all, badgerhold.Where("Category").Eq("food").SortBy("Name")))
+
+		for _, tst := range []struct {
+			name        string
+			skip, limit int
+		}{
+			{"Limit", 0, 2},
+			{"Skip", 2, 0},
+			{"SkipAndLimit", 1, 2},
+			{"LimitPastEnd", 3, 10},
+			{"SkipPastEnd", 10, 2},
+		} {
+			t.Run(tst.name, func(t *testing.T) {
+				query := badgerhold.Where("Category").Eq("food").SortBy("Name")
+				if tst.skip > 0 {
+					query.Skip(tst.skip)
+				}
+				if tst.limit > 0 {
+					query.Limit(tst.limit)
+				}
+
+				want := []string{}
+				for i := tst.skip; i < len(all) && (tst.limit == 0 || i < tst.skip+tst.limit); i++ {
+					want = append(want, all[i].Name)
+				}
+
+				got := []string{}
+				ok(t, store.ForEach(query, func(record *ItemTest) error {
+					got = append(got, record.Name)
+					return nil
+				}))
+				equals(t, want, got)
+
+				// without a sort the records come from the index as they're read
+				query = badgerhold.Where("Category").Eq("food").Index("Category")
+				if tst.skip > 0 {
+					query.Skip(tst.skip)
+				}
+				if tst.limit > 0 {
+					query.Limit(tst.limit)
+				}
+
+				count := 0
+				ok(t, store.ForEach(query, func(record *ItemTest) error {
+					count++
+					return nil
+				}))
+				equals(t, len(want), count)
+			})
+		}
+	})
+}
+
 func TestIssue105ForEachKeys(t *testing.T) {
 
 	type Person struct {
@@ -81,3 +140,422 @@ func TestIssue105ForEachKeys(t *testing.T) {
 		}))
 	})
 }
+
+func TestFindLazy(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+		for _, tst := range testResults {
+			t.Run(tst.name, func(t *testing.T) {
+				count := 0
+				err := store.FindLazy(&ItemTest{}, tst.query, func(record *badgerhold.LazyRecord) error {
+					count++
+
+					var key int
+					ok(t, record.Key(&key))
+
+					item := &ItemTest{}
+					ok(t, record.Decode(item))
+
+					if !item.equal(&testData[key]) {
+						return fmt.Errorf("%v decoded for key %d, expected %v", item, key, testData[key])
+					}
+					return nil
+				})
+				ok(t, err)
+				equals(t, len(tst.result), count)
+			})
+		}
+	})
+}
+
+func TestFindLazyKeyField(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type KeyTest struct {
+			Key   int `badgerholdKey:"Key"`
+			Value string
+		}
+
+		ok(t, store.Insert(3, &KeyTest{Value: "test value"}))
+
+		err := store.FindLazy(&KeyTest{}, nil, func(record *badgerhold.LazyRecord) error {
+			result := &KeyTest{}
+			ok(t, record.Decode(result))
+			equals(t, &KeyTest{Key: 3, Value: "test value"}, result)
+			return nil
+		})
+		ok(t, err)
+	})
+}
+
+func TestForEachInOrder(t *testing.T) {
+	opt := testOptions()
+	opt.TrackInsertionOrder = true
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		type Event struct {
+			ID       string `badgerhold:"key"`
+			Category string
+		}
+
+		ids := []string{"m", "c", "x", "a", "q", "f"}
+		for i := range ids {
+			category := "odd"
+			if i%2 == 0 {
+				category = "even"
+			}
+			ok(t, store.Insert(ids[i], &Event{Category: category}))
+		}
+		ok(t, store.Upsert("z", &Event{Category: "even"}))
+		ok(t, store.Upsert("m", &Event{Category: "even"}))
+		ok(t, store.Delete("x", &Event{}))
+		ok(t, store.DeleteMatching(&Event{}, badgerhold.Where(badgerhold.Key).Eq("a")))
+		ok(t, store.Insert("x", &Event{Category: "even"}))
+
+		inOrder := func(query *badgerhold.Query) []string {
+			var result []string
+			ok(t, store.ForEachInOrder(query, func(record *Event) error {
+				result = append(result, record.ID)
+				return nil
+			}))
+			return result
+		}
+
+		equals(t, []string{"m", "c", "q", "f", "z", "x"}, inOrder(nil))
+		equals(t, []string{"m", "q", "z", "x"}, inOrder(badgerhold.Where("Category").Eq("even")))
+		equals(t, []string{"q", "z"}, inOrder(badgerhold.Where("Category").Eq("even").Skip(1).Limit(2)))
+	})
+
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		equals(t, badgerhold.ErrInsertionOrderNotTracked, store.ForEachInOrder(nil, func(record *ItemTest) error {
+			return nil
+		}))
+	})
+}
+
+func TestFindStream(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var expected []ItemTest
+		query := func() *badgerhold.Query {
+			return badgerhold.Where("Category").Eq("animal").SortBy("Name").Skip(1)
+		}
+		ok(t, store.Find(&expected, query()))
+
+		stream, err := store.FindStream(&ItemTest{}, query(), 2)
+		ok(t, err)
+
+		var result []ItemTest
+		for stream.Next() {
+			var item ItemTest
+			ok(t, stream.Scan(&item))
+			result = append(result, item)
+		}
+		ok(t, stream.Err())
+		ok(t, stream.Close())
+		equals(t, expected, result)
+
+		// closing early stops the query
+		stream, err = store.FindStream(&ItemTest{}, nil, 0)
+		ok(t, err)
+		assert(t, stream.Next(), "Stream has no records")
+		ok(t, stream.Close())
+		assert(t, !stream.Next(), "Closed stream returned a record")
+		assert(t, stream.Scan(&ItemTest{}) != nil, "Scan on a closed stream didn't fail")
+
+		// key fields are set
+		type KeyedItem struct {
+			Key  string `badgerhold:"key"`
+			Name string
+		}
+		ok(t, store.Insert("one", &KeyedItem{Name: "first"}))
+		stream, err = store.FindStream(&KeyedItem{}, nil, 10)
+		ok(t, err)
+		defer stream.Close()
+		assert(t, stream.Next(), "Stream has no records")
+		var keyed KeyedItem
+		ok(t, stream.Scan(&keyed))
+		equals(t, KeyedItem{Key: "one", Name: "first"}, keyed)
+
+		// query errors are returned from Err
+		stream, err = store.FindStream(&ItemTest{}, badgerhold.Where("Name").Eq("x").Index("Missing"), 0)
+		ok(t, err)
+		assert(t, !stream.Next(), "Stream with a bad index returned a record")
+		assert(t, stream.Err() != nil, "Stream with a bad index didn't return an error")
+		assert(t, stream.Close() != nil, "Stream with a bad index didn't return an error on close")
+	})
+}
+
+func TestIterate(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var expected []ItemTest
+		query := func() *badgerhold.Query {
+			return badgerhold.Where("Category").Eq("animal").SortBy("Name")
+		}
+		ok(t, store.Find(&expected, query()))
+
+		records, err := badgerhold.Iterate[ItemTest](store, query())
+		ok(t, err)
+		var result []ItemTest
+		for item, found := records.Next(); found; item, found = records.Next() {
+			result = append(result, item)
+		}
+		ok(t, records.Err())
+		ok(t, records.Close())
+		equals(t, expected, result)
+
+		// pointer types are allocated for each record
+		pointers, err := badgerhold.Iterate[*ItemTest](store, query())
+		ok(t, err)
+		defer pointers.Close()
+		for i := range expected {
+			item, found := pointers.Next()
+			assert(t, found, "Iterator ran out of records")
+			equals(t, expected[i], *item)
+		}
+		_, found := pointers.Next()
+		assert(t, !found, "Iterator returned too many records")
+		ok(t, pointers.Err())
+
+		// query errors are returned from Err
+		records, err = badgerhold.Iterate[ItemTest](store, badgerhold.Where("Name").Eq("x").Index("Missing"))
+		ok(t, err)
+		_, found = records.Next()
+		assert(t, !found, "Iterator with a bad index returned a record")
+		assert(t, records.Err() != nil, "Iterator with a bad index didn't return an error")
+		assert(t, records.Close() != nil, "Iterator with a bad index didn't return an error on close")
+	})
+}
+
+func TestCursor(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Row struct {
+			Key   int `badgerholdKey:"Key"`
+			Group int
+			Name  string
+		}
+		for i := 0; i < 20; i++ {
+			ok(t, store.Insert(i, &Row{Group: i % 3, Name: fmt.Sprintf("row %d", (i*7)%20)}))
+		}
+
+		query := func() *badgerhold.Query {
+			return badgerhold.Where("Group").Ne(1).SortBy("Name").Skip(1).Limit(5)
+		}
+		var expected []Row
+		ok(t, store.Find(&expected, query()))
+		equals(t, 5, len(expected))
+
+		cursor, err := store.Iterator(query(), &Row{})
+		ok(t, err)
+		var result []Row
+		for cursor.Next() {
+			var row Row
+			ok(t, cursor.Scan(&row))
+			equals(t, row.Key, cursor.Key())
+			result = append(result, row)
+		}
+		ok(t, cursor.Err())
+		ok(t, cursor.Close())
+		equals(t, expected, result)
+
+		// closing early stops the query
+		cursor, err = store.Iterator(nil, &Row{})
+		ok(t, err)
+		assert(t, cursor.Next(), "Cursor has no records")
+		ok(t, cursor.Close())
+		assert(t, !cursor.Next(), "Cursor returned a record after it was closed")
+		assert(t, cursor.Key() == nil, "Cursor returned a key after it was closed")
+
+		// keys of types without a key field can't be decoded
+		insertTestData(t, store)
+		cursor, err = store.Iterator(nil, &ItemTest{})
+		ok(t, err)
+		assert(t, cursor.Next(), "Cursor has no records")
+		var item ItemTest
+		ok(t, cursor.Scan(&item))
+		assert(t, item.Name != "", "Record wasn't decoded")
+		assert(t, cursor.Key() == nil, "Cursor decoded a key without a key field")
+		assert(t, !cursor.Next(), "Cursor continued after failing to decode a key")
+		assert(t, cursor.Err() != nil, "No error decoding a key without a key field")
+		assert(t, cursor.Close() != nil, "No error closing the cursor")
+	})
+}
+
+func TestForEachUpdate(t *testing.T) {
+	batched := testOptions()
+	batched.BatchSize = 2
+	for name, opt := range map[string]badgerhold.Options{"single": testOptions(), "batched": batched} {
+		t.Run(name, func(t *testing.T) {
+			testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+				insertTestData(t, store)
+
+				visited, skipped := 0, 0
+				ok(t, store.ForEachUpdate(&ItemTest{}, badgerhold.Where("Category").Eq("animal"),
+					func(record interface{}) (bool, error) {
+						item := record.(*ItemTest)
+						assert(t, item.Key != 0 || item.Name == testData[0].Name, "key field was not set")
+						visited++
+						if item.Name == "fox" || item.Name == "bear" {
+							skipped++
+							return false, nil
+						}
+						item.UpdateIndex = "migrated"
+						return true, nil
+					}))
+
+				animals, err := store.Count(&ItemTest{}, badgerhold.Where("Category").Eq("animal"))
+				ok(t, err)
+				equals(t, int(animals), visited)
+
+				var migrated []ItemTest
+				ok(t, store.Find(&migrated, badgerhold.Where("UpdateIndex").Eq("migrated").Index("UpdateIndex")))
+				assert(t, skipped > 0, "no records were left unchanged")
+				equals(t, int(animals)-skipped, len(migrated))
+				for i := range migrated {
+					assert(t, migrated[i].Name != "fox" && migrated[i].Name != "bear",
+						fmt.Sprintf("%s should not have been changed", migrated[i].Name))
+				}
+
+				var untouched []ItemTest
+				ok(t, store.Find(&untouched, badgerhold.Where("UpdateIndex").Eq("").Index("UpdateIndex")))
+				equals(t, len(testData)-len(migrated), len(untouched))
+			})
+		})
+	}
+
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		// an error discards the changes already made
+		fail := fmt.Errorf("stop")
+		equals(t, fail, store.ForEachUpdate(&ItemTest{}, nil, func(record interface{}) (bool, error) {
+			item := record.(*ItemTest)
+			if item.Key == testData[3].Key {
+				return false, fail
+			}
+			item.UpdateIndex = "migrated"
+			return true, nil
+		}))
+
+		count, err := store.Count(&ItemTest{}, badgerhold.Where("UpdateIndex").Eq("migrated").Index("UpdateIndex"))
+		ok(t, err)
+		equals(t, uint64(0), count)
+	})
+}
+
+func TestForEachPooled(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var free []*ItemTest
+		outstanding := make(map[*ItemTest]bool)
+		allocated := 0
+		newRecord := func() interface{} {
+			var item *ItemTest
+			if len(free) > 0 {
+				item, free = free[len(free)-1], free[:len(free)-1]
+			} else {
+				item = &ItemTest{}
+				allocated++
+			}
+			outstanding[item] = true
+			return item
+		}
+		release := func(record interface{}) {
+			item := record.(*ItemTest)
+			delete(outstanding, item)
+			free = append(free, item)
+		}
+
+		for _, tst := range testResults {
+			t.Run(tst.name, func(t *testing.T) {
+				count := 0
+				ok(t, store.ForEachPooled(tst.query, newRecord, release, func(record interface{}) error {
+					defer release(record)
+					count++
+
+					item := record.(*ItemTest)
+					for i := range tst.result {
+						if item.equal(&testData[tst.result[i]]) {
+							return nil
+						}
+					}
+					return fmt.Errorf("%v was not found in the result set!", item)
+				}))
+				equals(t, len(tst.result), count)
+				equals(t, 0, len(outstanding))
+			})
+		}
+
+		assert(t, allocated < len(testData), fmt.Sprintf("%d records were allocated for %d records", allocated,
+			len(testData)))
+
+		equals(t, "The newRecord func must return a pointer to a struct, not badgerhold_test.ItemTest",
+			store.ForEachPooled(nil, func() interface{} { return ItemTest{} }, release,
+				func(record interface{}) error { return nil }).Error())
+	})
+}
+
+func TestForEachIndexRange(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		bounds, err := store.IndexBoundaries(&ItemTest{}, "Category", 3)
+		ok(t, err)
+		assert(t, len(bounds) > 0 && len(bounds) <= 2, "Expected 1 or 2 boundaries, got %d", len(bounds))
+
+		// every record is in exactly one of the ranges
+		seen := make(map[int]int)
+		for i := 0; i <= len(bounds); i++ {
+			var from, to interface{}
+			if i > 0 {
+				from = bounds[i-1]
+			}
+			if i < len(bounds) {
+				to = bounds[i]
+			}
+			ok(t, store.ForEachIndexRange(&ItemTest{}, "Category", from, to, 2, func(records []interface{}) error {
+				assert(t, len(records) > 0 && len(records) <= 2, "Batch of %d records", len(records))
+				for _, record := range records {
+					item := record.(*ItemTest)
+					if from != nil {
+						assert(t, item.Category >= from.(string), "%s is before the range", item.Category)
+					}
+					if to != nil {
+						assert(t, item.Category < to.(string), "%s is after the range", item.Category)
+					}
+					seen[item.Key]++
+				}
+				return nil
+			}))
+		}
+		equals(t, len(testData), len(seen))
+		for _, count := range seen {
+			equals(t, 1, count)
+		}
+
+		expected := 0
+		for i := range testData {
+			if testData[i].Category >= "b" && testData[i].Category < "v" {
+				expected++
+			}
+		}
+		found := 0
+		ok(t, store.ForEachIndexRange(&ItemTest{}, "Category", "b", "v", 100, func(records []interface{}) error {
+			found += len(records)
+			return nil
+		}))
+		equals(t, expected, found)
+
+		stop := errors.New("stop")
+		equals(t, stop, store.ForEachIndexRange(&ItemTest{}, "Category", nil, nil, 1, func([]interface{}) error {
+			return stop
+		}))
+
+		assert(t, store.ForEachIndexRange(&ItemTest{}, "Category", nil, nil, 0,
+			func([]interface{}) error { return nil }) != nil, "No error for a batch size of 0")
+		_, err = store.IndexBoundaries(&ItemTest{}, "BadIndex", 2)
+		assert(t, err != nil, "No error for an index that doesn't exist")
+	})
+}
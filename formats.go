@@ -0,0 +1,24 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"regexp"
+)
+
+// Formats of common string values, for use with RegExp:
+//
+//	badgerhold.Where("Email").RegExp(badgerhold.FormatEmail)
+var (
+	// FormatEmail matches email addresses, using the definition of a valid email address from the HTML standard
+	FormatEmail = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?" +
+		`(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+	// FormatUUID matches UUIDs in their canonical 8-4-4-4-12 hex form, in either case
+	FormatUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// FormatURL matches absolute http and https URLs
+	FormatURL = regexp.MustCompile(`^(?i:https?)://[^\s/?#]+[^\s]*$`)
+)
@@ -14,9 +14,12 @@ import (
 // ErrNotFound is returned when no data is found for the given key
 var ErrNotFound = errors.New("No data found for this key")
 
+// ErrNilReference is returned by GetRelated when the reference field is nil, so there is no related record to get
+var ErrNilReference = errors.New("This reference field is nil")
+
 // Get retrieves a value from badgerhold and puts it into result.  Result must be a pointer
 func (s *Store) Get(key, result interface{}) error {
-	return s.Badger().View(func(tx *badger.Txn) error {
+	return s.view(func(tx *badger.Txn) error {
 		return s.TxGet(tx, key, result)
 	})
 }
@@ -24,8 +27,11 @@ func (s *Store) Get(key, result interface{}) error {
 // TxGet allows you to pass in your own badger transaction to retrieve a value from the badgerhold and puts it
 // into result
 func (s *Store) TxGet(tx *badger.Txn, key, result interface{}) error {
-	storer := s.newStorer(result)
+	return s.get(tx, s.newStorer(result), key, result)
+}
 
+// get reads the record of the storer's type with the key into result
+func (s *Store) get(tx *badger.Txn, storer Storer, key, result interface{}) error {
 	gk, err := s.encodeKey(key, storer.Type())
 
 	if err != nil {
@@ -41,7 +47,7 @@ func (s *Store) TxGet(tx *badger.Txn, key, result interface{}) error {
 	}
 
 	err = item.Value(func(value []byte) error {
-		return s.decode(value, result)
+		return s.decodeRecord(value, result)
 	})
 
 	if err != nil {
@@ -65,13 +71,86 @@ func (s *Store) TxGet(tx *badger.Txn, key, result interface{}) error {
 	return nil
 }
 
+// GetRelated gets the record whose key is held in the passed in field of record, such as a CustomerID field, and
+// puts it into relatedResult, which must be a pointer.  Returns ErrNilReference if the field is a nil pointer or
+// interface, and ErrNotFound if there is no record with the key
+func (s *Store) GetRelated(record interface{}, field string, relatedResult interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxGetRelated(tx, record, field, relatedResult)
+	})
+}
+
+// TxGetRelated is the same as GetRelated, but you specify your own transaction
+func (s *Store) TxGetRelated(tx *badger.Txn, record interface{}, field string, relatedResult interface{}) error {
+	key, err := fieldValue(reflect.ValueOf(record), field)
+	if err != nil {
+		return err
+	}
+
+	for key.Kind() == reflect.Ptr || key.Kind() == reflect.Interface {
+		if key.IsNil() {
+			return ErrNilReference
+		}
+		key = key.Elem()
+	}
+
+	return s.TxGet(tx, key.Interface(), relatedResult)
+}
+
+// GetRaw retrieves the encoded bytes of a value from badgerhold without decoding them.  dataType just needs to be
+// an example of the type stored so the key can be found
+func (s *Store) GetRaw(key, dataType interface{}) ([]byte, error) {
+	var result []byte
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		result, txErr = s.TxGetRaw(tx, key, dataType)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TxGetRaw is the same as GetRaw except it allows you to specify your own transaction
+func (s *Store) TxGetRaw(tx *badger.Txn, key, dataType interface{}) ([]byte, error) {
+	storer := s.newStorer(dataType)
+
+	gk, err := s.encodeKey(key, storer.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := tx.Get(gk)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
 // Find retrieves a set of values from the badgerhold that matches the passed in query
 // result must be a pointer to a slice.
 // The result of the query will be appended to the passed in result slice, rather than the passed in slice being
 // emptied.
 func (s *Store) Find(result interface{}, query *Query) error {
-	return s.Badger().View(func(tx *badger.Txn) error {
-		return s.TxFind(tx, result, query)
+	if query == nil {
+		query = &Query{}
+	}
+	return s.findCached(result, query, func() error {
+		if s.useStreamReads(query) {
+			query.streamRead = true
+			defer func() { query.streamRead = false }()
+			return s.findQuery(nil, result, query)
+		}
+
+		return s.view(func(tx *badger.Txn) error {
+			return s.TxFind(tx, result, query)
+		})
 	})
 }
 
@@ -80,10 +159,156 @@ func (s *Store) TxFind(tx *badger.Txn, result interface{}, query *Query) error {
 	return s.findQuery(tx, result, query)
 }
 
+// FindExcept retrieves the records that match the include query, but not the exclude query.  Only the criteria of
+// the exclude query are used, any index, sort, skip or limit on it is ignored, while those of the include query
+// are applied after the excluded records are removed
+func (s *Store) FindExcept(result interface{}, include, exclude *Query) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindExcept(tx, result, include, exclude)
+	})
+}
+
+// TxFindExcept is the same as FindExcept, but you specify your own transaction
+func (s *Store) TxFindExcept(tx *badger.Txn, result interface{}, include, exclude *Query) error {
+	return s.findExceptQuery(tx, result, include, exclude)
+}
+
+// FindTolerant is the same as Find, but records that can't be decoded, such as corrupt records or records stored
+// with an incompatible version of the type, are left out of the result rather than failing the query.  The errors
+// for those records are returned in badErrors as *RecordError.  err is only set if the query itself failed
+func (s *Store) FindTolerant(result interface{}, query *Query) (badErrors []error, err error) {
+	err = s.view(func(tx *badger.Txn) error {
+		var txErr error
+		badErrors, txErr = s.TxFindTolerant(tx, result, query)
+		return txErr
+	})
+	return badErrors, err
+}
+
+// TxFindTolerant is the same as FindTolerant, but you specify your own transaction
+func (s *Store) TxFindTolerant(tx *badger.Txn, result interface{}, query *Query) ([]error, error) {
+	return s.findTolerantQuery(tx, result, query)
+}
+
+// FindAllButLast is the same as Find, but leaves the last n records of the result set out of the result.  This is
+// applied to the entire result set, before any skip or limit.  Will panic if n is negative
+//
+//	store.FindAllButLast(&result, 1, badgerhold.Where("Name").Eq("snapshot").SortBy("Created"))
+func (s *Store) FindAllButLast(result interface{}, n int, query *Query) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindAllButLast(tx, result, n, query)
+	})
+}
+
+// TxFindAllButLast is the same as FindAllButLast, but you specify your own transaction
+func (s *Store) TxFindAllButLast(tx *badger.Txn, result interface{}, n int, query *Query) error {
+	return s.findAllButLastQuery(tx, result, n, query)
+}
+
+// FindMap retrieves a set of values from the badgerhold that matches the passed in query, and puts them into
+// result keyed by their badgerhold key.  result must be a pointer to a map whose key type matches the type of
+// the keys the values were stored with.  The results are added to any existing entries in the map
+func (s *Store) FindMap(result interface{}, query *Query) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindMap(tx, result, query)
+	})
+}
+
+// TxFindMap is the same as FindMap, but you specify your own transaction
+func (s *Store) TxFindMap(tx *badger.Txn, result interface{}, query *Query) error {
+	return s.findMapQuery(tx, result, query)
+}
+
+// FindMapped runs mapFn against each of the dataType records that match the query, as they're read, and appends
+// the values it returns to result, which must be a pointer to a slice of the type mapFn returns, such as to project
+// the records onto DTOs without building a slice of the records first.  mapFn is passed a pointer to the record
+func (s *Store) FindMapped(dataType interface{}, query *Query, mapFn func(record interface{}) (interface{}, error),
+	result interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindMapped(tx, dataType, query, mapFn, result)
+	})
+}
+
+// TxFindMapped is the same as FindMapped, but you specify your own transaction
+func (s *Store) TxFindMapped(tx *badger.Txn, dataType interface{}, query *Query,
+	mapFn func(record interface{}) (interface{}, error), result interface{}) error {
+	return s.findMappedQuery(tx, dataType, query, mapFn, result)
+}
+
+// FindKeys returns the keys of the records that match the passed in query, rather than the records themselves.
+// dataType must have a field tagged as the key, which is the type the keys are decoded into.
+// Where the query only has criteria against the Key or an index, the record values are not decoded at all
+func (s *Store) FindKeys(dataType interface{}, query *Query) ([]interface{}, error) {
+	var result []interface{}
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		result, txErr = s.TxFindKeys(tx, dataType, query)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TxFindKeys is the same as FindKeys, but you specify your own transaction
+func (s *Store) TxFindKeys(tx *badger.Txn, dataType interface{}, query *Query) ([]interface{}, error) {
+	return s.findKeysQuery(tx, dataType, query)
+}
+
+// LazyRecord is a record matched by FindLazy which is only decoded when it's accessed
+type LazyRecord struct {
+	store    *Store
+	typeName string
+	key      []byte
+	value    []byte
+}
+
+// Key decodes the key of the record into the passed in pointer
+func (l *LazyRecord) Key(key interface{}) error {
+	return l.store.decodeKey(l.key, key, l.typeName)
+}
+
+// Decode decodes the record into the passed in pointer
+func (l *LazyRecord) Decode(result interface{}) error {
+	err := l.store.decode(l.value, result)
+	if err != nil {
+		return err
+	}
+
+	tp := reflect.TypeOf(result)
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	if keyField, ok := getKeyField(tp); ok {
+		return l.Key(reflect.Indirect(reflect.ValueOf(result)).FieldByName(keyField.Name).Addr().Interface())
+	}
+
+	return nil
+}
+
+// FindLazy runs the function fn against every record that matches the query without decoding the records first.
+// When the query only has criteria against the Key or an index, records are never decoded unless fn calls Decode,
+// which is useful for large records where only some of the matches need to be read in full.
+// The LazyRecord passed to fn is only valid until fn returns. Returning an error from fn will stop the iteration
+func (s *Store) FindLazy(dataType interface{}, query *Query, fn func(record *LazyRecord) error) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxFindLazy(tx, dataType, query, fn)
+	})
+}
+
+// TxFindLazy is the same as FindLazy but you get to specify your transaction
+func (s *Store) TxFindLazy(tx *badger.Txn, dataType interface{}, query *Query,
+	fn func(record *LazyRecord) error) error {
+	return s.findLazyQuery(tx, dataType, query, fn)
+}
+
 // FindOne returns a single record, and so result is NOT a slice, but an pointer to a struct, if no record is found
 // that matches the query, then it returns ErrNotFound
 func (s *Store) FindOne(result interface{}, query *Query) error {
-	return s.Badger().View(func(tx *badger.Txn) error {
+	return s.view(func(tx *badger.Txn) error {
 		return s.TxFindOne(tx, result, query)
 	})
 }
@@ -96,7 +321,7 @@ func (s *Store) TxFindOne(tx *badger.Txn, result interface{}, query *Query) erro
 // Count returns the current record count for the passed in datatype
 func (s *Store) Count(dataType interface{}, query *Query) (uint64, error) {
 	var count uint64
-	err := s.Badger().View(func(tx *badger.Txn) error {
+	err := s.view(func(tx *badger.Txn) error {
 		var txErr error
 		count, txErr = s.TxCount(tx, dataType, query)
 		return txErr
@@ -109,12 +334,37 @@ func (s *Store) TxCount(tx *badger.Txn, dataType interface{}, query *Query) (uin
 	return s.countQuery(tx, dataType, query)
 }
 
+// CountApprox returns an approximate count of the records of the passed in datatype, for when an exact Count is too
+// slow, such as on dashboards.  Types with up to a few thousand records are counted exactly.  Larger ones are
+// estimated from the key counts badger keeps for its tables, which include old versions of updated records and
+// deleted records that haven't been compacted away yet, and leave out records not yet flushed to a table
+func (s *Store) CountApprox(dataType interface{}) (uint64, error) {
+	var count uint64
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		count, txErr = s.countApprox(tx, dataType)
+		return txErr
+	})
+	return count, err
+}
+
 // ForEach runs the function fn against every record that matches the query
 // Useful for when working with large sets of data that you don't want to hold the entire result
 // set in memory, similar to database cursors
 // Return an error from fn, will stop the cursor from iterating
+// The query's Skip and Limit are honored, so fn is run against at most Limit records, after skipping the first Skip,
+// and iterating stops once the limit is reached
 func (s *Store) ForEach(query *Query, fn interface{}) error {
-	return s.Badger().View(func(tx *badger.Txn) error {
+	if query == nil {
+		query = &Query{}
+	}
+	if s.useStreamReads(query) {
+		query.streamRead = true
+		defer func() { query.streamRead = false }()
+		return s.forEach(nil, query, fn)
+	}
+
+	return s.view(func(tx *badger.Txn) error {
 		return s.TxForEach(tx, query, fn)
 	})
 }
@@ -123,3 +373,30 @@ func (s *Store) ForEach(query *Query, fn interface{}) error {
 func (s *Store) TxForEach(tx *badger.Txn, query *Query, fn interface{}) error {
 	return s.forEach(tx, query, fn)
 }
+
+// ForEachPooled is the same as ForEach, but decodes the records into values from newRecord, such as a sync.Pool's
+// Get, rather than allocating a new value for every record.  newRecord must return a pointer to the struct type
+// being queried.  Values that are read but don't match the query are handed back with release, such as a
+// sync.Pool's Put, while fn is responsible for releasing the records it's passed once it's done with them.
+// Sorted queries hold every record until they're sorted, so their records aren't taken from newRecord
+func (s *Store) ForEachPooled(query *Query, newRecord func() interface{}, release func(record interface{}),
+	fn func(record interface{}) error) error {
+	if query == nil {
+		query = &Query{}
+	}
+	if s.useStreamReads(query) {
+		query.streamRead = true
+		defer func() { query.streamRead = false }()
+		return s.forEachPooled(nil, query, newRecord, release, fn)
+	}
+
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxForEachPooled(tx, query, newRecord, release, fn)
+	})
+}
+
+// TxForEachPooled is the same as ForEachPooled but you get to specify your transaction
+func (s *Store) TxForEachPooled(tx *badger.Txn, query *Query, newRecord func() interface{},
+	release func(record interface{}), fn func(record interface{}) error) error {
+	return s.forEachPooled(tx, query, newRecord, release, fn)
+}
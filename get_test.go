@@ -5,6 +5,8 @@
 package badgerhold_test
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -158,3 +160,294 @@ func TestTxGetBadgerError(t *testing.T) {
 		}
 	})
 }
+
+func TestFindKeys(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type KeyTest struct {
+			Key      int    `badgerholdKey:"Key"`
+			Category string `badgerholdIndex:"Category"`
+		}
+
+		for i := 0; i < 10; i++ {
+			category := "even"
+			if i%2 != 0 {
+				category = "odd"
+			}
+			ok(t, store.Insert(i, &KeyTest{Category: category}))
+		}
+
+		keys, err := store.FindKeys(&KeyTest{}, badgerhold.Where(badgerhold.Key).Lt(3))
+		ok(t, err)
+		equals(t, []interface{}{0, 1, 2}, keys)
+
+		keys, err = store.FindKeys(&KeyTest{}, badgerhold.Where("Category").Eq("odd").Index("Category"))
+		ok(t, err)
+		equals(t, []interface{}{1, 3, 5, 7, 9}, keys)
+
+		keys, err = store.FindKeys(&KeyTest{}, badgerhold.Where("Category").Eq("even").
+			Or(badgerhold.Where(badgerhold.Key).Eq(3)))
+		ok(t, err)
+		equals(t, []interface{}{0, 2, 4, 6, 8, 3}, keys)
+
+		keys, err = store.FindKeys(&KeyTest{}, badgerhold.Where(badgerhold.Key).Ge(5).Limit(2))
+		ok(t, err)
+		equals(t, []interface{}{5, 6}, keys)
+	})
+}
+
+func TestFindKeysWithoutKeyField(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		_, err := store.FindKeys(&ItemTest{}, nil)
+		if err == nil {
+			t.Fatalf("FindKeys on a type without a key field did not return an error")
+		}
+	})
+}
+
+func TestGetRaw(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		key := "testKey"
+		data := &ItemTest{
+			Name:    "Test Name",
+			Created: time.Now(),
+		}
+		ok(t, store.Insert(key, data))
+
+		raw, err := store.GetRaw(key, &ItemTest{})
+		ok(t, err)
+
+		result := &ItemTest{}
+		ok(t, badgerhold.DefaultDecode(raw, result))
+		assert(t, data.equal(result), "Got %v wanted %v.", result, data)
+
+		_, err = store.GetRaw("missing", &ItemTest{})
+		equals(t, badgerhold.ErrNotFound, err)
+	})
+}
+
+func TestGetRelated(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Customer struct {
+			ID   int `badgerhold:"key"`
+			Name string
+		}
+		type Invoice struct {
+			CustomerID int
+			ShipTo     *int
+		}
+
+		ok(t, store.Insert(7, &Customer{Name: "Acme"}))
+
+		customer := &Customer{}
+		ok(t, store.GetRelated(&Invoice{CustomerID: 7}, "CustomerID", customer))
+		equals(t, &Customer{ID: 7, Name: "Acme"}, customer)
+
+		shipTo := 7
+		customer = &Customer{}
+		ok(t, store.GetRelated(Invoice{ShipTo: &shipTo}, "ShipTo", customer))
+		equals(t, "Acme", customer.Name)
+
+		equals(t, badgerhold.ErrNotFound, store.GetRelated(&Invoice{CustomerID: 8}, "CustomerID", &Customer{}))
+		equals(t, badgerhold.ErrNilReference, store.GetRelated(&Invoice{}, "ShipTo", &Customer{}))
+		assert(t, store.GetRelated(&Invoice{}, "Missing", &Customer{}) != nil,
+			"GetRelated on a missing field did not return an error")
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		snapshot := store.Snapshot()
+		defer snapshot.Close()
+
+		ok(t, store.Delete(testData[0].Key, &ItemTest{}))
+		ok(t, store.Insert(100, &ItemTest{ID: 100, Name: "pear", Category: "food"}))
+
+		count, err := snapshot.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(len(testData)), count)
+
+		var result ItemTest
+		ok(t, snapshot.Get(testData[0].Key, &result))
+		assert(t, result.equal(&testData[0]), "Snapshot did not return the deleted record")
+		equals(t, badgerhold.ErrNotFound, snapshot.Get(100, &result))
+
+		var found []ItemTest
+		ok(t, snapshot.Find(&found, badgerhold.Where("Category").Eq("food")))
+		equals(t, 5, len(found))
+
+		ok(t, snapshot.FindOne(&result, badgerhold.Where("Name").Eq(testData[0].Name)))
+		assert(t, result.equal(&testData[0]), "Snapshot FindOne did not return the deleted record")
+
+		seen := 0
+		ok(t, snapshot.ForEach(nil, func(record *ItemTest) error {
+			seen++
+			return nil
+		}))
+		equals(t, len(testData), seen)
+
+		count, err = store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(len(testData)), count)
+	})
+}
+
+func TestFindTolerant(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		// corrupt two of the records
+		corrupted := map[string]int{}
+		ok(t, store.Badger().Update(func(tx *badger.Txn) error {
+			iter := tx.NewIterator(badger.DefaultIteratorOptions)
+			defer iter.Close()
+
+			prefix := []byte("bh_ItemTest:")
+			var keys [][]byte
+			for iter.Seek(prefix); iter.ValidForPrefix(prefix) && len(keys) < 2; iter.Next() {
+				keys = append(keys, iter.Item().KeyCopy(nil))
+			}
+			for i := range keys {
+				item, err := tx.Get(keys[i])
+				if err != nil {
+					return err
+				}
+				var record ItemTest
+				err = item.Value(func(val []byte) error {
+					return badgerhold.DefaultDecode(val, &record)
+				})
+				if err != nil {
+					return err
+				}
+				corrupted[record.Category]++
+
+				err = tx.Set(keys[i], []byte("corrupt"))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+		var result []ItemTest
+		assert(t, store.Find(&result, nil) != nil, "Find with corrupt records didn't fail")
+
+		result = nil
+		badErrors, err := store.FindTolerant(&result, nil)
+		ok(t, err)
+		equals(t, 2, len(badErrors))
+		equals(t, len(testData)-2, len(result))
+
+		var recordErr *badgerhold.RecordError
+		assert(t, errors.As(badErrors[0], &recordErr), "Decode error is not a RecordError")
+
+		result = nil
+		badErrors, err = store.FindTolerant(&result, badgerhold.Where("Category").Eq("vehicle").
+			Or(badgerhold.Where("Category").Eq("animal")).SortBy("Name"))
+		ok(t, err)
+		equals(t, 2, len(badErrors))
+		equals(t, 12-corrupted["vehicle"]-corrupted["animal"], len(result))
+
+		result = nil
+		badErrors, err = store.FindTolerant(&result, badgerhold.Where("Category").Eq("food").Index("Category"))
+		ok(t, err)
+		equals(t, corrupted["food"], len(badErrors))
+		equals(t, 5-corrupted["food"], len(result))
+	})
+}
+
+func TestEncodeDecodeKey(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		key, err := store.EncodeKey(testData[3].Key, "ItemTest")
+		ok(t, err)
+
+		ok(t, store.Badger().View(func(tx *badger.Txn) error {
+			_, err := tx.Get(key)
+			return err
+		}))
+
+		var decoded int
+		ok(t, store.DecodeKey(key, &decoded, "ItemTest"))
+		equals(t, testData[3].Key, decoded)
+
+		assert(t, store.DecodeKey(key, &decoded, "OtherType") != nil, "Decoding a key of another type didn't fail")
+	})
+}
+
+type DefaultItem struct {
+	ID      int `badgerhold:"key"`
+	Name    string
+	Status  string `badgerhold:"default=active"`
+	Retries int    `badgerhold:"default=3"`
+}
+
+func TestGetFieldDefaults(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		// a record written before the Status and Retries fields were added
+		ok(t, store.Badger().Update(func(tx *badger.Txn) error {
+			key, err := store.EncodeKey(1, "DefaultItem")
+			if err != nil {
+				return err
+			}
+			value, err := badgerhold.DefaultEncode(struct{ Name string }{Name: "legacy"})
+			if err != nil {
+				return err
+			}
+			return tx.Set(key, value)
+		}))
+		ok(t, store.Insert(2, &DefaultItem{Name: "current", Status: "closed", Retries: 1}))
+
+		var result DefaultItem
+		ok(t, store.Get(1, &result))
+		equals(t, DefaultItem{ID: 1, Name: "legacy", Status: "active", Retries: 3}, result)
+
+		result = DefaultItem{}
+		ok(t, store.Get(2, &result))
+		equals(t, DefaultItem{ID: 2, Name: "current", Status: "closed", Retries: 1}, result)
+
+		var found []DefaultItem
+		ok(t, store.Find(&found, badgerhold.Where("Status").Eq("active")))
+		equals(t, 1, len(found))
+		equals(t, "legacy", found[0].Name)
+		equals(t, 3, found[0].Retries)
+
+		type BadDefault struct {
+			Retries int `badgerhold:"default=many"`
+		}
+		assert(t, store.ValidateType(&BadDefault{}) != nil, "an invalid default did not fail validation")
+		ok(t, store.ValidateType(&DefaultItem{}))
+	})
+}
+
+func TestGetLite(t *testing.T) {
+	type Document struct {
+		ID    int `badgerhold:"key"`
+		Title string
+		Pages []string
+	}
+	type DocumentSummary struct {
+		ID    int `badgerhold:"key"`
+		Title string
+	}
+
+	opt := testOptions()
+	opt.Encoder = json.Marshal
+	opt.Decoder = json.Unmarshal
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		ok(t, store.Insert(1, &Document{Title: "one", Pages: []string{"a", "b", "c"}}))
+
+		var summary DocumentSummary
+		assert(t, store.GetLite(1, &summary) != nil, "GetLite of an unregistered type did not fail")
+
+		store.RegisterLite(&Document{}, DocumentSummary{})
+		ok(t, store.GetLite(1, &summary))
+		equals(t, DocumentSummary{ID: 1, Title: "one"}, summary)
+
+		equals(t, badgerhold.ErrNotFound, store.GetLite(2, &summary))
+	})
+}
@@ -6,8 +6,11 @@ package badgerhold
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -18,13 +21,253 @@ const indexPrefix = "_bhIndex"
 const iteratorKeyMinCacheSize = 100
 
 // Index is a function that returns the indexable, encoded bytes of the passed in value
+// Descending stores the index entries in the reverse order of their encoded bytes, so queries using the index
+// return records with the largest values first
+// Bucket indexes a time.Time field by the start of the bucket of this size its UTC time falls in, so each index
+// entry covers a range of times and range queries read one entry per bucket.  The IndexFunc must encode the time
+// truncated to the bucket, which the badgerholdIndex tag option bucket= does for you:
+//
+//	Created time.Time `badgerholdIndex:"CreatedHour;bucket=1h"`
+//
+// Condition makes the index partial: only records it returns true for are added to the index.  ConditionQuery does
+// the same with a query the records must match, such as Where("Active").Eq(true).  Because the index is missing the
+// other records, AutoIndex never picks a partial index, and a query can only use one with Index if its criteria
+// include all of those of the ConditionQuery, so it can't match a record missing from the index.  Otherwise the
+// query returns an error, which is always the case for an index with a Condition func
+// Columns makes the index composite, see CompositeIndex
 type Index struct {
-	IndexFunc func(name string, value interface{}) ([]byte, error)
-	Unique    bool
+	IndexFunc      func(name string, value interface{}) ([]byte, error)
+	Unique         bool
+	Descending     bool
+	Bucket         time.Duration
+	Condition      func(value interface{}) bool
+	ConditionQuery *Query
+	Columns        []string
+
+	// the encoder of the columns of a composite index, and whether it preserves the order of their values
+	encode  EncodeFunc
+	ordered bool
+}
+
+// CompositeIndex returns an index on several fields of a record, in order.  The value of the index is the encoded
+// value of each field, one after another, so the entries of records with the same values in the leading fields
+// share a prefix of the index key:
+//
+//	"Active_Updated": badgerhold.CompositeIndex(badgerhold.DefaultEncode, "Active", "Updated"),
+//
+// Queries using the index seek to the prefix of the leading fields they test with Eq, and test the criteria on the
+// next field, if it's the last one, against the rest of the index key.  The entries are ordered by their encoded
+// bytes, and the default gob encoding doesn't encode values so their bytes sort in the same order as the values, so
+// a range of the next field isn't a contiguous run of entries, and every entry after the prefix is read and tested.
+// Use OrderedCompositeIndex for range scans.  encode must be the encoder of the store, and each field must be
+// encoded to the same bytes on its own as it is when queried, which isn't the case for gob encoded interface fields
+func CompositeIndex(encode EncodeFunc, columns ...string) Index {
+	return Index{
+		IndexFunc: func(_ string, value interface{}) ([]byte, error) {
+			record := reflect.Indirect(reflect.ValueOf(value))
+			var result []byte
+			for _, column := range columns {
+				field, err := fieldValue(record, column)
+				if err != nil {
+					return nil, err
+				}
+				encoded, err := encode(field.Interface())
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, encoded...)
+			}
+			return result, nil
+		},
+		Columns: columns,
+		encode:  encode,
+	}
+}
+
+// OrderedCompositeIndex returns a composite index like CompositeIndex, with its fields encoded so their bytes sort in
+// the same order as their values, rather than with the store's encoder.  Queries using the index seek to the start
+// of the range the Gt, Ge, Lt, Le and Eq criteria on the field after the leading Eq fields allow, and stop reading
+// entries at its end:
+//
+//	// reads only the entries of active records updated since the cutoff
+//	badgerhold.Where("Active").Eq(true).And("Updated").Ge(cutoff).Index("Active_Updated")
+//
+// The fields can be bools, integers, floats, strings, byte slices or time.Times, and only criteria with values of the
+// same type as the field bound the range.  Times are ordered by their instant, ignoring their location, and floats
+// by their value, with NaNs sorting after +Inf, or before -Inf if their sign bit is set.  Descending isn't supported,
+// an ordered index that sets it is read like a CompositeIndex
+func OrderedCompositeIndex(columns ...string) Index {
+	index := CompositeIndex(orderedEncode, columns...)
+	index.ordered = true
+	return index
+}
+
+// compositePrefix returns the encoded values of the leading columns of the index the query tests for equality, and
+// the position and criteria of the column after them.  The position is the number of columns if the query tests them
+// all for equality, or the next column can't be tested against the index
+func (s *Store) compositePrefix(query *Query, index Index) ([]byte, int, []*Criterion, error) {
+	encode := index.encode
+	if encode == nil {
+		encode = s.encode
+	}
+
+	var prefix []byte
+	for i, column := range index.Columns {
+		criteria := query.fieldCriteria[column]
+		if needsRecord(criteria) || streamCriterion(criteria) != nil {
+			return prefix, len(index.Columns), nil, nil
+		}
+
+		equal := columnCriterion(query, column, criteria, eq)
+		if equal == nil {
+			return prefix, i, criteria, nil
+		}
+
+		encoded, err := encode(equal.value)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		prefix = append(prefix, encoded...)
+	}
+	return prefix, len(index.Columns), nil, nil
+}
+
+// columnCriterion returns the first of the criteria on the column of a composite index with the operator whose value
+// is encoded like the column's, if there is one
+func columnCriterion(query *Query, column string, criteria []*Criterion, operator int) *Criterion {
+	for _, c := range criteria {
+		if c.operator == operator && encodedLikeColumn(query, column, c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// encodedLikeColumn returns whether the value of the criterion is encoded the same as the values of the column,
+// values of other types could be equal without being encoded the same
+func encodedLikeColumn(query *Query, column string, c *Criterion) bool {
+	field, ok := query.dataType.FieldByName(column)
+	return ok && c.equal == nil && c.jsonSegments == nil && c.value != nil && reflect.TypeOf(c.value) == field.Type
+}
+
+// orderedBounds returns the encoded bounds of the range of the column of an ordered composite index the criteria
+// allow, nil if the range is unbounded at that end, and whether each bound is exclusive
+func orderedBounds(query *Query, column string, criteria []*Criterion) (lower, upper []byte, lowerExcl,
+	upperExcl bool, err error) {
+	for _, c := range criteria {
+		var isLower, isUpper bool
+		switch c.operator {
+		case eq:
+			isLower, isUpper = true, true
+		case gt, ge:
+			isLower = true
+		case lt, le:
+			isUpper = true
+		default:
+			continue
+		}
+		if !encodedLikeColumn(query, column, c) {
+			continue
+		}
+
+		encoded, err := orderedEncode(c.value)
+		if err != nil {
+			return nil, nil, false, false, err
+		}
+		excl := c.operator == gt || c.operator == lt
+
+		if cmp := bytes.Compare(encoded, lower); isLower && (lower == nil || cmp > 0 || (cmp == 0 && excl)) {
+			lower, lowerExcl = encoded, excl
+		}
+		if cmp := bytes.Compare(encoded, upper); isUpper && (upper == nil || cmp < 0 || (cmp == 0 && excl)) {
+			upper, upperExcl = encoded, excl
+		}
+	}
+	return lower, upper, lowerExcl, upperExcl, nil
+}
+
+// partial returns whether the index only holds the records that meet its condition
+func (i Index) partial() bool {
+	return i.Condition != nil || i.ConditionQuery != nil
+}
+
+// includes returns whether the record belongs in the index
+func (i Index) includes(s *Store, value interface{}) (bool, error) {
+	if i.Condition != nil && !i.Condition(value) {
+		return false, nil
+	}
+	if i.ConditionQuery == nil {
+		return true, nil
+	}
+	return i.ConditionQuery.Matches(s, value)
+}
+
+// impliedBy returns whether every record the query matches belongs in the partial index, because the query's
+// criteria include all of those of the index's ConditionQuery
+func (i Index) impliedBy(query *Query) bool {
+	if i.Condition != nil || i.ConditionQuery == nil || len(i.ConditionQuery.ors) > 0 {
+		return false
+	}
+
+	for field, criteria := range i.ConditionQuery.fieldCriteria {
+		for _, c := range criteria {
+			if !c.includedIn(query.fieldCriteria[field]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// includedIn returns whether the criteria contain a criterion that tests for the same thing as c
+func (c *Criterion) includedIn(criteria []*Criterion) bool {
+	if c.lazyValue != nil || c.lazyValues != nil || c.stored != nil || c.equal != nil || c.stream != nil ||
+		c.operator == fn || c.operator == cm {
+		// the values can't be compared
+		return false
+	}
+
+	for _, other := range criteria {
+		if other.operator == c.operator && other.jsonPath == c.jsonPath && other.equal == nil &&
+			reflect.DeepEqual(other.value, c.value) && reflect.DeepEqual(other.values, c.values) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyValue returns the value of the index as it's stored in the index key
+func (i Index) keyValue(value []byte) []byte {
+	if !i.Descending {
+		return value
+	}
+
+	// complement the bytes to reverse their order, and terminate with 0xFF so shorter values that are a prefix
+	// of longer ones sort after them
+	result := make([]byte, len(value)+1)
+	for k := range value {
+		result[k] = ^value[k]
+	}
+	result[len(value)] = 0xFF
+	return result
+}
+
+// value returns the encoded value of the index from the value stored in the index key
+func (i Index) value(keyValue []byte) []byte {
+	if !i.Descending || len(keyValue) == 0 {
+		return keyValue
+	}
+
+	result := make([]byte, len(keyValue)-1)
+	for k := range result {
+		result[k] = ^keyValue[k]
+	}
+	return result
 }
 
 // adds an item to the index
 func (s *Store) indexAdd(storer Storer, tx *badger.Txn, key []byte, data interface{}) error {
+	s.queryCache.invalidate(storer.Type())
 	indexes := storer.Indexes()
 	for name, index := range indexes {
 		err := s.indexUpdate(storer.Type(), name, index, tx, key, data, false)
@@ -39,6 +282,7 @@ func (s *Store) indexAdd(storer Storer, tx *badger.Txn, key []byte, data interfa
 // removes an item from the index
 // be sure to pass the data from the old record, not the new one
 func (s *Store) indexDelete(storer Storer, tx *badger.Txn, key []byte, originalData interface{}) error {
+	s.queryCache.invalidate(storer.Type())
 	indexes := storer.Indexes()
 
 	for name, index := range indexes {
@@ -54,6 +298,10 @@ func (s *Store) indexDelete(storer Storer, tx *badger.Txn, key []byte, originalD
 // adds or removes a specific index on an item
 func (s *Store) indexUpdate(typeName, indexName string, index Index, tx *badger.Txn, key []byte, value interface{},
 	delete bool) error {
+	included, err := index.includes(s, value)
+	if err != nil || !included {
+		return err
+	}
 
 	indexKey, err := index.IndexFunc(indexName, value)
 	if err != nil {
@@ -65,7 +313,8 @@ func (s *Store) indexUpdate(typeName, indexName string, index Index, tx *badger.
 
 	indexValue := make(KeyList, 0)
 
-	indexKey = append(indexKeyPrefix(typeName, indexName), indexKey...)
+	indexKey = s.newIndexKey(typeName, indexName, index.keyValue(indexKey))
+	s.invalidateIndexCache(typeName, indexName, indexKey)
 
 	item, err := tx.Get(indexKey)
 	if err != nil && err != badger.ErrKeyNotFound {
@@ -85,9 +334,9 @@ func (s *Store) indexUpdate(typeName, indexName string, index Index, tx *badger.
 	}
 
 	if delete {
-		indexValue.remove(key)
+		indexValue.Remove(key)
 	} else {
-		indexValue.add(key)
+		indexValue.Add(key)
 	}
 
 	if len(indexValue) == 0 {
@@ -103,19 +352,256 @@ func (s *Store) indexUpdate(typeName, indexName string, index Index, tx *badger.
 }
 
 // indexKeyPrefix returns the prefix of the badger key where this index is stored
-func indexKeyPrefix(typeName, indexName string) []byte {
-	return []byte(indexPrefix + ":" + typeName + ":" + indexName + ":")
+func (s *Store) indexKeyPrefix(typeName, indexName string) []byte {
+	return s.newIndexKey(typeName, indexName, nil)
 }
 
 // newIndexKey returns the badger key where this index is stored
-func newIndexKey(typeName, indexName string, value []byte) []byte {
-	return append(indexKeyPrefix(typeName, indexName), value...)
+func (s *Store) newIndexKey(typeName, indexName string, value []byte) []byte {
+	if s.indexKeyFunc != nil {
+		return s.indexKeyFunc(typeName, indexName, value)
+	}
+	return append([]byte(indexPrefix+":"+typeName+":"+indexName+":"), value...)
+}
+
+// VerifyIndexes checks every entry in the indexes of dataType against the records it points to, and removes the
+// entries for records that no longer exist or whose indexed value has changed, such as entries left behind by a
+// crash.  Returns the number of entries removed.  Records missing from an index are not added
+func (s *Store) VerifyIndexes(dataType interface{}) (int, error) {
+	var repaired int
+	err := s.update(func(tx *badger.Txn) error {
+		var txErr error
+		repaired, txErr = s.TxVerifyIndexes(tx, dataType)
+		return txErr
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return repaired, nil
+}
+
+// TxVerifyIndexes is the same as VerifyIndexes, but you specify your own transaction
+func (s *Store) TxVerifyIndexes(tx *badger.Txn, dataType interface{}) (int, error) {
+	storer := s.newStorer(dataType)
+	indexes := storer.Indexes()
+
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	repaired := 0
+	for _, name := range names {
+		removed, err := s.verifyIndex(tx, dataType, storer, name, indexes[name])
+		if err != nil {
+			return 0, err
+		}
+		repaired += removed
+	}
+
+	return repaired, nil
+}
+
+// verifyIndex removes the entries of the index that don't match the records they point to
+func (s *Store) verifyIndex(tx *badger.Txn, dataType interface{}, storer Storer, indexName string,
+	index Index) (int, error) {
+	prefix := s.indexKeyPrefix(storer.Type(), indexName)
+	changed := make(map[string]KeyList)
+	removed := 0
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		item := iter.Item()
+		indexKey := item.KeyCopy(nil)
+
+		keys := KeyList{}
+		err := item.Value(func(val []byte) error {
+			return s.decode(val, &keys)
+		})
+		if err != nil {
+			iter.Close()
+			return 0, err
+		}
+
+		valid := make(KeyList, 0, len(keys))
+		for _, key := range keys {
+			ok, err := s.indexEntryValid(tx, dataType, indexName, index, indexKey[len(prefix):], key)
+			if err != nil {
+				iter.Close()
+				return 0, err
+			}
+			if ok {
+				valid = append(valid, key)
+			}
+		}
+
+		if len(valid) != len(keys) {
+			removed += len(keys) - len(valid)
+			changed[string(indexKey)] = valid
+		}
+	}
+	// writes are made after the iterator is closed, so the entries being read aren't changed
+	iter.Close()
+
+	for indexKey, keys := range changed {
+		s.invalidateIndexCache(storer.Type(), indexName, []byte(indexKey))
+		if len(keys) == 0 {
+			err := tx.Delete([]byte(indexKey))
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		value, err := s.encode(keys)
+		if err != nil {
+			return 0, err
+		}
+		err = tx.Set([]byte(indexKey), value)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return removed, nil
+}
+
+// indexEntryValid returns whether the record with the key exists, belongs in the index, and has the index value it's
+// stored under
+func (s *Store) indexEntryValid(tx *badger.Txn, dataType interface{}, indexName string, index Index, indexValue,
+	key []byte) (bool, error) {
+	item, err := tx.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	record := newElemType(dataType)
+	err = item.Value(func(val []byte) error {
+		return s.decode(val, record)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	included, err := index.includes(s, record)
+	if err != nil || !included {
+		return false, err
+	}
+
+	current, err := index.IndexFunc(indexName, record)
+	if err != nil {
+		return false, err
+	}
+
+	return current != nil && bytes.Equal(index.keyValue(current), indexValue), nil
+}
+
+// indexCache holds the key lists of a preloaded index in memory
+type indexCache struct {
+	sync.RWMutex
+	loaded  bool
+	values  map[string]KeyList
+	invalid map[string]bool // index values written since the index was preloaded, must be read from badger
+}
+
+// PreloadIndex reads all of the values of the passed in index into memory, so equality and In queries against the
+// index don't need to read the index from badger.  Writes to records of the type invalidate the cached index values
+// they change, which are then read from badger until PreloadIndex is called again, so this is best suited to indexes
+// that are read often and written rarely.
+// The cache always reflects the latest committed writes, so a transaction that started before a write can see the
+// write's index values when reading from a preloaded index
+func (s *Store) PreloadIndex(dataType interface{}, indexName string) error {
+	storer := s.newStorer(dataType)
+	if _, ok := storer.Indexes()[indexName]; !ok {
+		return fmt.Errorf("The index %s does not exist", indexName)
+	}
+
+	prefix := s.indexKeyPrefix(storer.Type(), indexName)
+
+	// register the cache before reading the index, so writes made while it's read are invalidated
+	cache := &indexCache{
+		invalid: make(map[string]bool),
+	}
+	s.indexCaches.Store(string(prefix), cache)
+
+	values := make(map[string]KeyList)
+	err := s.view(func(tx *badger.Txn) error {
+		iter := tx.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+			keyList := KeyList{}
+			err := item.Value(func(val []byte) error {
+				return s.decode(val, &keyList)
+			})
+			if err != nil {
+				return err
+			}
+			values[string(item.KeyCopy(nil))] = keyList
+		}
+		return nil
+	})
+	if err != nil {
+		s.indexCaches.Delete(string(prefix))
+		return err
+	}
+
+	cache.Lock()
+	cache.values = values
+	cache.loaded = true
+	cache.Unlock()
+	return nil
 }
 
-// KeyList is a slice of unique, sorted keys([]byte) such as what an index points to
+// cachedIndexValue returns the key list stored at the index key from the preloaded index, ok is false if the
+// index key needs to be read from badger
+func (s *Store) cachedIndexValue(typeName, indexName string, indexKey []byte) (keyList KeyList, ok bool) {
+	value, found := s.indexCaches.Load(string(s.indexKeyPrefix(typeName, indexName)))
+	if !found {
+		return nil, false
+	}
+
+	cache := value.(*indexCache)
+	cache.RLock()
+	defer cache.RUnlock()
+
+	if !cache.loaded || cache.invalid[string(indexKey)] {
+		return nil, false
+	}
+
+	return cache.values[string(indexKey)], true
+}
+
+func (s *Store) invalidateIndexCache(typeName, indexName string, indexKey []byte) {
+	value, found := s.indexCaches.Load(string(s.indexKeyPrefix(typeName, indexName)))
+	if !found {
+		return
+	}
+
+	cache := value.(*indexCache)
+	cache.Lock()
+	cache.invalid[string(indexKey)] = true
+	delete(cache.values, string(indexKey))
+	cache.Unlock()
+}
+
+// KeyList is a slice of unique, sorted keys([]byte) such as what an index points to.
+//
+// Each value of an index is stored under its own badger key, "_bhIndex:<type>:<index>:" followed by the encoded
+// value (or the key built by Options.IndexKeyFunc), with the bytes of the encoded value complemented and terminated
+// with 0xFF for Descending indexes.  The badger value is the KeyList of the records with that value, encoded with the
+// store's Encoder, where each key is the record's full badger key, "bh_<type>:" followed by its encoded key.  An
+// index key is deleted once its KeyList is empty.
 type KeyList [][]byte
 
-func (v *KeyList) add(key []byte) {
+// Add inserts the key in sorted order, unless it's already in the list
+func (v *KeyList) Add(key []byte) {
 	i := sort.Search(len(*v), func(i int) bool {
 		return bytes.Compare((*v)[i], key) >= 0
 	})
@@ -130,19 +616,21 @@ func (v *KeyList) add(key []byte) {
 	(*v)[i] = key
 }
 
-func (v *KeyList) remove(key []byte) {
+// Remove removes the key from the list, if it's in it
+func (v *KeyList) Remove(key []byte) {
 	i := sort.Search(len(*v), func(i int) bool {
 		return bytes.Compare((*v)[i], key) >= 0
 	})
 
-	if i < len(*v) {
+	if i < len(*v) && bytes.Equal((*v)[i], key) {
 		copy((*v)[i:], (*v)[i+1:])
 		(*v)[len(*v)-1] = nil
 		*v = (*v)[:len(*v)-1]
 	}
 }
 
-func (v *KeyList) in(key []byte) bool {
+// In returns whether the key is in the list
+func (v *KeyList) In(key []byte) bool {
 	i := sort.Search(len(*v), func(i int) bool {
 		return bytes.Compare((*v)[i], key) >= 0
 	})
@@ -150,8 +638,32 @@ func (v *KeyList) in(key []byte) bool {
 	return (i < len(*v) && bytes.Equal((*v)[i], key))
 }
 
-func indexExists(it *badger.Iterator, typeName, indexName string) bool {
-	iPrefix := indexKeyPrefix(typeName, indexName)
+// reverseKeys reverses the order of the keys in place
+func reverseKeys(keys [][]byte) {
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+}
+
+// seekStart returns the key to seek to for the first key with the prefix.  A reverse iterator seeks to the last key
+// at or before the seek key, so it seeks to the prefix with its last byte incremented, which sorts after every key
+// with the prefix
+func seekStart(prefix []byte, reverse bool) []byte {
+	if !reverse {
+		return prefix
+	}
+
+	// trailing 0xFF bytes can't be incremented, so they're dropped
+	end := append([]byte{}, prefix...)
+	for end[len(end)-1] == 0xFF {
+		end = end[:len(end)-1]
+	}
+	end[len(end)-1]++
+	return end
+}
+
+func (s *Store) indexExists(it *badger.Iterator, typeName, indexName string) bool {
+	iPrefix := s.indexKeyPrefix(typeName, indexName)
 	tPrefix := typePrefix(typeName)
 	// test if any data exists for type
 	it.Seek(tPrefix)
@@ -179,6 +691,11 @@ type iterator struct {
 	lastSeek []byte
 	tx       *badger.Txn
 	err      error
+
+	// with a covering index, the encoded index values of the keys in keyCache, which are returned in place of the
+	// records
+	covering   bool
+	valueCache [][]byte
 }
 
 // iterBookmark stores a seek location in a specific iterator
@@ -188,7 +705,8 @@ type iterBookmark struct {
 	seekKey []byte
 }
 
-func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookmark *iterBookmark) *iterator {
+func (s *Store) newIterator(tx *badger.Txn, storer Storer, query *Query, bookmark *iterBookmark) *iterator {
+	typeName := storer.Type()
 	i := &iterator{
 		tx: tx,
 	}
@@ -202,20 +720,41 @@ func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookm
 	var prefix []byte
 
 	if query.index != "" {
-		query.badIndex = !indexExists(i.iter, typeName, query.index)
+		query.badIndex = !s.indexExists(i.iter, typeName, query.index)
+	}
+
+	// without a sort, Reverse reads the records in reverse order
+	reverse := query.reverse && len(query.sort) == 0 && bookmark == nil
+	if reverse {
+		i.iter.Close()
+		options := badger.DefaultIteratorOptions
+		options.Reverse = true
+		i.iter = tx.NewIterator(options)
 	}
 
 	criteria := query.fieldCriteria[query.index]
-	if hasMatchFunc(criteria) {
-		// can't use indexes on matchFuncs as the entire record isn't available for testing in the passed
-		// in function
+	if needsRecord(criteria) {
+		// can't use indexes on matchFuncs or field comparisons as the entire record isn't available for testing
+		// against the index
 		criteria = nil
 	}
 
+	query.recheckIndex = false
+	if stream := streamCriterion(criteria); stream != nil {
+		// other criteria on the field are tested against the records
+		query.recheckIndex = true
+		i.nextKeys = s.streamKeys(tx, storer, query.index, stream)
+		return i
+	}
+
+	if index, ok := storer.Indexes()[query.index]; ok && len(index.Columns) > 0 && len(criteria) == 0 {
+		return s.compositeIterator(i, storer, query, index, reverse)
+	}
+
 	// Key field or index not specified - test key against criteria (if it exists) or return everything
 	if query.index == "" || len(criteria) == 0 {
 		prefix = typePrefix(typeName)
-		i.iter.Seek(prefix)
+		i.iter.Seek(seekStart(prefix, reverse))
 		i.nextKeys = func(iter *badger.Iterator) ([][]byte, error) {
 			var nKeys [][]byte
 
@@ -238,7 +777,12 @@ func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookm
 						return s.decode(v, val.Interface())
 					})
 					if err != nil {
-						return nil, err
+						if err = query.decodeFailed(key, err); err != nil {
+							return nil, err
+						}
+						i.lastSeek = key
+						iter.Next()
+						continue
 					}
 
 					ok, err = s.matchesAllCriteria(criteria, key, true, typeName, val.Interface())
@@ -261,8 +805,28 @@ func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookm
 	}
 
 	// indexed field, get keys from index
-	prefix = indexKeyPrefix(typeName, query.index)
-	i.iter.Seek(prefix)
+	index := storer.Indexes()[query.index]
+	query.recheckIndex = index.Bucket > 0
+	if starts, ok := bucketStarts(criteria, index.Bucket); index.Bucket > 0 && ok {
+		// read each bucket in the range directly rather than scanning the index
+		done := false
+		i.nextKeys = func(iter *badger.Iterator) ([][]byte, error) {
+			if done {
+				return nil, nil
+			}
+			done = true
+			keys, err := s.fetchIndexValues(tx, storer, query.index, starts...)
+			if reverse {
+				reverseKeys(keys)
+			}
+			return keys, err
+		}
+		return i
+	}
+
+	i.covering = query.covering
+	prefix = s.indexKeyPrefix(typeName, query.index)
+	i.iter.Seek(seekStart(prefix, reverse))
 	i.nextKeys = func(iter *badger.Iterator) ([][]byte, error) {
 		var nKeys [][]byte
 
@@ -275,9 +839,19 @@ func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookm
 			key := item.KeyCopy(nil)
 			// no currentRow on indexes as it refers to multiple rows
 			// remove index prefix for matching
-			ok, err := s.matchesAllCriteria(criteria, key[len(prefix):], true, "", nil)
-			if err != nil {
-				return nil, err
+			value := index.value(key[len(prefix):])
+			var ok bool
+			var err error
+			if index.Bucket > 0 {
+				var start time.Time
+				// values that aren't times can't be ruled out by their bucket
+				ok = s.decode(index.value(key[len(prefix):]), &start) != nil ||
+					bucketMatches(criteria, start, index.Bucket)
+			} else {
+				ok, err = s.matchesAllCriteria(criteria, value, true, "", nil)
+				if err != nil {
+					return nil, err
+				}
 			}
 
 			if ok {
@@ -288,8 +862,16 @@ func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookm
 					if err != nil {
 						return err
 					}
+					if reverse {
+						reverseKeys(keys)
+					}
 
 					nKeys = append(nKeys, [][]byte(keys)...)
+					if i.covering {
+						for range keys {
+							i.valueCache = append(i.valueCache, value)
+						}
+					}
 					return nil
 				})
 				if err != nil {
@@ -308,6 +890,186 @@ func (s *Store) newIterator(tx *badger.Txn, typeName string, query *Query, bookm
 	return i
 }
 
+// compositeIterator reads the keys from the entries of a composite index starting with the values of the leading
+// columns the query tests for equality.  The entries of an ordered index are read from the start of the range of the
+// next column to its end
+func (s *Store) compositeIterator(i *iterator, storer Storer, query *Query, index Index, reverse bool) *iterator {
+	columns, next, criteria, err := s.compositePrefix(query, index)
+	if err != nil {
+		i.err = err
+		return i
+	}
+
+	prefix := s.indexKeyPrefix(storer.Type(), query.index)
+	for _, b := range columns {
+		if index.Descending {
+			b = ^b
+		}
+		prefix = append(prefix, b)
+	}
+
+	var lower, upper []byte
+	var lowerExcl, upperExcl bool
+	ordered := index.ordered && !index.Descending && next < len(index.Columns)
+	if ordered {
+		lower, upper, lowerExcl, upperExcl, err = orderedBounds(query, index.Columns[next], criteria)
+		if err != nil {
+			i.err = err
+			return i
+		}
+	} else if next != len(index.Columns)-1 {
+		// the encoded values of other columns can't be told apart from those of the columns after them
+		criteria = nil
+	}
+
+	switch {
+	case ordered && !reverse && lower != nil:
+		i.iter.Seek(append(append([]byte{}, prefix...), lower...))
+	case ordered && reverse && upper != nil:
+		i.iter.Seek(seekStart(append(append([]byte{}, prefix...), upper...), true))
+	default:
+		i.iter.Seek(seekStart(prefix, reverse))
+	}
+
+	done := false
+	i.nextKeys = func(iter *badger.Iterator) ([][]byte, error) {
+		var nKeys [][]byte
+
+		for !done && len(nKeys) < iteratorKeyMinCacheSize {
+			if !iter.ValidForPrefix(prefix) {
+				return nKeys, nil
+			}
+
+			item := iter.Item()
+			ok := true
+			if ordered {
+				position := orderedPosition(item.Key()[len(prefix):], lower, upper, lowerExcl, upperExcl)
+				if (position > 0 && !reverse) || (position < 0 && reverse) {
+					// past the end of the range
+					done = true
+					return nKeys, nil
+				}
+				ok = position == 0
+			} else if len(criteria) > 0 {
+				value := index.value(item.Key()[len(prefix)-len(columns):])
+				var err error
+				ok, err = s.matchesAllCriteria(criteria, value[len(columns):], true, "", nil)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if ok {
+				err := item.Value(func(v []byte) error {
+					var keys = make(KeyList, 0)
+					err := s.decode(v, &keys)
+					if err != nil {
+						return err
+					}
+					if reverse {
+						reverseKeys(keys)
+					}
+
+					nKeys = append(nKeys, [][]byte(keys)...)
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			i.lastSeek = item.KeyCopy(nil)
+			iter.Next()
+		}
+		return nKeys, nil
+	}
+
+	return i
+}
+
+// orderedPosition returns whether the rest of the key of an entry of an ordered composite index, starting with the
+// encoded value of the column the bounds are on, is before the range of the bounds (-1), in it (0), or after it (1).
+// The encoded values are never a prefix of each other, so only as many bytes as are in each bound are compared
+func orderedPosition(rest, lower, upper []byte, lowerExcl, upperExcl bool) int {
+	head := func(bound []byte) []byte {
+		if len(rest) < len(bound) {
+			return rest
+		}
+		return rest[:len(bound)]
+	}
+
+	if lower != nil {
+		if cmp := bytes.Compare(head(lower), lower); cmp < 0 || (cmp == 0 && lowerExcl) {
+			return -1
+		}
+	}
+	if upper != nil {
+		if cmp := bytes.Compare(head(upper), upper); cmp > 0 || (cmp == 0 && upperExcl) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// streamCriterion returns the first of the criteria reading its values from a stream, if there is one
+func streamCriterion(criteria []*Criterion) *Criterion {
+	for _, c := range criteria {
+		if c.operator == ins {
+			return c
+		}
+	}
+	return nil
+}
+
+// streamKeys returns the keys of the records with the values read from the stream of the criterion, looked up in
+// the index, or as keys if indexName is empty.  Records are only returned once, even if their value is repeated
+func (s *Store) streamKeys(tx *badger.Txn, storer Storer, indexName string,
+	c *Criterion) func(*badger.Iterator) ([][]byte, error) {
+	returned := make(map[string]struct{})
+
+	return func(*badger.Iterator) ([][]byte, error) {
+		var nKeys [][]byte
+
+		for len(nKeys) < iteratorKeyMinCacheSize {
+			value, ok := c.stream()
+			if !ok {
+				return nKeys, nil
+			}
+
+			var keys KeyList
+			if indexName == "" {
+				key, err := s.encodeKey(value, storer.Type())
+				if err != nil {
+					return nil, err
+				}
+				_, err = tx.Get(key)
+				if err == badger.ErrKeyNotFound {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				keys = KeyList{key}
+			} else {
+				var err error
+				keys, err = s.fetchIndexValues(tx, storer, indexName, value)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			for _, key := range keys {
+				if _, ok := returned[string(key)]; ok {
+					continue
+				}
+				returned[string(key)] = struct{}{}
+				nKeys = append(nKeys, key)
+			}
+		}
+		return nKeys, nil
+	}
+}
+
 func (i *iterator) createBookmark() *iterBookmark {
 	return &iterBookmark{
 		iter:    i.iter,
@@ -340,6 +1102,12 @@ func (i *iterator) Next() (key []byte, value []byte) {
 	key = i.keyCache[0]
 	i.keyCache = i.keyCache[1:]
 
+	if i.covering {
+		value = i.valueCache[0]
+		i.valueCache = i.valueCache[1:]
+		return
+	}
+
 	item, err := i.tx.Get(key)
 	if err != nil {
 		i.err = err
@@ -0,0 +1,124 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/timshannon/badgerhold/v4"
+)
+
+type CompositeStorer struct {
+	Name    string
+	Active  bool
+	Updated time.Time
+	Score   int
+}
+
+func (c *CompositeStorer) Type() string { return "CompositeStorer" }
+func (c *CompositeStorer) Indexes() map[string]badgerhold.Index {
+	return map[string]badgerhold.Index{
+		"Active_Updated":        badgerhold.CompositeIndex(badgerhold.DefaultEncode, "Active", "Updated"),
+		"OrderedActive_Updated": badgerhold.OrderedCompositeIndex("Active", "Updated"),
+		"OrderedName_Score":     badgerhold.OrderedCompositeIndex("Name", "Score"),
+		"OrderedScore_Active":   badgerhold.OrderedCompositeIndex("Score", "Active"),
+	}
+}
+
+func TestCompositeIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 20; i++ {
+			ok(t, store.Insert(i, &CompositeStorer{
+				Name:    fmt.Sprintf("record %d", i%12),
+				Active:  i%3 != 0,
+				Updated: start.Add(time.Duration(i*7%20) * time.Hour),
+				Score:   i*7%20 - 10,
+			}))
+		}
+		cutoff := start.Add(10 * time.Hour)
+
+		names := func(query *badgerhold.Query) []string {
+			var result []CompositeStorer
+			ok(t, store.Find(&result, query))
+			found := []string{}
+			for i := range result {
+				found = append(found, fmt.Sprintf("%s %d", result[i].Name, result[i].Score))
+			}
+			sort.Strings(found)
+			return found
+		}
+
+		tests := []struct {
+			name    string
+			indexes []string
+			query   func() *badgerhold.Query
+		}{
+			{"Equal and range", []string{"Active_Updated", "OrderedActive_Updated"}, func() *badgerhold.Query {
+				return badgerhold.Where("Active").Eq(true).And("Updated").Ge(cutoff)
+			}},
+			{"Equal and bounded range", []string{"Active_Updated", "OrderedActive_Updated"},
+				func() *badgerhold.Query {
+					return badgerhold.Where("Active").Eq(false).And("Updated").Gt(start).And("Updated").Lt(cutoff)
+				}},
+			{"All columns equal", []string{"Active_Updated", "OrderedActive_Updated"}, func() *badgerhold.Query {
+				return badgerhold.Where("Active").Eq(true).And("Updated").Eq(start.Add(7 * time.Hour))
+			}},
+			{"Leading column only", []string{"Active_Updated", "OrderedActive_Updated"}, func() *badgerhold.Query {
+				return badgerhold.Where("Active").Eq(false).And("Name").Ne("record 3")
+			}},
+			{"Trailing column only", []string{"Active_Updated", "OrderedActive_Updated"}, func() *badgerhold.Query {
+				return badgerhold.Where("Updated").Le(cutoff)
+			}},
+			{"Negative range", []string{"OrderedScore_Active"}, func() *badgerhold.Query {
+				return badgerhold.Where("Score").Ge(-7).And("Score").Le(2)
+			}},
+			{"Range on the leading column", []string{"OrderedScore_Active"}, func() *badgerhold.Query {
+				return badgerhold.Where("Score").Gt(-3).And("Active").Eq(true)
+			}},
+			{"String prefix of another value", []string{"OrderedName_Score"}, func() *badgerhold.Query {
+				return badgerhold.Where("Name").Eq("record 1").And("Score").Lt(5)
+			}},
+			{"Exclusive lower bound", []string{"OrderedName_Score"}, func() *badgerhold.Query {
+				return badgerhold.Where("Name").Eq("record 1").And("Score").Gt(-3).And("Score").Le(1)
+			}},
+			{"Exclusive upper bound", []string{"OrderedName_Score"}, func() *badgerhold.Query {
+				return badgerhold.Where("Name").Eq("record 1").And("Score").Ge(-3).And("Score").Lt(1)
+			}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				expected := names(tst.query())
+				assert(t, len(expected) > 0, "No records matched")
+				for _, index := range tst.indexes {
+					equals(t, expected, names(tst.query().Index(index)))
+					equals(t, expected, names(tst.query().Index(index).Reverse()))
+				}
+			})
+		}
+	})
+}
+
+func TestOrderedCompositeIndexOrder(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		scores := []int{5, -20, 0, 13, -1, 7, -8}
+		for i, score := range scores {
+			ok(t, store.Insert(i, &CompositeStorer{Name: "same", Score: score}))
+		}
+
+		// without a sort, results are returned in the order of the index
+		var result []CompositeStorer
+		ok(t, store.Find(&result, badgerhold.Where("Name").Eq("same").And("Score").Ge(-8).Index("OrderedName_Score")))
+		found := []int{}
+		for i := range result {
+			found = append(found, result[i].Score)
+		}
+		equals(t, []int{-8, -1, 0, 5, 7, 13}, found)
+	})
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ForEachIndexRange runs fn against the records of dataType with values in the index from from, inclusive, to to,
+// exclusive, passing them in batches of up to batch records.  Each record in a batch is a pointer to a new value of
+// dataType.  A nil from or to leaves that end of the range open.  As the ranges don't overlap, the records of a
+// large type can be split between workers by the values of an index, such as with the boundaries from
+// IndexBoundaries:
+//
+//	bounds, err := store.IndexBoundaries(&Item{}, "Category", workers)
+//	...
+//	for i := 0; i <= len(bounds); i++ {
+//		var from, to interface{}
+//		if i > 0 {
+//			from = bounds[i-1]
+//		}
+//		if i < len(bounds) {
+//			to = bounds[i]
+//		}
+//		go store.ForEachIndexRange(&Item{}, "Category", from, to, 1000, process)
+//	}
+//
+// from and to must be the same type as the values of the index
+func (s *Store) ForEachIndexRange(dataType interface{}, indexName string, from, to interface{}, batch int,
+	fn func(records []interface{}) error) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxForEachIndexRange(tx, dataType, indexName, from, to, batch, fn)
+	})
+}
+
+// TxForEachIndexRange is the same as ForEachIndexRange but you get to specify your transaction
+func (s *Store) TxForEachIndexRange(tx *badger.Txn, dataType interface{}, indexName string, from, to interface{},
+	batch int, fn func(records []interface{}) error) error {
+	if batch < 1 {
+		return errors.New("The batch size must be at least 1")
+	}
+	if _, ok := s.newStorer(dataType).Indexes()[indexName]; !ok {
+		return fmt.Errorf("The index %s does not exist", indexName)
+	}
+
+	query := &Query{fieldCriteria: make(map[string][]*Criterion)}
+	if from != nil {
+		query.And(indexName).Ge(from)
+	}
+	if to != nil {
+		query.And(indexName).Lt(to)
+	}
+	query.Index(indexName)
+
+	keyField, hasKeyField := getKeyField(dereference(reflect.TypeOf(dataType)))
+	typeName := s.newStorer(dataType).Type()
+
+	records := make([]interface{}, 0, batch)
+	err := s.runQuery(tx, dataType, query, nil, 0, func(r *record) error {
+		if hasKeyField {
+			err := s.decodeKey(r.key, r.value.Elem().FieldByName(keyField.Name).Addr().Interface(), typeName)
+			if err != nil {
+				return err
+			}
+		}
+
+		records = append(records, r.value.Interface())
+		if len(records) < batch {
+			return nil
+		}
+		err := fn(records)
+		records = make([]interface{}, 0, batch)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	return fn(records)
+}
+
+// IndexBoundaries returns the values that split the records of dataType into parts ranges of the index of about
+// the same number of records each, in order, to pass as the from and to of ForEachIndexRange.  The records with the
+// same value are never split between ranges, so fewer boundaries are returned if there aren't enough distinct
+// values.  Only indexes on fields of the type have values that can be read
+func (s *Store) IndexBoundaries(dataType interface{}, indexName string, parts int) ([]interface{}, error) {
+	var bounds []interface{}
+	err := s.view(func(tx *badger.Txn) error {
+		var err error
+		bounds, err = s.TxIndexBoundaries(tx, dataType, indexName, parts)
+		return err
+	})
+	return bounds, err
+}
+
+// TxIndexBoundaries is the same as IndexBoundaries but you get to specify your transaction
+func (s *Store) TxIndexBoundaries(tx *badger.Txn, dataType interface{}, indexName string,
+	parts int) ([]interface{}, error) {
+	if parts < 1 {
+		return nil, errors.New("The number of parts must be at least 1")
+	}
+
+	storer := s.newStorer(dataType)
+	if _, ok := storer.Indexes()[indexName]; !ok {
+		return nil, fmt.Errorf("The index %s does not exist", indexName)
+	}
+	field, ok := dereference(reflect.TypeOf(dataType)).FieldByName(indexName)
+	if !ok {
+		return nil, fmt.Errorf("The index %s isn't on a field of the type, so its values can't be read", indexName)
+	}
+
+	entries, err := s.sortedIndexEntries(tx, storer, indexName, field.Type, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int, len(entries))
+	total := 0
+	for i := range entries {
+		item, err := tx.Get(entries[i].key)
+		if err != nil {
+			return nil, err
+		}
+		var keys KeyList
+		err = item.Value(func(val []byte) error {
+			return s.decode(val, &keys)
+		})
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = len(keys)
+		total += counts[i]
+	}
+
+	var bounds []interface{}
+	seen := 0
+	for i := range entries {
+		next := len(bounds) + 1
+		if next == parts {
+			break
+		}
+		// a range can only end where the value changes
+		if seen >= next*total/parts && i > 0 && sortCompare(entries[i-1].value, entries[i].value) != 0 {
+			bounds = append(bounds, entries[i].value)
+		}
+		seen += counts[i]
+	}
+	return bounds, nil
+}
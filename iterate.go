@@ -0,0 +1,164 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"reflect"
+)
+
+// TypedIterator is a type safe cursor over the results of a query, with each record decoded into a T as it's read:
+//
+//	records, err := badgerhold.Iterate[Item](store, query)
+//	if err != nil {
+//		return err
+//	}
+//	defer records.Close()
+//	for item, ok := records.Next(); ok; item, ok = records.Next() {
+//		...
+//	}
+//	return records.Err()
+type TypedIterator[T interface{}] struct {
+	stream *ResultStream
+	err    error
+}
+
+// Iterate runs the query against the records of type T, returning an iterator which decodes each matching record
+// as it's read, instead of reading every record into a slice first.  The same rules apply as for FindStream: the
+// query runs in its own read transaction, which stays open until every record has been read or the iterator is
+// closed, so the iterator must always be closed
+func Iterate[T interface{}](s *Store, query *Query) (*TypedIterator[T], error) {
+	// T may itself be a pointer, so query with a pointer to the underlying type
+	dataType := reflect.New(dereference(reflect.TypeOf((*T)(nil)).Elem())).Interface()
+
+	stream, err := s.FindStream(dataType, query, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedIterator[T]{stream: stream}, nil
+}
+
+// Next returns the next record, and false if there are no more records or the query failed, which is reported by Err
+func (i *TypedIterator[T]) Next() (T, bool) {
+	var value T
+	if i.err != nil || !i.stream.Next() {
+		return value, false
+	}
+
+	err := i.stream.Scan(&value)
+	if err != nil {
+		i.err = err
+		i.stream.Close()
+		return value, false
+	}
+	return value, true
+}
+
+// Err returns the error, if any, that stopped the query or decoding a record.  Only valid after Next returns false
+func (i *TypedIterator[T]) Err() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.stream.Err()
+}
+
+// Close stops the query if it's still running and ends its transaction.  Returns the error that stopped the
+// iterator, if any.  Close can be called more than once
+func (i *TypedIterator[T]) Close() error {
+	err := i.stream.Close()
+	if i.err != nil {
+		return i.err
+	}
+	return err
+}
+
+// Cursor is a cursor over the results of a query, which reads the records as Next moves through them, rather than
+// reading every record up front:
+//
+//	cursor, err := store.Iterator(query, &Item{})
+//	if err != nil {
+//		return err
+//	}
+//	defer cursor.Close()
+//	for cursor.Next() {
+//		var item Item
+//		err = cursor.Scan(&item)
+//		...
+//	}
+//	return cursor.Err()
+type Cursor struct {
+	stream    *ResultStream
+	decodeKey func(key []byte) (interface{}, error)
+	keyErr    error
+	err       error
+}
+
+// Iterator runs the query against the records of dataType, returning a cursor over the matching records.  The query's
+// criteria, sort, skip and limit are applied as they are by Find, but at most one record is read ahead of the cursor,
+// and nothing more is read once the cursor is closed.  The query runs in its own read transaction, which stays
+// open until every record has been read or the cursor is closed, so the cursor must always be closed
+func (s *Store) Iterator(query *Query, dataType interface{}) (*Cursor, error) {
+	stream, err := s.FindStream(dataType, query, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &Cursor{stream: stream}
+	// types without a key field can still be read, only Key fails
+	cursor.decodeKey, cursor.keyErr = s.keyDecoder(dataType)
+	return cursor, nil
+}
+
+// Next moves the cursor to the next record.  Returns false when there are no more records or the query failed,
+// which is reported by Err
+func (c *Cursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	return c.stream.Next()
+}
+
+// Scan decodes the current record into dest, which must be a pointer to the type being queried.  If the type has
+// a field tagged as the key, it's set to the record's key
+func (c *Cursor) Scan(dest interface{}) error {
+	return c.stream.Scan(dest)
+}
+
+// Key returns the key of the current record, decoded into the type of the key field of the type being queried.
+// Returns nil if there's no current record or the key can't be decoded, which stops the cursor with the error
+// reported by Err
+func (c *Cursor) Key() interface{} {
+	if c.stream.current == nil || c.err != nil {
+		return nil
+	}
+	if c.keyErr != nil {
+		c.err = c.keyErr
+		return nil
+	}
+
+	key, err := c.decodeKey(c.stream.current.key)
+	if err != nil {
+		c.err = err
+		return nil
+	}
+	return key
+}
+
+// Err returns the error, if any, that stopped the query or decoding a key.  Only valid after Next returns false
+func (c *Cursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.stream.Err()
+}
+
+// Close stops the query if it's still running and ends its transaction.  Returns the error that stopped the
+// cursor, if any.  Close can be called more than once
+func (c *Cursor) Close() error {
+	err := c.stream.Close()
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
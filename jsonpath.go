@@ -0,0 +1,128 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONPath tests the value found at the path in a field containing a JSON document, rather than the field itself.
+// The field can be a []byte, json.RawMessage or string.  Paths start at the root of the document ($), and
+// can contain object members and array indexes:
+//
+//	badgerhold.Where("Doc").JSONPath("$.status").Eq("active")
+//	badgerhold.Where("Doc").JSONPath("$.items[0].name").Eq("first")
+//
+// The document is parsed for every record tested, so this is much slower than querying a regular field. Values
+// are decoded with encoding/json, so numbers are always float64.  Records where the path doesn't exist don't match
+// (except for IsNil).  Will panic if the path is invalid
+func (c *Criterion) JSONPath(path string) *Criterion {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	c.jsonPath = path
+	c.jsonSegments = segments
+	return c
+}
+
+// parseJSONPath splits a path into object member names (strings) and array indexes (ints)
+func parseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("The JSON path %s must start with $", path)
+	}
+
+	segments := []interface{}{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("The JSON path %s contains an empty member name", path)
+			}
+			segments = append(segments, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("The JSON path %s has an unclosed [", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("The JSON path %s has an invalid array index %s", path, rest[1:end])
+			}
+			segments = append(segments, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("The JSON path %s is invalid at %s", path, rest)
+		}
+	}
+
+	return segments, nil
+}
+
+// jsonPathValue returns the value at the path in the JSON document, and whether the path exists
+func jsonPathValue(document interface{}, path []interface{}) (interface{}, bool, error) {
+	var data []byte
+
+	docVal := reflect.ValueOf(document)
+	for docVal.Kind() == reflect.Ptr {
+		if docVal.IsNil() {
+			return nil, false, nil
+		}
+		docVal = docVal.Elem()
+	}
+
+	switch {
+	case docVal.Kind() == reflect.String:
+		data = []byte(docVal.String())
+	case docVal.Kind() == reflect.Slice && docVal.Type().Elem().Kind() == reflect.Uint8:
+		data = docVal.Bytes()
+	default:
+		return nil, false, fmt.Errorf("JSONPath can't be used on a field of type %s", docVal.Type())
+	}
+
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, segment := range path {
+		switch segment := segment.(type) {
+		case string:
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			value, ok = obj[segment]
+			if !ok {
+				return nil, false, nil
+			}
+		case int:
+			arr, ok := value.([]interface{})
+			if !ok || segment >= len(arr) {
+				return nil, false, nil
+			}
+			value = arr[segment]
+		}
+	}
+
+	return value, true, nil
+}
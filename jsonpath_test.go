@@ -0,0 +1,81 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/timshannon/badgerhold/v4"
+)
+
+type JSONDocument struct {
+	Name string
+	Doc  []byte
+	Raw  json.RawMessage
+	Text string
+}
+
+func TestJSONPath(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		docs := []JSONDocument{
+			{Name: "active", Doc: []byte(`{"status": "active", "count": 3, "items": [{"name": "first"}]}`)},
+			{Name: "inactive", Doc: []byte(`{"status": "inactive", "count": 10, "items": []}`)},
+			{Name: "null", Doc: []byte(`{"status": null}`)},
+			{Name: "empty"},
+			{Name: "raw", Raw: json.RawMessage(`{"status": "active"}`), Text: `["a", "b"]`},
+		}
+
+		for i := range docs {
+			ok(t, store.Insert(i, docs[i]))
+		}
+
+		tests := []struct {
+			name   string
+			query  *badgerhold.Query
+			result []string
+		}{
+			{"Eq", badgerhold.Where("Doc").JSONPath("$.status").Eq("active"), []string{"active"}},
+			{"Ne", badgerhold.Where("Doc").JSONPath("$.status").Ne("active"), []string{"inactive"}},
+			{"Number", badgerhold.Where("Doc").JSONPath("$.count").Gt(5.0), []string{"inactive"}},
+			{"Array", badgerhold.Where("Doc").JSONPath("$.items[0].name").Eq("first"), []string{"active"}},
+			{"In", badgerhold.Where("Doc").JSONPath("$.status").In("active", "inactive"),
+				[]string{"active", "inactive"}},
+			{"IsNil", badgerhold.Where("Doc").JSONPath("$.status").IsNil(), []string{"null", "empty", "raw"}},
+			{"RawMessage", badgerhold.Where("Raw").JSONPath("$.status").Eq("active"), []string{"raw"}},
+			{"String", badgerhold.Where("Text").JSONPath("$[1]").Eq("b"), []string{"raw"}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				var result []JSONDocument
+				ok(t, store.Find(&result, tst.query))
+
+				names := make([]string, len(result))
+				for i := range result {
+					names[i] = result[i].Name
+				}
+				equals(t, tst.result, names)
+			})
+		}
+
+		var result []JSONDocument
+		err := store.Find(&result, badgerhold.Where("Name").JSONPath("$.status").Eq("active"))
+		assert(t, err != nil, "JSONPath on a field containing invalid JSON did not return an error")
+	})
+}
+
+func TestJSONPathInvalid(t *testing.T) {
+	for _, path := range []string{"status", "$.", "$.items[", "$.items[-1]", "$status"} {
+		t.Run(path, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("Invalid JSON path %s did not panic!", path)
+				}
+			}()
+			badgerhold.Where("Doc").JSONPath(path).Eq("active")
+		})
+	}
+}
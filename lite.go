@@ -0,0 +1,45 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// RegisterLite declares liteType as a lighter version of fullType, such as one that leaves out its large slice
+// fields, so GetLite can read fullType records into it without decoding the fields it leaves out.  The fields of
+// liteType are matched to those of fullType by name, so this only works with encoders that skip the fields the
+// value being decoded into doesn't have, such as JSON.  Will panic if either type isn't a struct
+func (s *Store) RegisterLite(fullType, liteType interface{}) {
+	full := dereference(reflect.TypeOf(fullType))
+	lite := dereference(reflect.TypeOf(liteType))
+	if full.Kind() != reflect.Struct || lite.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("RegisterLite needs struct types, not %s and %s", full, lite))
+	}
+
+	s.lites.Store(lite, full)
+}
+
+// GetLite is the same as Get, but reads the record of the full type that liteResult's type was registered for with
+// RegisterLite into liteResult
+func (s *Store) GetLite(key, liteResult interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxGetLite(tx, key, liteResult)
+	})
+}
+
+// TxGetLite is the same as GetLite but you get to specify your transaction
+func (s *Store) TxGetLite(tx *badger.Txn, key, liteResult interface{}) error {
+	lite := dereference(reflect.TypeOf(liteResult))
+	full, ok := s.lites.Load(lite)
+	if !ok {
+		return fmt.Errorf("The type %s has not been registered with RegisterLite", lite)
+	}
+
+	return s.get(tx, s.newStorer(reflect.New(full.(reflect.Type)).Interface()), key, liteResult)
+}
@@ -0,0 +1,386 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// the names of the operators of criteria in the JSON form of a query
+var operatorNames = map[int]string{
+	eq:       "eq",
+	ne:       "ne",
+	gt:       "gt",
+	lt:       "lt",
+	ge:       "ge",
+	le:       "le",
+	in:       "in",
+	isnil:    "isNil",
+	sw:       "hasPrefix",
+	ew:       "hasSuffix",
+	hk:       "hasKey",
+	bp:       "bytesPrefix",
+	wd:       "weekday",
+	mo:       "month",
+	hb:       "hourBetween",
+	ball:     "hasBits",
+	bany:     "hasAnyBits",
+	contains: "contains",
+	any:      "containsAny",
+	all:      "containsAll",
+	subset:   "subsetOf",
+	cm:       "containsMatch",
+}
+
+// operatorByName returns the operator with the name used in the JSON form of a query
+func operatorByName(name string) (int, bool) {
+	for op := range operatorNames {
+		if operatorNames[op] == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+type queryJSON struct {
+	Criteria   map[string][]criterionJSON `json:"criteria,omitempty"`
+	Or         []*Query                   `json:"or,omitempty"`
+	Index      string                     `json:"index,omitempty"`
+	NoIndex    bool                       `json:"noIndex,omitempty"`
+	AutoIndex  bool                       `json:"autoIndex,omitempty"`
+	Sort       []string                   `json:"sort,omitempty"`
+	Distinct   []string                   `json:"distinct,omitempty"`
+	SizeGt     int                        `json:"sizeGt,omitempty"`
+	Reverse    bool                       `json:"reverse,omitempty"`
+	Skip       int                        `json:"skip,omitempty"`
+	Limit      int                        `json:"limit,omitempty"`
+	MaxResults int                        `json:"maxResults,omitempty"`
+	Fields     []string                   `json:"fields,omitempty"`
+}
+
+type criterionJSON struct {
+	Operator string      `json:"op"`
+	JSONPath string      `json:"jsonPath,omitempty"`
+	Value    *valueJSON  `json:"value,omitempty"`
+	Values   []valueJSON `json:"values,omitempty"`
+}
+
+// valueJSON is a criterion value along with its type, as criteria only match values of the same type
+type valueJSON struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalJSON encodes the query as JSON, so it can be saved and loaded again later with UnmarshalJSON, such as for
+// saved filters.  The criteria, or'd queries, index, sort, distinct fields, size, reverse, skip, limit, max
+// results and fields are encoded.
+// Criteria are only encoded if their values are strings, bools, numbers, []byte, Field, time.Time,
+// time.Duration, time.Weekday or time.Month, and their operators are any but MatchFunc, EqFunc, RegExp,
+// RegExpString and InStream.  The query of a ContainsMatch criterion is encoded along with it.  An error is returned
+// for criteria that can't be encoded, values from a ValueFunc, and queries with a Collate or Having func
+func (q *Query) MarshalJSON() ([]byte, error) {
+	if q.collator != nil || q.having != nil {
+		return nil, errors.New("The query can't be marshalled, as it has a Collate or Having func")
+	}
+
+	result := queryJSON{
+		Or:         q.ors,
+		Index:      q.index,
+		NoIndex:    q.noIndex,
+		AutoIndex:  q.autoIndex,
+		Sort:       q.sort,
+		Distinct:   q.distinct,
+		SizeGt:     q.sizeGt,
+		Reverse:    q.reverse,
+		Skip:       q.skip,
+		Limit:      q.limit,
+		MaxResults: q.maxResults,
+		Fields:     q.fields,
+	}
+
+	if len(q.fieldCriteria) > 0 {
+		result.Criteria = make(map[string][]criterionJSON, len(q.fieldCriteria))
+	}
+	for field, criteria := range q.fieldCriteria {
+		for _, c := range criteria {
+			encoded, err := c.marshal()
+			if err != nil {
+				return nil, fmt.Errorf("The criterion %s on the field %s can't be marshalled: %s", c, field, err)
+			}
+			result.Criteria[field] = append(result.Criteria[field], encoded)
+		}
+	}
+
+	return json.Marshal(result)
+}
+
+// UnmarshalJSON sets the query to the query encoded by MarshalJSON.  The JSON is checked the same way as a query
+// built with AndWhere, so saved filters from untrusted input return an error rather than panicking when run
+func (q *Query) UnmarshalJSON(data []byte) error {
+	var decoded queryJSON
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	if decoded.Skip < 0 || decoded.Limit < 0 || decoded.MaxResults < 0 {
+		return errors.New("The skip, limit and max results of a query must be positive numbers")
+	}
+	for i := range decoded.Sort {
+		if decoded.Sort[i] == Key {
+			return errors.New("Cannot sort by Key")
+		}
+	}
+	for i := range decoded.Distinct {
+		if decoded.Distinct[i] == Key {
+			return errors.New("Cannot use Key with DistinctBy, as keys are already distinct")
+		}
+	}
+	for _, or := range decoded.Or {
+		if or == nil {
+			return errors.New("Or'd queries cannot be null")
+		}
+		if or.skip != 0 || or.limit != 0 || len(or.sort) > 0 {
+			return errors.New("Or'd queries cannot contain skip, limit or sort values")
+		}
+	}
+
+	result := Query{
+		fieldCriteria: make(map[string][]*Criterion, len(decoded.Criteria)),
+		ors:           decoded.Or,
+		index:         decoded.Index,
+		noIndex:       decoded.NoIndex,
+		autoIndex:     decoded.AutoIndex,
+		sort:          decoded.Sort,
+		distinct:      decoded.Distinct,
+		sizeGt:        decoded.SizeGt,
+		reverse:       decoded.Reverse,
+		skip:          decoded.Skip,
+		limit:         decoded.Limit,
+		maxResults:    decoded.MaxResults,
+		fields:        decoded.Fields,
+	}
+
+	for field, criteria := range decoded.Criteria {
+		if !startsUpper(field) {
+			return fmt.Errorf("The field %s must start with an upper-case letter", field)
+		}
+		for i := range criteria {
+			err = criteria[i].unmarshal(&result, field)
+			if err != nil {
+				return fmt.Errorf("The criterion on the field %s can't be unmarshalled: %s", field, err)
+			}
+		}
+	}
+
+	*q = result
+	return nil
+}
+
+func (c *Criterion) marshal() (criterionJSON, error) {
+	name, ok := operatorNames[c.operator]
+	if !ok {
+		return criterionJSON{}, fmt.Errorf("the operator is not serializable")
+	}
+	if c.stored != nil {
+		return criterionJSON{}, fmt.Errorf("values from a StoredValue are not serializable")
+	}
+	if c.lazyValue != nil || c.lazyValues != nil {
+		return criterionJSON{}, fmt.Errorf("values from a ValueFunc are not serializable")
+	}
+
+	result := criterionJSON{
+		Operator: name,
+		JSONPath: c.jsonPath,
+	}
+
+	// a nil value is still encoded for operators that take one, such as Eq(nil), so the value count can be checked
+	// when the criterion is unmarshalled
+	if c.value != nil || (c.operator != isnil && !takesValues(c.operator)) {
+		value, err := marshalValue(c.value)
+		if err != nil {
+			return criterionJSON{}, err
+		}
+		result.Value = &value
+	}
+
+	for i := range c.values {
+		value, err := marshalValue(c.values[i])
+		if err != nil {
+			return criterionJSON{}, err
+		}
+		result.Values = append(result.Values, value)
+	}
+
+	return result, nil
+}
+
+// unmarshal adds the criterion to the query on the field, with AndWhere, so its values are checked the same way
+func (c criterionJSON) unmarshal(query *Query, field string) error {
+	var values []interface{}
+	if c.Value != nil {
+		value, err := c.Value.unmarshal()
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+
+	for i := range c.Values {
+		value, err := c.Values[i].unmarshal()
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+
+	var segments []interface{}
+	if c.JSONPath != "" {
+		var err error
+		segments, err = parseJSONPath(c.JSONPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := query.AndWhere(field, c.Operator, values...)
+	if err != nil {
+		return err
+	}
+
+	if c.JSONPath != "" {
+		criteria := query.fieldCriteria[field]
+		criteria[len(criteria)-1].jsonPath = c.JSONPath
+		criteria[len(criteria)-1].jsonSegments = segments
+	}
+	return nil
+}
+
+// marshalValue encodes the value along with its type
+func marshalValue(value interface{}) (valueJSON, error) {
+	var tp string
+	switch value.(type) {
+	case string:
+		tp = "string"
+	case bool:
+		tp = "bool"
+	case int:
+		tp = "int"
+	case int8:
+		tp = "int8"
+	case int16:
+		tp = "int16"
+	case int32:
+		tp = "int32"
+	case int64:
+		tp = "int64"
+	case uint:
+		tp = "uint"
+	case uint8:
+		tp = "uint8"
+	case uint16:
+		tp = "uint16"
+	case uint32:
+		tp = "uint32"
+	case uint64:
+		tp = "uint64"
+	case float32:
+		tp = "float32"
+	case float64:
+		tp = "float64"
+	case []byte:
+		tp = "bytes"
+	case Field:
+		tp = "field"
+	case time.Time:
+		tp = "time"
+	case time.Duration:
+		tp = "duration"
+	case time.Weekday:
+		tp = "weekday"
+	case time.Month:
+		tp = "month"
+	case *Query:
+		tp = "query"
+	case nil:
+		tp = "nil"
+	default:
+		return valueJSON{}, fmt.Errorf("values of type %T are not serializable", value)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return valueJSON{}, err
+	}
+	return valueJSON{Type: tp, Value: encoded}, nil
+}
+
+// unmarshal decodes the value into its original type
+func (v valueJSON) unmarshal() (interface{}, error) {
+	var value interface{}
+	switch v.Type {
+	case "string":
+		value = new(string)
+	case "bool":
+		value = new(bool)
+	case "int":
+		value = new(int)
+	case "int8":
+		value = new(int8)
+	case "int16":
+		value = new(int16)
+	case "int32":
+		value = new(int32)
+	case "int64":
+		value = new(int64)
+	case "uint":
+		value = new(uint)
+	case "uint8":
+		value = new(uint8)
+	case "uint16":
+		value = new(uint16)
+	case "uint32":
+		value = new(uint32)
+	case "uint64":
+		value = new(uint64)
+	case "float32":
+		value = new(float32)
+	case "float64":
+		value = new(float64)
+	case "bytes":
+		value = new([]byte)
+	case "field":
+		value = new(Field)
+	case "time":
+		value = new(time.Time)
+	case "duration":
+		value = new(time.Duration)
+	case "weekday":
+		value = new(time.Weekday)
+	case "month":
+		value = new(time.Month)
+	case "nil":
+		return nil, nil
+	case "query":
+		query := &Query{}
+		err := json.Unmarshal(v.Value, query)
+		if err != nil {
+			return nil, err
+		}
+		return query, nil
+	default:
+		return nil, fmt.Errorf("the value type %q is not recognized", v.Type)
+	}
+
+	err := json.Unmarshal(v.Value, value)
+	if err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(value).Elem().Interface(), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/timshannon/badgerhold/v4"
+)
+
+func TestQueryMarshalJSON(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		queries := []func() *badgerhold.Query{
+			func() *badgerhold.Query { return badgerhold.Where("Category").Eq("animal").SortBy("Name").Reverse() },
+			func() *badgerhold.Query {
+				return badgerhold.Where("Category").In("food", "vehicle").Index("Category").Skip(1).Limit(4)
+			},
+			func() *badgerhold.Query {
+				return badgerhold.Where(badgerhold.Key).Gt(5).And("Created").Lt(time.Now()).
+					Or(badgerhold.Where("Name").HasPrefix("pi"))
+			},
+			func() *badgerhold.Query { return badgerhold.Where("Tags").ContainsAny("takeout", "healthy") },
+			func() *badgerhold.Query { return badgerhold.Where("ID").Eq(badgerhold.Field("Key")) },
+			func() *badgerhold.Query { return badgerhold.Where("Created").Weekday(time.Saturday, time.Sunday) },
+			func() *badgerhold.Query { return badgerhold.Where("MapVal").IsNil().Or(badgerhold.Where("Key").Le(2)) },
+			func() *badgerhold.Query { return badgerhold.Where("Created").HourBetween(9, 17) },
+		}
+
+		for _, query := range queries {
+			data, err := json.Marshal(query())
+			ok(t, err)
+
+			loaded := &badgerhold.Query{}
+			ok(t, json.Unmarshal(data, loaded))
+
+			var expected, result []ItemTest
+			ok(t, store.Find(&expected, query()))
+			ok(t, store.Find(&result, loaded))
+			equals(t, expected, result)
+		}
+
+		// nil values are kept, rather than dropped as a missing value
+		data, err := json.Marshal(badgerhold.Where("MapVal").Eq(nil))
+		ok(t, err)
+		loaded := &badgerhold.Query{}
+		ok(t, json.Unmarshal(data, loaded))
+		equals(t, badgerhold.Where("MapVal").Eq(nil).String(), loaded.String())
+
+		type LineItem struct {
+			SKU      string
+			Quantity int
+		}
+		type Order struct {
+			Items []LineItem
+		}
+
+		ok(t, store.Insert(1, &Order{Items: []LineItem{{"A", 1}, {"B", 3}}}))
+		ok(t, store.Insert(2, &Order{Items: []LineItem{{"B", 1}}}))
+
+		data, err = json.Marshal(badgerhold.Where("Items").ContainsMatch(
+			badgerhold.Where("SKU").Eq("B").And("Quantity").Gt(1)))
+		ok(t, err)
+		loaded = &badgerhold.Query{}
+		ok(t, json.Unmarshal(data, loaded))
+
+		var orders []Order
+		ok(t, store.Find(&orders, loaded))
+		equals(t, 1, len(orders))
+		equals(t, "A", orders[0].Items[0].SKU)
+
+		unserializable := []*badgerhold.Query{
+			badgerhold.Where("Name").MatchFunc(func(ra *badgerhold.RecordAccess) (bool, error) { return true, nil }),
+			badgerhold.Where("Name").RegExp(regexp.MustCompile("fox")),
+			badgerhold.Where("Items").ContainsMatch(badgerhold.Where("SKU").RegExp(regexp.MustCompile("B"))),
+			badgerhold.Where("Created").Lt(badgerhold.Now()),
+			badgerhold.Where("Name").Eq(struct{ A int }{1}),
+			badgerhold.Where("Name").Eq("fox").Or(badgerhold.Where("Name").RegExp(regexp.MustCompile("fox"))),
+			badgerhold.Where("Name").Eq("fox").SortBy("Name").Collate(func(a, b string) int { return 0 }),
+		}
+		for _, query := range unserializable {
+			_, err := json.Marshal(query)
+			assert(t, err != nil, "Marshalling "+query.String()+" did not return an error")
+		}
+
+		for _, data := range []string{
+			`{"criteria": {"Name": [{"op": "matches", "value": {"type": "string", "value": "fox"}}]}}`,
+			`{"criteria": {"Name": [{"op": "eq", "value": {"type": "complex128", "value": 1}}]}}`,
+			`{"criteria": {"Name": [{"op": "eq", "value": {"type": "int", "value": "fox"}}]}}`,
+			`{"criteria": {"name": [{"op": "eq", "value": {"type": "string", "value": "fox"}}]}}`,
+			`{"criteria": {"Name": [{"op": "eq"}]}}`,
+			`{"criteria": {"Name": [{"op": "in"}]}}`,
+			`{"criteria": {"Name": [{"op": "isNil", "value": {"type": "string", "value": "fox"}}]}}`,
+			`{"criteria": {"Created": [{"op": "hourBetween", "values": [{"type": "int", "value": 9}]}]}}`,
+			`{"criteria": {"Name": [{"op": "hasPrefix", "value": {"type": "int", "value": 1}}]}}`,
+			`{"criteria": {"Items": [{"op": "containsMatch", "value": {"type": "string", "value": "x"}}]}}`,
+			`{"index": "Category", "criteria": {"Category": [{"op": "eq", "value": {"type": "string", "value": "food"}}]},
+				"skip": -1}`,
+			`{"limit": -1}`,
+			`{"or": [{"limit": 1}]}`,
+			`{"or": [{"sort": ["Name"]}]}`,
+			`{"or": [null]}`,
+			`{"sort": [""]}`,
+		} {
+			assert(t, json.Unmarshal([]byte(data), &badgerhold.Query{}) != nil, "Unmarshalling "+data+
+				" did not return an error")
+		}
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"strings"
+)
+
+// namespaceSeparator separates the namespace from the type name.  Go type names can't contain it, so namespaced
+// type names can't collide with the names of types outside of a namespace
+const namespaceSeparator = "/"
+
+// Namespace returns a view of the store where all records, indexes and sequences are kept apart from those of the
+// store and of any other namespace, so a single badger DB can hold separate sets of data, such as one per tenant.
+// Queries and writes through the view only see the records written through a view of the same namespace.
+// Namespaces can be nested.  The view shares the underlying badger DB with the store, so closing either closes
+// both.  Will panic if the namespace is empty or contains a ':'
+func (s *Store) Namespace(namespace string) *Store {
+	if namespace == "" || strings.Contains(namespace, ":") {
+		panic("A namespace must not be empty or contain a ':'")
+	}
+
+	view := *s
+	view.namespace = s.namespaced(namespace)
+	return &view
+}
+
+// namespaced returns the type name prefixed with the namespace of the store, if it has one
+func (s *Store) namespaced(typeName string) string {
+	if s.namespace == "" {
+		return typeName
+	}
+	return s.namespace + namespaceSeparator + typeName
+}
+
+// namespacedStorer stores a type within the namespace of a store
+type namespacedStorer struct {
+	Storer
+	namespace string
+}
+
+// Type returns the type name prefixed with the namespace
+func (n *namespacedStorer) Type() string {
+	return n.namespace + namespaceSeparator + n.Storer.Type()
+}
+
+// storerType returns the type name reported by the Storer, without the namespace of the store
+func storerType(storer Storer) string {
+	if n, ok := storer.(*namespacedStorer); ok {
+		return n.Storer.Type()
+	}
+	return storer.Type()
+}
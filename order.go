@@ -0,0 +1,186 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const insertOrderPrefix = "_bhInsertOrder"
+
+// ErrInsertionOrderNotTracked is returned from ForEachInOrder when the store wasn't opened with the
+// TrackInsertionOrder option
+var ErrInsertionOrderNotTracked = errors.New("This badgerhold store is not tracking insertion order")
+
+// insertOrderKeyPrefix returns the prefix of the keys that list the records of a type in insertion order
+func insertOrderKeyPrefix(typeName string) []byte {
+	return []byte(insertOrderPrefix + ":" + typeName + ":")
+}
+
+// insertOrderRecordKey returns the key that stores the insertion sequence of a record, so the record can be removed
+// from the insertion order when it's deleted
+func insertOrderRecordKey(typeName string, key []byte) []byte {
+	return append([]byte(insertOrderPrefix+"Key:"+typeName+":"), key...)
+}
+
+// insertOrderAdd adds a newly inserted record to the end of its type's insertion order
+func (s *Store) insertOrderAdd(storer Storer, tx *badger.Txn, key []byte) error {
+	if !s.trackInsertionOrder {
+		return nil
+	}
+
+	seq, err := s.getSequence(insertOrderPrefix + ":" + storer.Type())
+	if err != nil {
+		return err
+	}
+
+	seqBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqBytes, seq)
+
+	err = tx.Set(append(insertOrderKeyPrefix(storer.Type()), seqBytes...), key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(insertOrderRecordKey(storer.Type(), key), seqBytes)
+}
+
+// insertOrderDelete removes a deleted record from its type's insertion order
+func (s *Store) insertOrderDelete(storer Storer, tx *badger.Txn, key []byte) error {
+	if !s.trackInsertionOrder {
+		return nil
+	}
+
+	recordKey := insertOrderRecordKey(storer.Type(), key)
+	item, err := tx.Get(recordKey)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	seqBytes, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Delete(append(insertOrderKeyPrefix(storer.Type()), seqBytes...))
+	if err != nil {
+		return err
+	}
+
+	return tx.Delete(recordKey)
+}
+
+// ForEachInOrder is the same as ForEach, but runs the function against the matching records in the order they were
+// inserted rather than in key order.  The store must be opened with the TrackInsertionOrder option, otherwise
+// ErrInsertionOrderNotTracked is returned.  Records inserted while the option wasn't set are skipped.  Any sort
+// order on the query is ignored, while skip and limit are applied in insertion order
+func (s *Store) ForEachInOrder(query *Query, fn interface{}) error {
+	return s.view(func(tx *badger.Txn) error {
+		return s.TxForEachInOrder(tx, query, fn)
+	})
+}
+
+// TxForEachInOrder is the same as ForEachInOrder but you specify your own transaction
+func (s *Store) TxForEachInOrder(tx *badger.Txn, query *Query, fn interface{}) error {
+	if !s.trackInsertionOrder {
+		return ErrInsertionOrderNotTracked
+	}
+	if query == nil {
+		query = &Query{}
+	}
+
+	fnVal := reflect.ValueOf(fn)
+	argType := reflect.TypeOf(fn).In(0)
+
+	if argType.Kind() == reflect.Ptr {
+		argType = argType.Elem()
+	}
+
+	keyField, hasKeyField := getKeyField(argType)
+
+	dataType := reflect.New(argType).Interface()
+	storer := s.newStorer(dataType)
+
+	// find the matching keys first, then walk them in insertion order
+	matchQuery := *query
+	matchQuery.sort = nil
+	matchQuery.skip = 0
+	matchQuery.limit = 0
+	matchQuery.skipDecode = true
+
+	matched := make(map[string]bool)
+	err := s.runQuery(tx, dataType, &matchQuery, nil, 0, func(r *record) error {
+		matched[string(r.key)] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	skip := query.skip
+	count := 0
+
+	iter := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	prefix := insertOrderKeyPrefix(storer.Type())
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		if query.limit != 0 && count == query.limit {
+			return nil
+		}
+
+		key, err := iter.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !matched[string(key)] {
+			continue
+		}
+
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		item, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+
+		value := reflect.New(argType)
+		err = item.Value(func(val []byte) error {
+			return s.decodeRecord(val, value.Interface())
+		})
+		if err != nil {
+			return err
+		}
+
+		if hasKeyField {
+			err = s.setKeyField(key, value, keyField, storer.Type())
+			if err != nil {
+				return err
+			}
+		}
+
+		out := fnVal.Call([]reflect.Value{value})
+		if len(out) != 1 {
+			return fmt.Errorf("foreach function does not return an error")
+		}
+		if !out[0].IsNil() {
+			return out[0].Interface().(error)
+		}
+		count++
+	}
+
+	return nil
+}
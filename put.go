@@ -5,7 +5,10 @@
 package badgerhold
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"math"
 	"reflect"
 
 	"github.com/dgraph-io/badger/v4"
@@ -17,6 +20,13 @@ var ErrKeyExists = errors.New("This Key already exists in badgerhold for this ty
 // ErrUniqueExists is the error thrown when data is being inserted for a unique constraint value that already exists
 var ErrUniqueExists = errors.New("This value cannot be written due to the unique constraint on the field")
 
+// ErrConflict is returned by UpdateIfUnchanged when the stored record no longer matches the expected value
+var ErrConflict = errors.New("This record has been changed since it was read")
+
+// ErrKeyTypeMismatch is returned by Insert in a store opened with StrictKeyTypes when the key isn't the same type as
+// the record's key field
+var ErrKeyTypeMismatch = errors.New("This key is not the same type as the key field of the record")
+
 // sequence tells badgerhold to insert the key as the next sequence in the bucket
 type sequence struct{}
 
@@ -33,11 +43,12 @@ func NextSequence() interface{} {
 // If the data struct has a field tagged as `badgerholdKey` and it is the same type
 // as the Insert key, AND the data struct is passed by reference, AND the key field
 // is currently set to the zero-value for that type, then that field will be set to
-// the value of the insert key.
+// the value of the insert key.  If the types don't match, the key field is left as is, unless the store was opened
+// with StrictKeyTypes, in which case ErrKeyTypeMismatch is returned and nothing is inserted.
 //
 // To use this with badgerhold.NextSequence() use a type of `uint64` for the key field.
 func (s *Store) Insert(key, data interface{}) error {
-	err := s.Badger().Update(func(tx *badger.Txn) error {
+	err := s.update(func(tx *badger.Txn) error {
 		return s.TxInsert(tx, key, data)
 	})
 
@@ -59,6 +70,13 @@ func (s *Store) TxInsert(tx *badger.Txn, key, data interface{}) error {
 		}
 	}
 
+	if s.strictKeyTypes {
+		keyField, ok := getKeyField(dereference(reflect.TypeOf(data)))
+		if ok && reflect.TypeOf(key) != keyField.Type {
+			return ErrKeyTypeMismatch
+		}
+	}
+
 	gk, err := s.encodeKey(key, storer.Type())
 
 	if err != nil {
@@ -87,6 +105,11 @@ func (s *Store) TxInsert(tx *badger.Txn, key, data interface{}) error {
 		return err
 	}
 
+	err = s.insertOrderAdd(storer, tx, gk)
+	if err != nil {
+		return err
+	}
+
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	if !dataVal.CanSet() {
 		return nil
@@ -113,7 +136,7 @@ func (s *Store) TxInsert(tx *badger.Txn, key, data interface{}) error {
 // Update updates an existing record in the badgerhold
 // if the Key doesn't already exist in the store, then it fails with ErrNotFound
 func (s *Store) Update(key interface{}, data interface{}) error {
-	err := s.Badger().Update(func(tx *badger.Txn) error {
+	err := s.update(func(tx *badger.Txn) error {
 		return s.TxUpdate(tx, key, data)
 	})
 	if err == badger.ErrConflict {
@@ -169,10 +192,58 @@ func (s *Store) TxUpdate(tx *badger.Txn, key interface{}, data interface{}) erro
 	return s.indexAdd(storer, tx, gk, data)
 }
 
+// UpdateIfUnchanged updates an existing record in the badgerhold only if the stored record is still the same
+// as oldData, otherwise it fails with ErrConflict.  Records are compared by their encoded bytes, so the encoder
+// must produce the same bytes for the same value (which is not the case with Gob and map fields)
+// if the Key doesn't already exist in the store, then it fails with ErrNotFound
+func (s *Store) UpdateIfUnchanged(key, oldData, newData interface{}) error {
+	err := s.update(func(tx *badger.Txn) error {
+		return s.TxUpdateIfUnchanged(tx, key, oldData, newData)
+	})
+	if err == badger.ErrConflict {
+		return s.UpdateIfUnchanged(key, oldData, newData)
+	}
+	return err
+}
+
+// TxUpdateIfUnchanged is the same as UpdateIfUnchanged except it allows you to specify your own transaction
+func (s *Store) TxUpdateIfUnchanged(tx *badger.Txn, key, oldData, newData interface{}) error {
+	storer := s.newStorer(newData)
+
+	gk, err := s.encodeKey(key, storer.Type())
+	if err != nil {
+		return err
+	}
+
+	existingItem, err := tx.Get(gk)
+	if err == badger.ErrKeyNotFound {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	expected, err := s.encode(oldData)
+	if err != nil {
+		return err
+	}
+
+	existing, err := existingItem.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(existing, expected) {
+		return ErrConflict
+	}
+
+	return s.TxUpdate(tx, key, newData)
+}
+
 // Upsert inserts the record into the badgerhold if it doesn't exist.  If it does already exist, then it updates
 // the existing record
 func (s *Store) Upsert(key interface{}, data interface{}) error {
-	err := s.Badger().Update(func(tx *badger.Txn) error {
+	err := s.update(func(tx *badger.Txn) error {
 		return s.TxUpsert(tx, key, data)
 	})
 
@@ -184,15 +255,43 @@ func (s *Store) Upsert(key interface{}, data interface{}) error {
 
 // TxUpsert is the same as Upsert except it allows you to specify your own transaction
 func (s *Store) TxUpsert(tx *badger.Txn, key interface{}, data interface{}) error {
+	_, err := s.upsert(tx, key, data)
+	return err
+}
+
+// UpsertReport is the same as Upsert, but also returns whether the record was created, rather than an existing
+// record updated
+func (s *Store) UpsertReport(key interface{}, data interface{}) (bool, error) {
+	var created bool
+	err := s.update(func(tx *badger.Txn) error {
+		var txErr error
+		created, txErr = s.TxUpsertReport(tx, key, data)
+		return txErr
+	})
+
+	if err == badger.ErrConflict {
+		return s.UpsertReport(key, data)
+	}
+	return created, err
+}
+
+// TxUpsertReport is the same as UpsertReport except it allows you to specify your own transaction
+func (s *Store) TxUpsertReport(tx *badger.Txn, key interface{}, data interface{}) (bool, error) {
+	return s.upsert(tx, key, data)
+}
+
+// upsert inserts or updates the record, returning whether it was created
+func (s *Store) upsert(tx *badger.Txn, key interface{}, data interface{}) (bool, error) {
 	storer := s.newStorer(data)
 
 	gk, err := s.encodeKey(key, storer.Type())
 
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	existingItem, err := tx.Get(gk)
+	exists := err == nil
 
 	if err == nil {
 		// existing entry found
@@ -203,38 +302,58 @@ func (s *Store) TxUpsert(tx *badger.Txn, key interface{}, data interface{}) erro
 			return s.decode(existing, existingVal)
 		})
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		err = s.indexDelete(storer, tx, gk, existingVal)
 		if err != nil {
-			return err
+			return false, err
 		}
 	} else if err != badger.ErrKeyNotFound {
-		return err
+		return false, err
 	}
 
 	// existing entry not found
 
 	value, err := s.encode(data)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// put data
 	err = tx.Set(gk, value)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// insert any new indexes
-	return s.indexAdd(storer, tx, gk, data)
+	err = s.indexAdd(storer, tx, gk, data)
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		return false, nil
+	}
+	err = s.insertOrderAdd(storer, tx, gk)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // UpdateMatching runs the update function for every record that match the passed in query
 // Note that the type  of record in the update func always has to be a pointer
+// If the BatchSize option is set, the records are updated in batches, each in their own transaction
 func (s *Store) UpdateMatching(dataType interface{}, query *Query, update func(record interface{}) error) error {
-	err := s.Badger().Update(func(tx *badger.Txn) error {
+	if s.batchSize > 0 {
+		storer := s.newStorer(dataType)
+		return s.batchQuery(dataType, query, func(tx *badger.Txn, r *record) error {
+			return s.updateRecord(storer, tx, r, update)
+		})
+	}
+
+	err := s.update(func(tx *badger.Txn) error {
 		return s.TxUpdateMatching(tx, dataType, query, update)
 	})
 	if err == badger.ErrConflict {
@@ -248,3 +367,145 @@ func (s *Store) TxUpdateMatching(tx *badger.Txn, dataType interface{}, query *Qu
 	update func(record interface{}) error) error {
 	return s.updateQuery(tx, dataType, query, update)
 }
+
+// ForEachUpdate runs fn against every record that matches the query, like ForEach, and writes back each record fn
+// returns true for, updating its indexes.  Records are read and written one at a time rather than all being read
+// into memory first like UpdateMatching, so it's suited to migrating large sets of data.  record is always a pointer
+// to dataType, with its key field set.  Returning an error from fn stops the cursor and discards all changes.
+// All of the changes are made in a single transaction, which badger limits the size of, so updating too many records
+// returns badger.ErrTxnTooBig.  If the BatchSize option is set, the changes are committed in batches instead
+func (s *Store) ForEachUpdate(dataType interface{}, query *Query,
+	fn func(record interface{}) (changed bool, err error)) error {
+	if s.batchSize > 0 {
+		storer := s.newStorer(dataType)
+		return s.batchQuery(dataType, query, func(tx *badger.Txn, r *record) error {
+			return s.updateChangedRecord(storer, tx, r, fn)
+		})
+	}
+
+	err := s.update(func(tx *badger.Txn) error {
+		return s.TxForEachUpdate(tx, dataType, query, fn)
+	})
+	if err == badger.ErrConflict {
+		return s.ForEachUpdate(dataType, query, fn)
+	}
+	return err
+}
+
+// TxForEachUpdate does the same as ForEachUpdate, but allows you to specify your own transaction
+func (s *Store) TxForEachUpdate(tx *badger.Txn, dataType interface{}, query *Query,
+	fn func(record interface{}) (changed bool, err error)) error {
+	return s.forEachUpdateQuery(tx, dataType, query, fn)
+}
+
+// Increment adds delta to the integer field of the record stored at key, and returns the new value of the field.
+// The record is read, updated, and written back in a single transaction, so concurrent increments are safe.
+// Unsigned fields are incremented as unsigned values, and the returned value is the new value converted to an int64
+func (s *Store) Increment(key, dataType interface{}, field string, delta int64) (int64, error) {
+	var value int64
+	err := s.update(func(tx *badger.Txn) error {
+		var txErr error
+		value, txErr = s.TxIncrement(tx, key, dataType, field, delta)
+		return txErr
+	})
+	if err == badger.ErrConflict {
+		return s.Increment(key, dataType, field, delta)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// TxIncrement is the same as Increment except it allows you to specify your own transaction
+func (s *Store) TxIncrement(tx *badger.Txn, key, dataType interface{}, field string, delta int64) (int64, error) {
+	storer := s.newStorer(dataType)
+
+	gk, err := s.encodeKey(key, storer.Type())
+	if err != nil {
+		return 0, err
+	}
+
+	existingItem, err := tx.Get(gk)
+	if err == badger.ErrKeyNotFound {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	record := newElemType(dataType)
+	err = existingItem.Value(func(existing []byte) error {
+		return s.decode(existing, record)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	fVal, err := fieldValue(reflect.ValueOf(record), field)
+	if err != nil {
+		return 0, err
+	}
+
+	var value int64
+	var uvalue uint64
+	switch fVal.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		current := fVal.Int()
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return 0, fmt.Errorf("Incrementing the field %s by %d overflows %s", field, delta, fVal.Type())
+		}
+		value = current + delta
+		if fVal.OverflowInt(value) {
+			return 0, fmt.Errorf("Incrementing the field %s by %d overflows %s", field, delta, fVal.Type())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		current := fVal.Uint()
+		if delta < 0 {
+			// -(delta+1)+1 avoids overflowing on math.MinInt64
+			decrement := uint64(-(delta + 1)) + 1
+			if decrement > current {
+				return 0, fmt.Errorf("Incrementing the field %s by %d overflows %s", field, delta, fVal.Type())
+			}
+			uvalue = current - decrement
+		} else {
+			uvalue = current + uint64(delta)
+			if uvalue < current || fVal.OverflowUint(uvalue) {
+				return 0, fmt.Errorf("Incrementing the field %s by %d overflows %s", field, delta, fVal.Type())
+			}
+		}
+		value = int64(uvalue)
+	default:
+		return 0, fmt.Errorf("The field %s is of Kind %s and cannot be incremented", field, fVal.Kind())
+	}
+
+	// delete any existing indexes
+	err = s.indexDelete(storer, tx, gk, record)
+	if err != nil {
+		return 0, err
+	}
+
+	if fVal.Kind() >= reflect.Uint && fVal.Kind() <= reflect.Uint64 {
+		fVal.SetUint(uvalue)
+	} else {
+		fVal.SetInt(value)
+	}
+
+	encoded, err := s.encode(record)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Set(gk, encoded)
+	if err != nil {
+		return 0, err
+	}
+
+	// insert any new indexes
+	err = s.indexAdd(storer, tx, gk, record)
+	if err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
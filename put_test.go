@@ -7,6 +7,7 @@ package badgerhold_test
 import (
 	"errors"
 	"fmt"
+	"math"
 	"sync"
 	"testing"
 	"time"
@@ -217,6 +218,26 @@ func TestUpsertReadTxn(t *testing.T) {
 	})
 }
 
+func TestUpsertReport(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		created, err := store.UpsertReport("testKey", &ItemTest{Name: "first", Category: "first"})
+		ok(t, err)
+		assert(t, created, "UpsertReport of a new key did not report it was created")
+
+		created, err = store.UpsertReport("testKey", &ItemTest{Name: "second", Category: "second"})
+		ok(t, err)
+		assert(t, !created, "UpsertReport of an existing key reported it was created")
+
+		result := &ItemTest{}
+		ok(t, store.Get("testKey", result))
+		equals(t, "second", result.Name)
+
+		count, err := store.Count(&ItemTest{}, badgerhold.Where("Category").Eq("first").Index("Category"))
+		ok(t, err)
+		equals(t, uint64(0), count)
+	})
+}
+
 func TestUpdateMatching(t *testing.T) {
 	for _, tst := range testResults {
 		t.Run(tst.name, func(t *testing.T) {
@@ -434,6 +455,24 @@ func TestInsertSequence(t *testing.T) {
 	})
 }
 
+func TestInsertSequenceBandwidth(t *testing.T) {
+	type SequenceTest struct {
+		Key uint64 `badgerholdKey:"Key"`
+	}
+
+	for _, bandwidth := range []uint64{0, 1, 1000} {
+		opt := testOptions()
+		opt.SequenceBandwidth = bandwidth
+		testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+			for i := 0; i < 10; i++ {
+				st := &SequenceTest{}
+				ok(t, store.Insert(badgerhold.NextSequence(), st))
+				equals(t, uint64(i), st.Key)
+			}
+		})
+	}
+}
+
 func TestInsertSequenceSetKey(t *testing.T) {
 	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
 
@@ -522,6 +561,34 @@ func TestInsertSetKey(t *testing.T) {
 	})
 }
 
+func TestInsertStrictKeyTypes(t *testing.T) {
+	opt := testOptions()
+	opt.StrictKeyTypes = true
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		type TestStrictKey struct {
+			Key  uint64 `badgerholdKey:"Key"`
+			Name string
+		}
+
+		st := TestStrictKey{Name: "mismatch"}
+		equals(t, badgerhold.ErrKeyTypeMismatch, store.Insert(789, &st))
+		count, err := store.Count(&TestStrictKey{}, nil)
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		ok(t, store.Insert(uint64(789), &st))
+		equals(t, uint64(789), st.Key)
+
+		first, second := TestStrictKey{}, TestStrictKey{}
+		ok(t, store.Insert(badgerhold.NextSequence(), &first))
+		ok(t, store.Insert(badgerhold.NextSequence(), &second))
+		equals(t, first.Key+1, second.Key)
+
+		// types without a key field take any key
+		ok(t, store.Insert(1, &ItemTest{Name: "no key field"}))
+	})
+}
+
 func TestAlternateTags(t *testing.T) {
 	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
 		type TestAlternate struct {
@@ -769,3 +836,268 @@ func TestInsertUpdateIndexError(t *testing.T) {
 		}
 	})
 }
+
+func TestIncrement(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Counter struct {
+			Name  string
+			Hits  int `badgerhold:"index"`
+			Total uint8
+			Big   uint64
+			Wide  int64
+			Plain int
+		}
+
+		ok(t, store.Insert("key", &Counter{Name: "counter", Hits: 5, Total: 250}))
+
+		value, err := store.Increment("key", &Counter{}, "Hits", 3)
+		ok(t, err)
+		equals(t, int64(8), value)
+
+		value, err = store.Increment("key", Counter{}, "Hits", -10)
+		ok(t, err)
+		equals(t, int64(-2), value)
+
+		var result []Counter
+		ok(t, store.Find(&result, badgerhold.Where("Hits").Eq(-2).Index("Hits")))
+		equals(t, 1, len(result))
+		equals(t, "counter", result[0].Name)
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Hits").Eq(5).Index("Hits")))
+		equals(t, 0, len(result))
+
+		value, err = store.Increment("key", &Counter{}, "Total", 5)
+		ok(t, err)
+		equals(t, int64(255), value)
+
+		_, err = store.Increment("key", &Counter{}, "Total", 1)
+		assert(t, err != nil, "Overflowing a uint8 field did not return an error")
+
+		ok(t, store.Insert("big", &Counter{Big: math.MaxUint64 - 10}))
+		_, err = store.Increment("big", &Counter{}, "Big", 4)
+		ok(t, err)
+		_, err = store.Increment("big", &Counter{}, "Big", -2)
+		ok(t, err)
+		big := &Counter{}
+		ok(t, store.Get("big", big))
+		equals(t, uint64(math.MaxUint64-8), big.Big)
+
+		_, err = store.Increment("big", &Counter{}, "Big", 9)
+		assert(t, err != nil, "Overflowing a uint64 field did not return an error")
+
+		_, err = store.Increment("key", &Counter{}, "Total", math.MinInt64)
+		assert(t, err != nil, "Underflowing a uint8 field did not return an error")
+
+		ok(t, store.Insert("wide", &Counter{Wide: math.MaxInt64 - 1, Plain: math.MinInt64 + 1}))
+		value, err = store.Increment("wide", &Counter{}, "Wide", 1)
+		ok(t, err)
+		equals(t, int64(math.MaxInt64), value)
+		_, err = store.Increment("wide", &Counter{}, "Wide", 1)
+		assert(t, err != nil, "Overflowing an int64 field did not return an error")
+
+		value, err = store.Increment("wide", &Counter{}, "Plain", -1)
+		ok(t, err)
+		equals(t, int64(math.MinInt64), value)
+		_, err = store.Increment("wide", &Counter{}, "Plain", -1)
+		assert(t, err != nil, "Underflowing an int field did not return an error")
+
+		wide := &Counter{}
+		ok(t, store.Get("wide", wide))
+		equals(t, int64(math.MaxInt64), wide.Wide)
+		equals(t, math.MinInt64, wide.Plain)
+
+		_, err = store.Increment("key", &Counter{}, "Name", 1)
+		assert(t, err != nil, "Incrementing a string field did not return an error")
+
+		_, err = store.Increment("missing", &Counter{}, "Hits", 1)
+		equals(t, badgerhold.ErrNotFound, err)
+	})
+}
+
+func TestUpdateIfUnchanged(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		key := "testKey"
+		original := &ItemTest{
+			Name:     "Test Name",
+			Category: "original",
+			Created:  time.Now(),
+		}
+		ok(t, store.Insert(key, original))
+
+		updated := *original
+		updated.Category = "updated"
+		ok(t, store.UpdateIfUnchanged(key, original, &updated))
+
+		other := *original
+		other.Category = "other"
+		equals(t, badgerhold.ErrConflict, store.UpdateIfUnchanged(key, original, &other))
+
+		result := &ItemTest{}
+		ok(t, store.Get(key, result))
+		equals(t, "updated", result.Category)
+
+		var indexed []ItemTest
+		ok(t, store.Find(&indexed, badgerhold.Where("Category").Eq("updated").Index("Category")))
+		equals(t, 1, len(indexed))
+
+		equals(t, badgerhold.ErrNotFound, store.UpdateIfUnchanged("missing", original, &updated))
+	})
+}
+
+type DescendingStorer struct {
+	Day   string
+	Value int
+}
+
+func (d *DescendingStorer) Type() string { return "DescendingStorer" }
+func (d *DescendingStorer) Indexes() map[string]badgerhold.Index {
+	return map[string]badgerhold.Index{
+		"Day": {
+			IndexFunc: func(_ string, value interface{}) ([]byte, error) {
+				return badgerhold.DefaultEncode(value.(*DescendingStorer).Day)
+			},
+			Descending: true,
+		},
+	}
+}
+
+func TestDescendingIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		for i := 1; i <= 9; i++ {
+			ok(t, store.Insert(i, &DescendingStorer{Day: fmt.Sprintf("2024-01-0%d", i), Value: i}))
+		}
+		// shares the index value with key 9
+		ok(t, store.Insert(10, &DescendingStorer{Day: "2024-01-09", Value: 10}))
+
+		var result []DescendingStorer
+		ok(t, store.Find(&result, badgerhold.Where("Day").Ge("2024-01-03").Index("Day").Limit(4)))
+		equals(t, []DescendingStorer{
+			{Day: "2024-01-09", Value: 9},
+			{Day: "2024-01-09", Value: 10},
+			{Day: "2024-01-08", Value: 8},
+			{Day: "2024-01-07", Value: 7},
+		}, result)
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Day").In("2024-01-02", "2024-01-05").Index("Day")))
+		equals(t, []DescendingStorer{
+			{Day: "2024-01-02", Value: 2},
+			{Day: "2024-01-05", Value: 5},
+		}, result)
+
+		ok(t, store.Delete(9, &DescendingStorer{}))
+		ok(t, store.UpdateMatching(&DescendingStorer{}, badgerhold.Where("Value").Eq(10),
+			func(record interface{}) error {
+				record.(*DescendingStorer).Day = "2024-01-01"
+				return nil
+			}))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Day").Lt("2024-01-03").Index("Day")))
+		equals(t, []DescendingStorer{
+			{Day: "2024-01-02", Value: 2},
+			{Day: "2024-01-01", Value: 1},
+			{Day: "2024-01-01", Value: 10},
+		}, result)
+	})
+}
+
+type PartialStorer struct {
+	Email  string
+	Active bool
+}
+
+func (p *PartialStorer) Type() string { return "PartialStorer" }
+func (p *PartialStorer) Indexes() map[string]badgerhold.Index {
+	return map[string]badgerhold.Index{
+		"Email": {
+			IndexFunc: func(_ string, value interface{}) ([]byte, error) {
+				return badgerhold.DefaultEncode(value.(*PartialStorer).Email)
+			},
+			Unique: true,
+			Condition: func(value interface{}) bool {
+				return value.(*PartialStorer).Active
+			},
+		},
+	}
+}
+
+func TestPartialIndex(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		ok(t, store.Insert(1, &PartialStorer{Email: "a@example.com", Active: true}))
+		ok(t, store.Insert(2, &PartialStorer{Email: "b@example.com"}))
+		// inactive records aren't in the unique index, so they can share a value
+		ok(t, store.Insert(3, &PartialStorer{Email: "a@example.com"}))
+		equals(t, badgerhold.ErrUniqueExists, store.Insert(4, &PartialStorer{Email: "a@example.com", Active: true}))
+
+		// there's no telling which records a Condition func leaves out, so the index can't be used
+		var result []PartialStorer
+		err := store.Find(&result, badgerhold.Where("Email").Eq("a@example.com").Index("Email"))
+		assert(t, err != nil, "Find using a partial index with a Condition func did not return an error")
+
+		// AutoIndex scans instead, so every matching record is found
+		count, err := store.Count(&PartialStorer{}, badgerhold.Where("Email").Eq("a@example.com").AutoIndex())
+		ok(t, err)
+		equals(t, uint64(2), count)
+
+		repaired, err := store.VerifyIndexes(&PartialStorer{})
+		ok(t, err)
+		equals(t, 0, repaired)
+	})
+}
+
+type PartialQueryStorer struct {
+	Email  string
+	Active bool
+}
+
+func (p *PartialQueryStorer) Type() string { return "PartialQueryStorer" }
+func (p *PartialQueryStorer) Indexes() map[string]badgerhold.Index {
+	return map[string]badgerhold.Index{
+		"Email": {
+			IndexFunc: func(_ string, value interface{}) ([]byte, error) {
+				return badgerhold.DefaultEncode(value.(*PartialQueryStorer).Email)
+			},
+			ConditionQuery: badgerhold.Where("Active").Eq(true),
+		},
+	}
+}
+
+func TestPartialIndexConditionQuery(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		ok(t, store.Insert(1, &PartialQueryStorer{Email: "a@example.com", Active: true}))
+		ok(t, store.Insert(2, &PartialQueryStorer{Email: "b@example.com"}))
+		ok(t, store.Insert(3, &PartialQueryStorer{Email: "a@example.com"}))
+
+		// queries that include the condition can use the index
+		var result []PartialQueryStorer
+		ok(t, store.Find(&result,
+			badgerhold.Where("Email").Eq("a@example.com").And("Active").Eq(true).Index("Email")))
+		equals(t, []PartialQueryStorer{{Email: "a@example.com", Active: true}}, result)
+
+		result = nil
+		ok(t, store.Find(&result,
+			badgerhold.Where("Email").Eq("b@example.com").And("Active").Eq(true).Index("Email")))
+		equals(t, 0, len(result))
+
+		// queries that could match records missing from the index can't
+		err := store.Find(&result, badgerhold.Where("Email").Eq("a@example.com").Index("Email"))
+		assert(t, err != nil, "Find that could match records missing from a partial index did not return an error")
+		err = store.Find(&result,
+			badgerhold.Where("Email").Eq("a@example.com").And("Active").Eq(false).Index("Email"))
+		assert(t, err != nil, "Find with a criterion other than the index condition did not return an error")
+
+		// records are added to and removed from the index as they start and stop meeting the condition
+		ok(t, store.Update(2, &PartialQueryStorer{Email: "b@example.com", Active: true}))
+		ok(t, store.Update(1, &PartialQueryStorer{Email: "a@example.com"}))
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Email").In("a@example.com", "b@example.com").
+			And("Active").Eq(true).Index("Email")))
+		equals(t, []PartialQueryStorer{{Email: "b@example.com", Active: true}}, result)
+
+		repaired, err := store.VerifyIndexes(&PartialQueryStorer{})
+		ok(t, err)
+		equals(t, 0, repaired)
+	})
+}
@@ -5,14 +5,23 @@
 package badgerhold
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/z"
 )
 
 const (
@@ -29,10 +38,21 @@ const (
 	sw           // string starts with
 	ew           // string ends with
 	hk           // match map keys
+	rev          // regular expression against the value's default format
+	bp           // byte slice starts with
+	wd           // time's weekday in
+	mo           // time's month in
+	hb           // time's hour between
+	ins          // in values read from a stream
+	ball         // integer has all of the bits set
+	bany         // integer has any of the bits set
+	eqf          // equal by func
+	cm           // slice has an element matching a query
 
 	contains // slice only
 	any      // slice only
 	all      // slice only
+	subset   // slice only
 )
 
 // Key is shorthand for specifying a query to run again the Key in a badgerhold, simply returns ""
@@ -43,21 +63,44 @@ const Key = ""
 // an empty query matches against all records
 type Query struct {
 	index         string
+	noIndex       bool
+	autoIndex     bool
 	currentField  string
 	fieldCriteria map[string][]*Criterion
 	ors           []*Query
 
-	badIndex bool
-	dataType reflect.Type
-	tx       *badger.Txn
-	writable bool
-	subquery bool
-	bookmark *iterBookmark
-
-	limit   int
-	skip    int
-	sort    []string
-	reverse bool
+	badIndex   bool
+	dataType   reflect.Type
+	tx         *badger.Txn
+	writable   bool
+	subquery   bool
+	skipDecode bool // records are passed to the query action without their values decoded
+	depth      int
+	bookmark   *iterBookmark
+	// records that fail to decode are collected here rather than stopping the query, if set
+	decodeErrors *[]error
+	except       *Query // records matching this query are left out of the results
+	// the index only narrows the records down, so its criteria are tested against the records too
+	recheckIndex bool
+	streamRead   bool // the records are read with badger's Stream rather than a transaction
+	fields       []string
+	covering     bool // the records are built from the index the query uses, without reading them
+	pool         *recordPool
+
+	limit    int
+	skip     int
+	dropLast int
+	distinct []string
+	sizeGt   int // only records with encoded values larger than this are matched
+	sort     []string
+	reverse  bool
+	collator func(a, b string) int
+	having   func(result *AggregateResult) bool
+
+	maxResults int
+	// set while Find runs the query to the most records it can return, so records loaded to be sorted stop being
+	// read as soon as too many match
+	maxMatches int
 }
 
 // Slice turns a slice of any type into []interface{} by copying the slice values so it can be easily passed
@@ -96,13 +139,34 @@ type Criterion struct {
 	operator int
 	value    interface{}
 	values   []interface{}
+
+	lazyValue  ValueFunc
+	lazyValues []interface{}
+	stored     *StoredRef
+
+	jsonPath     string
+	jsonSegments []interface{}
+
+	stream func() (interface{}, bool)
+
+	equal func(a, b interface{}) bool
 }
 
-func hasMatchFunc(criteria []*Criterion) bool {
+// needsRecord returns whether any of the criteria need the entire record to be tested, which means they can't be
+// tested against an index: match funcs, comparisons against other fields, and JSON paths
+func needsRecord(criteria []*Criterion) bool {
 	for _, c := range criteria {
-		if c.operator == fn {
+		if c.operator == fn || c.operator == subset || c.operator == cm || c.jsonSegments != nil {
+			return true
+		}
+		if _, ok := c.value.(Field); ok {
 			return true
 		}
+		for i := range c.values {
+			if _, ok := c.values[i].(Field); ok {
+				return true
+			}
+		}
 	}
 	return false
 }
@@ -110,6 +174,203 @@ func hasMatchFunc(criteria []*Criterion) bool {
 // Field allows for referencing a field in structure being compared
 type Field string
 
+// ValueFunc is a criterion value that is evaluated each time the query is run, rather than when the query is built,
+// which allows for reusing a query whose values change over time
+//
+//	badgerhold.Where("Expires").Lt(badgerhold.Now())
+type ValueFunc func() interface{}
+
+// Now returns a ValueFunc that resolves to the current time when the query is run
+func Now() ValueFunc {
+	return func() interface{} {
+		return time.Now()
+	}
+}
+
+// Ago returns a ValueFunc that resolves to the time d before the current time when the query is run
+func Ago(d time.Duration) ValueFunc {
+	return func() interface{} {
+		return time.Now().Add(-d)
+	}
+}
+
+// StoredRef is a criterion value read from the field of a stored record each time the query is run, created with
+// StoredValue
+type StoredRef struct {
+	dataType interface{}
+	key      interface{}
+	field    string
+}
+
+// StoredValue returns a criterion value that's read from the field of the dataType record with the key when the
+// query is run, such as a limit held in a config record.  The record is read once per run, in the query's
+// transaction, and ErrNotFound is returned from the query if there's no record with the key
+//
+//	badgerhold.Where("Amount").Gt(badgerhold.StoredValue(&Config{}, "config", "Limit"))
+func StoredValue(dataType, key interface{}, field string) StoredRef {
+	return StoredRef{dataType: dataType, key: key, field: field}
+}
+
+// resolve returns the query to run, with the ValueFuncs and StoredValues in its criteria, and those of its or'd,
+// excepted and ContainsMatch queries, evaluated for the current run.  The same query can be run from several
+// goroutines at once, so the values are resolved into a copy of the query rather than into its criteria.  The
+// index of a NoIndex query is cleared in the copy too.  A query without any is returned as is
+func (q *Query) resolve(s *Store, tx *badger.Txn) (*Query, error) {
+	if !q.hasLazyValues() && !(q.noIndex && q.index != "") {
+		return q, nil
+	}
+
+	run := *q
+	if run.noIndex {
+		run.index = ""
+	}
+	run.fieldCriteria = make(map[string][]*Criterion, len(q.fieldCriteria))
+	for field, criteria := range q.fieldCriteria {
+		resolved := make([]*Criterion, len(criteria))
+		for i, c := range criteria {
+			rc, err := c.resolve(s, tx, &run)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = rc
+		}
+		run.fieldCriteria[field] = resolved
+	}
+
+	run.ors = make([]*Query, len(q.ors))
+	for i, or := range q.ors {
+		var err error
+		run.ors[i], err = or.resolve(s, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if q.except != nil {
+		var err error
+		run.except, err = q.except.resolve(s, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &run, nil
+}
+
+// resolve returns a copy of the criterion for the query run, with its values evaluated
+func (c *Criterion) resolve(s *Store, tx *badger.Txn, run *Query) (*Criterion, error) {
+	rc := *c
+	rc.query = run
+	rc.lazyValue = nil
+	rc.lazyValues = nil
+	rc.stored = nil
+
+	var err error
+	switch {
+	case c.lazyValue != nil:
+		rc.value = c.lazyValue()
+	case c.stored != nil:
+		rc.value, err = c.stored.read(s, tx)
+		if err != nil {
+			return nil, err
+		}
+	case c.operator == cm:
+		rc.value, err = c.value.(*Query).resolve(s, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.lazyValues != nil {
+		rc.values = make([]interface{}, len(c.lazyValues))
+		for i, value := range c.lazyValues {
+			if vf, ok := asValueFunc(value); ok {
+				rc.values[i] = vf()
+				continue
+			}
+			if ref, ok := value.(StoredRef); ok {
+				rc.values[i], err = ref.read(s, tx)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			rc.values[i] = value
+		}
+	}
+	return &rc, nil
+}
+
+// hasLazyValues returns whether the query, or any of its or'd, excepted or ContainsMatch queries, has values that
+// are resolved when it's run
+func (q *Query) hasLazyValues() bool {
+	for _, criteria := range q.fieldCriteria {
+		for _, c := range criteria {
+			if c.lazyValue != nil || c.stored != nil || c.lazyValues != nil {
+				return true
+			}
+			if c.operator == cm && c.value.(*Query).hasLazyValues() {
+				return true
+			}
+		}
+	}
+	for _, or := range q.ors {
+		if or.hasLazyValues() {
+			return true
+		}
+	}
+	return q.except != nil && q.except.hasLazyValues()
+}
+
+// read returns the value of the referenced field, reading the record in tx, or in its own transaction if tx is nil
+func (r StoredRef) read(s *Store, tx *badger.Txn) (interface{}, error) {
+	record := reflect.New(dereference(reflect.TypeOf(r.dataType)))
+	var err error
+	if tx == nil {
+		err = s.Get(r.key, record.Interface())
+	} else {
+		err = s.TxGet(tx, r.key, record.Interface())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := fieldValue(record, r.field)
+	if err != nil {
+		return nil, err
+	}
+	return value.Interface(), nil
+}
+
+func asValueFunc(value interface{}) (ValueFunc, bool) {
+	switch vf := value.(type) {
+	case ValueFunc:
+		return vf, true
+	case func() interface{}:
+		return vf, true
+	default:
+		return nil, false
+	}
+}
+
+func (c *Criterion) setLazy() {
+	if vf, ok := asValueFunc(c.value); ok {
+		c.lazyValue = vf
+	}
+	if ref, ok := c.value.(StoredRef); ok {
+		c.stored = &ref
+	}
+
+	for i := range c.values {
+		_, stored := c.values[i].(StoredRef)
+		if _, ok := asValueFunc(c.values[i]); ok || stored {
+			c.lazyValues = c.values
+			c.values = make([]interface{}, len(c.lazyValues))
+			copy(c.values, c.lazyValues)
+			return
+		}
+	}
+}
+
 // Where starts a query for specifying the criteria that an object in the badgerhold needs to match to
 // be returned in a Find result
 /*
@@ -118,7 +379,8 @@ Query API Example
 	s.Find(badgerhold.Where("FieldName").Eq(value).And("AnotherField").Lt(AnotherValue).
 		Or(badgerhold.Where("FieldName").Eq(anotherValue)
 
-Since Gobs only encode exported fields, this will panic if you pass in a field with a lower case first letter
+Since Gobs only encode exported fields, this will panic if you pass in a field with a lower case first letter.
+Use Store.RegisterAccessor to query on values that aren't exported fields
 */
 func Where(field string) *Criterion {
 	if !startsUpper(field) {
@@ -133,6 +395,29 @@ func Where(field string) *Criterion {
 	}
 }
 
+// WhereMap creates a query where each field in the map must equal its value, such as filters built from the
+// parameters of a request.  Unlike Where, an error is returned rather than a panic if a field name isn't valid, so
+// the fields can come from user input.  An empty map matches every record
+func WhereMap(fields map[string]interface{}) (*Query, error) {
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if !startsUpper(field) {
+			return nil, fmt.Errorf("The field %s must start with an upper-case letter", field)
+		}
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	query := &Query{
+		fieldCriteria: make(map[string][]*Criterion),
+	}
+	for _, field := range names {
+		query.And(field).Eq(fields[field])
+	}
+
+	return query, nil
+}
+
 // And creates another set of criterion the needs to apply to a query
 func (q *Query) And(field string) *Criterion {
 	if !startsUpper(field) {
@@ -145,6 +430,154 @@ func (q *Query) And(field string) *Criterion {
 	}
 }
 
+// AndWhere adds a criterion on the field to the query, with the operator given by its name, for building queries
+// from filters where the field, operator and values are data:
+//
+//	for _, f := range filters {
+//		query, err = query.AndWhere(f.Field, f.Op, f.Values...)
+//		...
+//	}
+//
+// The operator names are those used by MarshalJSON: eq, ne, gt, lt, ge, le, in, isNil, hasPrefix, hasSuffix,
+// hasKey, bytesPrefix, weekday, month, hourBetween, hasBits, hasAnyBits, contains, containsAny, containsAll,
+// subsetOf and containsMatch.  Unlike And, an error is returned rather than a panic if the field, operator or
+// values aren't valid, so they can come from user input.  Can be used to start a query from an empty &Query{}
+func (q *Query) AndWhere(field, op string, values ...interface{}) (*Query, error) {
+	if !startsUpper(field) {
+		return nil, fmt.Errorf("The field %s must start with an upper-case letter", field)
+	}
+	operator, ok := operatorByName(op)
+	if !ok {
+		return nil, fmt.Errorf("The operator %s is not recognized", op)
+	}
+
+	switch operator {
+	case in, wd, mo, any, all, subset:
+		if len(values) == 0 {
+			return nil, fmt.Errorf("The operator %s takes at least 1 value", op)
+		}
+	case isnil:
+		if len(values) != 0 {
+			return nil, fmt.Errorf("The operator %s takes no values", op)
+		}
+	case hb:
+		if len(values) != 2 {
+			return nil, fmt.Errorf("The operator %s takes 2 values", op)
+		}
+	default:
+		if len(values) != 1 {
+			return nil, fmt.Errorf("The operator %s takes 1 value", op)
+		}
+	}
+
+	if q.fieldCriteria == nil {
+		q.fieldCriteria = make(map[string][]*Criterion)
+	}
+
+	typeErr := func(value interface{}, want string) error {
+		return fmt.Errorf("The operator %s takes %s values, not %v (%T)", op, want, value, value)
+	}
+
+	switch operator {
+	case eq:
+		return q.And(field).Eq(values[0]), nil
+	case ne:
+		return q.And(field).Ne(values[0]), nil
+	case gt:
+		return q.And(field).Gt(values[0]), nil
+	case lt:
+		return q.And(field).Lt(values[0]), nil
+	case ge:
+		return q.And(field).Ge(values[0]), nil
+	case le:
+		return q.And(field).Le(values[0]), nil
+	case in:
+		return q.And(field).In(values...), nil
+	case isnil:
+		return q.And(field).IsNil(), nil
+	case sw, ew:
+		value, ok := values[0].(string)
+		if !ok {
+			return nil, typeErr(values[0], "string")
+		}
+		if operator == sw {
+			return q.And(field).HasPrefix(value), nil
+		}
+		return q.And(field).HasSuffix(value), nil
+	case hk:
+		return q.And(field).HasKey(values[0]), nil
+	case bp:
+		value, ok := values[0].([]byte)
+		if !ok {
+			return nil, typeErr(values[0], "[]byte")
+		}
+		return q.And(field).BytesPrefix(value), nil
+	case wd:
+		days := make([]time.Weekday, len(values))
+		for i := range values {
+			if days[i], ok = values[i].(time.Weekday); !ok {
+				return nil, typeErr(values[i], "time.Weekday")
+			}
+		}
+		return q.And(field).Weekday(days...), nil
+	case mo:
+		months := make([]time.Month, len(values))
+		for i := range values {
+			if months[i], ok = values[i].(time.Month); !ok {
+				return nil, typeErr(values[i], "time.Month")
+			}
+		}
+		return q.And(field).Month(months...), nil
+	case hb:
+		start, ok := values[0].(int)
+		if !ok {
+			return nil, typeErr(values[0], "int")
+		}
+		end, ok := values[1].(int)
+		if !ok {
+			return nil, typeErr(values[1], "int")
+		}
+		if start < 0 || start > 23 || end < 0 || end > 24 {
+			return nil, fmt.Errorf("The operator %s takes a start between 0 and 23, and an end between 0 and 24", op)
+		}
+		return q.And(field).HourBetween(start, end), nil
+	case ball, bany:
+		mask, ok := asBits(values[0])
+		if !ok {
+			return nil, typeErr(values[0], "integer")
+		}
+		if operator == ball {
+			return q.And(field).HasBits(mask), nil
+		}
+		return q.And(field).HasAnyBits(mask), nil
+	case contains:
+		return q.And(field).Contains(values[0]), nil
+	case any:
+		return q.And(field).ContainsAny(values...), nil
+	case all:
+		return q.And(field).ContainsAll(values...), nil
+	case subset:
+		return q.And(field).SubsetOf(values...), nil
+	case cm:
+		query, ok := values[0].(*Query)
+		if !ok || query == nil {
+			return nil, typeErr(values[0], "*Query")
+		}
+		return q.And(field).ContainsMatch(query), nil
+	default:
+		return nil, fmt.Errorf("The operator %s is not supported", op)
+	}
+}
+
+// takesValues returns whether the criteria of the operator hold a list of values, rather than a single value
+func takesValues(operator int) bool {
+	switch operator {
+	case in, wd, mo, hb, any, all, subset:
+		return true
+	}
+	return false
+}
+
 // Skip skips the number of records that match all the rest of the query criteria, and does not return them
 // in the result set.  Setting skip multiple times, or to a negative value will panic
 func (q *Query) Skip(amount int) *Query {
@@ -177,11 +610,32 @@ func (q *Query) Limit(amount int) *Query {
 	return q
 }
 
+// MaxResults has Find return ErrResultTooLarge if more than amount records match the query, rather than building
+// the whole result.  Unlike Limit, results are never silently truncated.  Overrides the MaxFindResults option.
+// Setting MaxResults to a negative value will panic
+func (q *Query) MaxResults(amount int) *Query {
+	if amount < 0 {
+		panic("MaxResults must be set to a positive number")
+	}
+
+	q.maxResults = amount
+
+	return q
+}
+
 // Contains tests if the current field is a slice that contains the passed in value
 func (c *Criterion) Contains(value interface{}) *Query {
 	return c.op(contains, value)
 }
 
+// ContainsMatch tests if the current field is a slice of structs, or pointers to structs, with an element that
+// matches the passed in query, whose fields are those of the elements.  Keys, limits, skips and sorts in the query
+// are ignored
+// i.e. Where("Items").ContainsMatch(badgerhold.Where("SKU").Eq("X").And("Quantity").Gt(1))
+func (c *Criterion) ContainsMatch(query *Query) *Query {
+	return c.op(cm, query)
+}
+
 // ContainsAll tests if the current field is a slice that contains all of the passed in values.  If any of the
 // values are NOT contained in the slice, then no match is made
 func (c *Criterion) ContainsAll(values ...interface{}) *Query {
@@ -189,6 +643,7 @@ func (c *Criterion) ContainsAll(values ...interface{}) *Query {
 	c.values = values
 
 	q := c.query
+	c.setLazy()
 	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
 
 	return q
@@ -201,18 +656,39 @@ func (c *Criterion) ContainsAny(values ...interface{}) *Query {
 	c.values = values
 
 	q := c.query
+	c.setLazy()
+	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
+
+	return q
+}
+
+// SubsetOf tests if the current field is a slice where every element is one of the passed in values.  An empty
+// slice is a subset of any values
+func (c *Criterion) SubsetOf(values ...interface{}) *Query {
+	c.operator = subset
+	c.values = values
+
+	q := c.query
+	c.setLazy()
 	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
 
 	return q
 }
 
+// SupersetOf tests if the current field is a slice that contains all of the passed in values, the same as
+// ContainsAll.  Every slice is a superset of no values
+func (c *Criterion) SupersetOf(values ...interface{}) *Query {
+	return c.ContainsAll(values...)
+}
+
 // HasKey tests if the field has a map key matching the passed in value
 func (c *Criterion) HasKey(value interface{}) *Query {
 	return c.op(hk, value)
 }
 
 // SortBy sorts the results by the given fields name
-// Multiple fields can be used
+// Multiple fields can be used.  Records with equal values in all of the sort fields are returned in key order
+// Sorting by a single indexed field reads the records in the order of the index, rather than sorting them all in memory
 func (q *Query) SortBy(fields ...string) *Query {
 	for i := range fields {
 		if fields[i] == Key {
@@ -232,8 +708,52 @@ func (q *Query) SortBy(fields ...string) *Query {
 	return q
 }
 
+// DistinctBy returns only the first record of each distinct set of values of the given fields, such as one record
+// per Category.  Records are deduplicated in the order they're returned, after sorting with SortBy and before
+// Skip and Limit are applied, so SortBy picks which record represents each set of values
+func (q *Query) DistinctBy(fields ...string) *Query {
+	for i := range fields {
+		if fields[i] == Key {
+			panic("Cannot use Key with DistinctBy, as keys are already distinct.")
+		}
+	}
+	q.distinct = append(q.distinct, fields...)
+	return q
+}
+
+// SizeGt matches only the records whose encoded value is larger than size bytes, such as to find the records
+// inflating the storage used by a type.  The size is read from the stored value, without decoding it.  Like
+// criteria, it applies to the query it's set on, and not to or'd queries
+func (q *Query) SizeGt(size int) *Query {
+	q.sizeGt = size
+	return q
+}
+
+// Collate sets the function used to compare string fields when sorting with SortBy, in place of comparing their
+// bytes.  The function returns a negative number if a sorts before b, 0 if they're equal and a positive number if
+// a sorts after b, so a golang.org/x/text/collate.Collator's CompareString method can be used for locale aware
+// sorting:
+//
+//	badgerhold.Where("Category").Eq("food").SortBy("Name").Collate(collate.New(language.German).CompareString)
+func (q *Query) Collate(collator func(a, b string) int) *Query {
+	q.collator = collator
+	return q
+}
+
+// Having filters the groups returned by FindAggregate and CountBy, keeping only those the passed in function returns
+// true for.  It's applied after the records are grouped, so it can test the count or other aggregates of each group:
+//
+//	store.FindAggregate(&Item{}, badgerhold.Where("Price").Gt(10).Having(func(r *badgerhold.AggregateResult) bool {
+//		return r.Count() > 5
+//	}), "Category")
+func (q *Query) Having(having func(result *AggregateResult) bool) *Query {
+	q.having = having
+	return q
+}
+
 // Reverse will reverse the current result set
-// useful with SortBy
+// With SortBy the sort order is reversed, otherwise records are returned in descending key order, or descending
+// index order if the query uses an index
 func (q *Query) Reverse() *Query {
 	q.reverse = !q.reverse
 	return q
@@ -249,7 +769,35 @@ func (q *Query) Index(indexName string) *Query {
 	return q
 }
 
-func (q *Query) validateIndex(data interface{}) error {
+// AutoIndex has the query pick which of the indexed fields in its criteria to use as its index each time it's run,
+// rather than only using the index specified with Index.  The index whose equality (Eq or In) criteria match the
+// fewest records, as estimated from the size of its entries, is used.  If none of the indexed fields have equality criteria,
+// the index specified with Index (if any) is used.  Like any query that uses an index, results are returned in
+// index order unless sorted
+func (q *Query) AutoIndex() *Query {
+	q.autoIndex = true
+	return q
+}
+
+// Fields declares the only fields the caller needs from the query's results, which may include Key.  If the index
+// the query uses holds every one of them and every field the query tests, it's a covering index, and the results
+// are built from the index entries alone without reading the records, leaving their other fields as zero values.
+// Only indexes declared with the badgerholdIndex tag can cover a query, and not bucketed ones.  Fields has no
+// effect on queries with or'd queries, and on those that aren't covered, which return entire records as usual
+// i.e. Where("Category").Eq("food").Index("Category").Fields("Category", badgerhold.Key)
+func (q *Query) Fields(fields ...string) *Query {
+	q.fields = append(q.fields, fields...)
+	return q
+}
+
+// NoIndex forces the query to run as a full scan of the records, ignoring any index specified with Index.
+// Useful when an index is less selective than scanning the records directly
+func (q *Query) NoIndex() *Query {
+	q.noIndex = true
+	return q
+}
+
+func (q *Query) validateIndex(data interface{}, storer Storer) error {
 	if q.index == "" {
 		return nil
 	}
@@ -257,6 +805,11 @@ func (q *Query) validateIndex(data interface{}) error {
 		panic("Can't check for a valid index before query datatype is set")
 	}
 
+	if index, ok := storer.Indexes()[q.index]; ok && index.partial() && !index.impliedBy(q) {
+		return fmt.Errorf("The index %s is partial, and the query doesn't include the criteria of its "+
+			"ConditionQuery, so it could match records missing from the index", q.index)
+	}
+
 	if storer, ok := data.(Storer); ok {
 		if _, ok = storer.Indexes()[q.index]; ok {
 			return nil
@@ -275,11 +828,91 @@ func (q *Query) validateIndex(data interface{}) error {
 			return nil
 		}
 	}
+	if _, ok := storer.Indexes()[q.index]; ok {
+		// a computed field
+		return nil
+	}
 	// no field name or custom index name found
 
 	return fmt.Errorf("The index %s does not exist", q.index)
 }
 
+// planIndex returns the query to run with the most selective index picked for it, for queries using AutoIndex.  The
+// index is picked on each run, so it's set on a copy of the query rather than the query itself.  Partial indexes are
+// never picked, as the query could match records missing from them
+func (s *Store) planIndex(tx *badger.Txn, storer Storer, query *Query) (*Query, error) {
+	if !query.autoIndex || query.noIndex {
+		return query, nil
+	}
+
+	run, err := query.resolve(s, tx)
+	if err != nil {
+		return nil, err
+	}
+	indexes := storer.Indexes()
+
+	for field, criteria := range run.fieldCriteria {
+		if index, ok := indexes[field]; ok && !index.partial() && streamCriterion(criteria) != nil {
+			// streamed values can only be looked up in their own index
+			return run.withIndex(field), nil
+		}
+	}
+
+	best := ""
+	var bestSize int64
+	for field, criteria := range run.fieldCriteria {
+		if index, ok := indexes[field]; !ok || index.partial() || needsRecord(criteria) {
+			continue
+		}
+
+		for _, c := range criteria {
+			var values []interface{}
+			switch c.operator {
+			case eq:
+				values = []interface{}{c.value}
+			case in:
+				values = c.values
+			default:
+				continue
+			}
+
+			size, err := s.indexEntriesSize(tx, storer, field, values...)
+			if err != nil {
+				return nil, err
+			}
+
+			// ties go to the lowest field name, so the same index is picked on each run
+			if best == "" || size < bestSize || (size == bestSize && field < best) {
+				best = field
+				bestSize = size
+			}
+		}
+	}
+
+	if best == "" {
+		return run, nil
+	}
+	return run.withIndex(best), nil
+}
+
+// withIndex returns a copy of the query that uses the index, with copies of its criteria that refer to it
+func (q *Query) withIndex(index string) *Query {
+	run := *q
+	run.index = index
+	run.autoIndex = false
+	run.fieldCriteria = make(map[string][]*Criterion, len(q.fieldCriteria))
+	for field, criteria := range q.fieldCriteria {
+		copied := make([]*Criterion, len(criteria))
+		for i, c := range criteria {
+			cc := *c
+			cc.query = &run
+			copied[i] = &cc
+		}
+		run.fieldCriteria[field] = copied
+	}
+	return &run
+}
+
 // Or creates another separate query that gets unioned with any other results in the query
 // Or will panic if the query passed in contains a limit or skip value, as they are only
 // allowed on top level queries
@@ -294,22 +927,63 @@ func (q *Query) Or(query *Query) *Query {
 // Matches returns whether the provided data matches the query.
 // Will match all field criteria, including nested OR queries, but ignores limits, skips, sort orders, etc.
 func (q *Query) Matches(s *Store, data interface{}) (bool, error) {
+	key, dataVal, err := s.matchValue(data)
+	if err != nil {
+		return false, err
+	}
+	q, err = q.resolve(s, nil)
+	if err != nil {
+		return false, err
+	}
+	return q.matches(s, key, dataVal, dataVal.Interface())
+}
+
+// MatchingQueries returns the indexes of the queries that the record matches, in the same way as Matches.  The
+// record's key is only encoded once for all of the queries.  A nil query matches every record
+func (s *Store) MatchingQueries(record interface{}, queries []*Query) ([]int, error) {
+	key, dataVal, err := s.matchValue(record)
+	if err != nil {
+		return nil, err
+	}
+	data := dataVal.Interface()
+
+	var matching []int
+	for i, q := range queries {
+		ok := true
+		if q != nil {
+			q, err = q.resolve(s, nil)
+			if err != nil {
+				return nil, err
+			}
+			ok, err = q.matches(s, key, dataVal, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			matching = append(matching, i)
+		}
+	}
+	return matching, nil
+}
+
+// matchValue returns the encoded key and dereferenced value of data, for matching it against queries
+func (s *Store) matchValue(data interface{}) ([]byte, reflect.Value, error) {
 	var key []byte
 	dataVal := reflect.ValueOf(data)
 	for dataVal.Kind() == reflect.Ptr {
 		dataVal = dataVal.Elem()
 	}
-	data = dataVal.Interface()
-	storer := s.newStorer(data)
+	storer := s.newStorer(dataVal.Interface())
 	if keyField, ok := getKeyField(dataVal.Type()); ok {
 		fieldValue := dataVal.FieldByName(keyField.Name)
 		var err error
 		key, err = s.encodeKey(fieldValue.Interface(), storer.Type())
 		if err != nil {
-			return false, err
+			return nil, dataVal, err
 		}
 	}
-	return q.matches(s, key, dataVal, data)
+	return key, dataVal, nil
 }
 
 func (q *Query) matches(s *Store, key []byte, value reflect.Value, data interface{}) (bool, error) {
@@ -330,13 +1004,13 @@ func (q *Query) matchesAllFields(s *Store, key []byte, value reflect.Value, curr
 	}
 
 	for field, criteria := range q.fieldCriteria {
-		if field == q.index && !q.badIndex && !hasMatchFunc(criteria) {
+		if field == q.index && !q.badIndex && !q.recheckIndex && !q.streamRead && !needsRecord(criteria) {
 			// already handled by index Iterator
 			continue
 		}
 
 		if field == Key {
-			ok, err := s.matchesAllCriteria(criteria, key, true, q.dataType.Name(), currentRow)
+			ok, err := s.matchesAllCriteria(criteria, key, true, s.namespaced(q.dataType.Name()), currentRow)
 			if err != nil {
 				return false, err
 			}
@@ -347,12 +1021,21 @@ func (q *Query) matchesAllFields(s *Store, key []byte, value reflect.Value, curr
 			continue
 		}
 
-		fVal, err := fieldValue(value, field)
-		if err != nil {
-			return false, err
+		fVal, ok := s.accessorValue(value, field)
+		if !ok {
+			var err error
+			fVal, err = fieldValue(value, field)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		var fieldInterface interface{}
+		if fVal.IsValid() {
+			fieldInterface = fVal.Interface()
 		}
 
-		ok, err := s.matchesAllCriteria(criteria, fVal.Interface(), false, "", currentRow)
+		ok, err := s.matchesAllCriteria(criteria, fieldInterface, false, "", currentRow)
 		if err != nil {
 			return false, err
 		}
@@ -386,16 +1069,28 @@ func (c *Criterion) op(op int, value interface{}) *Query {
 	c.value = value
 
 	q := c.query
+	c.setLazy()
 	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
 
 	return q
 }
 
 // Eq tests if the current field is Equal to the passed in value
+// Slices and arrays are equal if they have the same length and their elements are equal in the same order.  Use
+// ContainsAll to match slices that contain values in any order
 func (c *Criterion) Eq(value interface{}) *Query {
 	return c.op(eq, value)
 }
 
+// EqFunc tests if the current field is equal to the passed in value using the equal func instead of the default
+// comparison, such as for comparing normalized phone numbers.  equal is passed the field's value, dereferenced, and
+// value, and a nil field is passed as nil.  Queries with EqFunc can't be marshalled to JSON
+// i.e. Where("Phone").EqFunc("555-0100", func(a, b interface{}) bool { return digits(a) == digits(b) })
+func (c *Criterion) EqFunc(value interface{}, equal func(a, b interface{}) bool) *Query {
+	c.equal = equal
+	return c.op(eqf, value)
+}
+
 // Ne test if the current field is Not Equal to the passed in value
 func (c *Criterion) Ne(value interface{}) *Query {
 	return c.op(ne, value)
@@ -421,11 +1116,46 @@ func (c *Criterion) Le(value interface{}) *Query {
 	return c.op(le, value)
 }
 
+// WithinLast tests if a time.Time field is after the time d before the query is run, so a reused query always
+// matches the latest window.  i.e. Where("Created").WithinLast(24 * time.Hour)
+func (c *Criterion) WithinLast(d time.Duration) *Query {
+	return c.op(gt, Ago(d))
+}
+
+// OlderThan tests if a time.Time field is at or before the time d before the query is run, matching every record
+// WithinLast doesn't
+func (c *Criterion) OlderThan(d time.Duration) *Query {
+	return c.op(le, Ago(d))
+}
+
 // In test if the current field is a member of the slice of values passed in
 func (c *Criterion) In(values ...interface{}) *Query {
 	c.operator = in
 	c.values = values
 
+	q := c.query
+	c.setLazy()
+	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
+
+	return q
+}
+
+// InStream is the same as In, but the values are read one at a time from next until it returns false, rather than
+// all being held in memory, so records can be matched against very large sets of values such as those read from a
+// file or a channel:
+//
+//	badgerhold.Where("Category").InStream(func() (interface{}, bool) {
+//		value, ok := <-categories
+//		return value, ok
+//	}).Index("Category")
+//
+// Each value is looked up in the index, so the field must be the Key or the index used by the query, otherwise the
+// query returns an error.  Records are returned in the order of the values.  The values are only read once, so the
+// query can only be run once
+func (c *Criterion) InStream(next func() (interface{}, bool)) *Query {
+	c.operator = ins
+	c.stream = next
+
 	q := c.query
 	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
 
@@ -438,6 +1168,13 @@ func (c *Criterion) RegExp(expression *regexp.Regexp) *Query {
 	return c.op(re, expression)
 }
 
+// RegExpString will test if a field matches against the regular expression
+// Unlike RegExp, the Field Value is converted using its default format (%v) before testing, so numeric fields
+// are matched against their decimal string.  i.e. Where("ID").RegExpString(regexp.MustCompile("^42"))
+func (c *Criterion) RegExpString(expression *regexp.Regexp) *Query {
+	return c.op(rev, expression)
+}
+
 // IsNil will test if a field is equal to nil
 func (c *Criterion) IsNil() *Query {
 	return c.op(isnil, nil)
@@ -448,6 +1185,63 @@ func (c *Criterion) HasPrefix(prefix string) *Query {
 	return c.op(sw, prefix)
 }
 
+// BytesPrefix will test if a []byte or byte array field starts with the provided bytes.  Unlike HasPrefix, the
+// field is not converted to a string first, so it can be used with binary data such as hashes
+func (c *Criterion) BytesPrefix(prefix []byte) *Query {
+	return c.op(bp, prefix)
+}
+
+// HasBits will test if an integer field has all of the bits in mask set, such as for a field holding bit flags.
+// i.e. Where("Flags").HasBits(FlagAdmin | FlagActive)
+func (c *Criterion) HasBits(mask uint64) *Query {
+	return c.op(ball, mask)
+}
+
+// HasAnyBits will test if an integer field has any of the bits in mask set
+func (c *Criterion) HasAnyBits(mask uint64) *Query {
+	return c.op(bany, mask)
+}
+
+// Weekday will test if a time.Time field falls on one of the passed in days of the week, in the time's own location.
+// i.e. Where("Created").Weekday(time.Saturday, time.Sunday)
+func (c *Criterion) Weekday(days ...time.Weekday) *Query {
+	values := make([]interface{}, len(days))
+	for i := range days {
+		values[i] = days[i]
+	}
+	return c.timeOp(wd, values)
+}
+
+// Month will test if a time.Time field falls in one of the passed in months, in the time's own location
+func (c *Criterion) Month(months ...time.Month) *Query {
+	values := make([]interface{}, len(months))
+	for i := range months {
+		values[i] = months[i]
+	}
+	return c.timeOp(mo, values)
+}
+
+// HourBetween will test if the hour of a time.Time field, in the time's own location, is at or after start and
+// before end.  i.e. HourBetween(9, 17) matches from 9:00 up to, but not including, 17:00.  If start is after end, the
+// range wraps past midnight, so HourBetween(22, 6) matches from 22:00 to 6:00
+func (c *Criterion) HourBetween(start, end int) *Query {
+	if start < 0 || start > 23 || end < 0 || end > 24 {
+		panic("HourBetween start must be between 0 and 23, and end between 0 and 24")
+	}
+	return c.timeOp(hb, []interface{}{start, end})
+}
+
+func (c *Criterion) timeOp(op int, values []interface{}) *Query {
+	c.operator = op
+	c.values = values
+
+	q := c.query
+	c.setLazy()
+	q.fieldCriteria[q.currentField] = append(q.fieldCriteria[q.currentField], c)
+
+	return q
+}
+
 // HasSuffix will test if a field ends with provided string
 func (c *Criterion) HasSuffix(suffix string) *Query {
 	return c.op(ew, suffix)
@@ -475,20 +1269,43 @@ func (r *RecordAccess) Record() interface{} {
 	return r.record
 }
 
+// ErrResultTooLarge is returned by Find when more records match the query than the MaxResults of the query or the
+// MaxFindResults option allow
+var ErrResultTooLarge = errors.New("This query matches more records than the maximum number of results allowed")
+
+// ErrSubQueryDepth is returned when sub-queries are nested deeper than the MaxSubQueryDepth option allows
+var ErrSubQueryDepth = errors.New("The maximum sub-query depth has been exceeded")
+
 // SubQuery allows you to run another query in the same transaction for each
 // record in a parent query
 func (r *RecordAccess) SubQuery(result interface{}, query *Query) error {
-	query.subquery = true
-	query.bookmark = r.query.bookmark
+	err := r.prepareSubQuery(query)
+	if err != nil {
+		return err
+	}
 	return r.store.findQuery(r.query.tx, result, query)
 }
 
 // SubAggregateQuery allows you to run another aggregate query in the same transaction for each
 // record in a parent query
 func (r *RecordAccess) SubAggregateQuery(query *Query, groupBy ...string) ([]*AggregateResult, error) {
+	err := r.prepareSubQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return r.store.aggregateQuery(r.query.tx, r.record, query, groupBy...)
+}
+
+func (r *RecordAccess) prepareSubQuery(query *Query) error {
+	depth := r.query.depth + 1
+	if r.store.maxSubQueryDepth > 0 && depth > r.store.maxSubQueryDepth {
+		return ErrSubQueryDepth
+	}
+
 	query.subquery = true
+	query.depth = depth
 	query.bookmark = r.query.bookmark
-	return r.store.aggregateQuery(r.query.tx, r.record, query, groupBy...)
+	return nil
 }
 
 // MatchFunc will test if a field matches the passed in function
@@ -503,10 +1320,17 @@ func (c *Criterion) MatchFunc(match MatchFunc) *Query {
 
 // test if the criterion passes with the passed in value
 func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, keyType string, currentRow interface{}) (bool, error) {
+	if c.operator == ins {
+		// only records with the values read from the stream are iterated over
+		return true, nil
+	}
+
 	var recordValue interface{}
 	if encoded {
 		if len(testValue.([]byte)) != 0 {
-			if c.operator == in || c.operator == any || c.operator == all {
+			if c.operator == wd || c.operator == mo || c.operator == hb {
+				recordValue = &time.Time{}
+			} else if c.operator == in || c.operator == any || c.operator == all {
 				// value is a slice of values, use c.values
 				recordValue = newElemType(c.values[0])
 			} else {
@@ -530,6 +1354,20 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, keyType
 		recordValue = testValue
 	}
 
+	if c.jsonSegments != nil {
+		value, found, err := jsonPathValue(recordValue, c.jsonSegments)
+		if err != nil {
+			return false, err
+		}
+		if !found || value == nil {
+			return c.operator == isnil, nil
+		}
+		if c.operator == isnil {
+			return false, nil
+		}
+		recordValue = value
+	}
+
 	switch c.operator {
 	case in:
 		for i := range c.values {
@@ -545,6 +1383,8 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, keyType
 		return false, nil
 	case re:
 		return c.value.(*regexp.Regexp).Match([]byte(fmt.Sprintf("%s", recordValue))), nil
+	case rev:
+		return c.value.(*regexp.Regexp).MatchString(fmt.Sprintf("%v", getElem(recordValue))), nil
 	case hk:
 		v := reflect.ValueOf(recordValue).MapIndex(reflect.ValueOf(c.value))
 		return !reflect.ValueOf(v).IsZero(), nil
@@ -561,7 +1401,90 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, keyType
 		return strings.HasPrefix(fmt.Sprintf("%s", getElem(recordValue)), fmt.Sprintf("%s", c.value)), nil
 	case ew:
 		return strings.HasSuffix(fmt.Sprintf("%s", getElem(recordValue)), fmt.Sprintf("%s", c.value)), nil
-	case contains, any, all:
+	case bp:
+		value, ok := asBytes(recordValue)
+		if !ok {
+			return false, &ErrTypeMismatch{recordValue, c.value}
+		}
+		return bytes.HasPrefix(value, c.value.([]byte)), nil
+	case cm:
+		slc := reflect.ValueOf(recordValue)
+		for slc.Kind() == reflect.Ptr && !slc.IsNil() {
+			slc = slc.Elem()
+		}
+		if slc.Kind() != reflect.Slice && slc.Kind() != reflect.Array {
+			return false, fmt.Errorf("%v (%T) is not a slice and cannot be tested with %s", recordValue,
+				recordValue, c)
+		}
+
+		query := c.value.(*Query)
+		for i := 0; i < slc.Len(); i++ {
+			elem := slc.Index(i)
+			for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Ptr {
+				continue
+			}
+
+			ok, err := query.matches(s, nil, elem, elem.Interface())
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	case eqf:
+		value := reflect.ValueOf(recordValue)
+		for value.Kind() == reflect.Ptr && !value.IsNil() {
+			value = value.Elem()
+		}
+		if !value.IsValid() || value.Kind() == reflect.Ptr {
+			return c.equal(nil, c.value), nil
+		}
+		return c.equal(value.Interface(), c.value), nil
+	case ball, bany:
+		bits, ok := asBits(recordValue)
+		if !ok {
+			return false, fmt.Errorf("%v (%T) is not an integer and cannot be tested with %s", recordValue,
+				recordValue, c)
+		}
+		mask := c.value.(uint64)
+		if c.operator == ball {
+			return bits&mask == mask, nil
+		}
+		return bits&mask != 0, nil
+	case wd, mo, hb:
+		tm, ok := getElem(recordValue).(time.Time)
+		if !ok {
+			return false, fmt.Errorf("%v (%T) is not a time.Time and cannot be tested with %s", recordValue,
+				recordValue, c)
+		}
+		switch c.operator {
+		case wd:
+			for i := range c.values {
+				if tm.Weekday() == c.values[i] {
+					return true, nil
+				}
+			}
+			return false, nil
+		case mo:
+			for i := range c.values {
+				if tm.Month() == c.values[i] {
+					return true, nil
+				}
+			}
+			return false, nil
+		default:
+			start, end := c.values[0].(int), c.values[1].(int)
+			if start > end {
+				return tm.Hour() >= start || tm.Hour() < end, nil
+			}
+			return tm.Hour() >= start && tm.Hour() < end, nil
+		}
+	case contains, any, all, subset:
 		slc := reflect.ValueOf(recordValue)
 		kind := slc.Kind()
 		if kind != reflect.Slice && kind != reflect.Array {
@@ -601,6 +1524,27 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, keyType
 			return false, nil
 		}
 
+		if c.operator == subset {
+			for i := 0; i < slc.Len(); i++ {
+				found := false
+				for k := range c.values {
+					result, err := c.compare(slc.Index(i), c.values[k], currentRow)
+					if err != nil {
+						return false, err
+					}
+					if result == 0 {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return false, nil
+				}
+			}
+
+			return true, nil
+		}
+
 		// c.operator == all {
 		for k := range c.values {
 			found := false
@@ -646,6 +1590,56 @@ func (c *Criterion) test(s *Store, testValue interface{}, encoded bool, keyType
 	}
 }
 
+// asBytes returns the bytes of a byte slice or byte array value
+func asBytes(value interface{}) ([]byte, bool) {
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	if (val.Kind() != reflect.Slice && val.Kind() != reflect.Array) || val.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, false
+	}
+
+	if val.Kind() == reflect.Slice {
+		return val.Bytes(), true
+	}
+
+	result := make([]byte, val.Len())
+	reflect.Copy(reflect.ValueOf(result), val)
+	return result, true
+}
+
+// asBits returns the bits of an integer value.  Negative values are returned as their two's complement bits, and
+// nil pointers to integers have no bits set
+func asBits(value interface{}) (uint64, bool) {
+	val := reflect.ValueOf(value)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return 0, isInteger(dereference(val.Type()))
+		}
+		val = val.Elem()
+	}
+
+	if !val.IsValid() || !isInteger(val.Type()) {
+		return 0, false
+	}
+	if val.CanInt() {
+		return uint64(val.Int()), true
+	}
+	return val.Uint(), true
+}
+
+func isInteger(tp reflect.Type) bool {
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Store) matchesAllCriteria(criteria []*Criterion, value interface{}, encoded bool, keyType string,
 	currentRow interface{}) (bool, error) {
 
@@ -701,6 +1695,9 @@ func (q *Query) String() string {
 
 func (c *Criterion) String() string {
 	s := ""
+	if c.jsonPath != "" {
+		s += c.jsonPath + " "
+	}
 	switch c.operator {
 	case eq:
 		s += "=="
@@ -715,17 +1712,37 @@ func (c *Criterion) String() string {
 	case ge:
 		s += ">="
 	case in:
-		return "in " + fmt.Sprintf("%v", c.values)
-	case re:
+		return s + "in " + fmt.Sprintf("%v", c.values)
+	case subset:
+		return s + "is a subset of " + fmt.Sprintf("%v", c.values)
+	case re, rev:
 		s += "matches the regular expression"
 	case fn:
 		s += "matches the function"
 	case isnil:
-		return "is nil"
+		return s + "is nil"
 	case sw:
-		return "starts with " + fmt.Sprintf("%+v", c.value)
+		return s + "starts with " + fmt.Sprintf("%+v", c.value)
 	case ew:
-		return "ends with " + fmt.Sprintf("%+v", c.value)
+		return s + "ends with " + fmt.Sprintf("%+v", c.value)
+	case bp:
+		return s + "starts with the bytes " + fmt.Sprintf("%x", c.value)
+	case wd:
+		return s + "falls on the weekdays " + fmt.Sprintf("%v", c.values)
+	case mo:
+		return s + "falls in the months " + fmt.Sprintf("%v", c.values)
+	case hb:
+		return s + fmt.Sprintf("has an hour between %d and %d", c.values[0], c.values[1])
+	case ins:
+		return s + "in a stream of values"
+	case ball:
+		return s + fmt.Sprintf("has all of the bits %b", c.value)
+	case bany:
+		return s + fmt.Sprintf("has any of the bits %b", c.value)
+	case eqf:
+		return s + fmt.Sprintf("is equal by func to %v", c.value)
+	case cm:
+		return s + fmt.Sprintf("contains an element matching (%s)", c.value)
 	default:
 		panic("invalid operator")
 	}
@@ -735,6 +1752,7 @@ func (c *Criterion) String() string {
 type record struct {
 	key   []byte
 	value reflect.Value
+	raw   []byte // encoded value, only valid for the life of the transaction
 }
 
 func (s *Store) runQuery(tx *badger.Txn, dataType interface{}, query *Query, retrievedKeys KeyList, skip int,
@@ -747,17 +1765,56 @@ func (s *Store) runQuery(tx *badger.Txn, dataType interface{}, query *Query, ret
 		tp = reflect.ValueOf(tp).Elem().Interface()
 	}
 
+	query, err := query.resolve(s, tx)
+	if err != nil {
+		return err
+	}
 	query.dataType = reflect.TypeOf(tp)
-	err := query.validateIndex(dataType)
+	if union, ok := query.orIndexUnion(storer); ok {
+		return s.runQuery(tx, dataType, union, retrievedKeys, skip, action)
+	}
+	if query.streamRead {
+		return s.runStreamQuery(storer, query, action)
+	}
+	query, err = s.planIndex(tx, storer, query)
+	if err != nil {
+		return err
+	}
+	err = query.validateIndex(dataType, storer)
 	if err != nil {
 		return err
 	}
+	for field, criteria := range query.fieldCriteria {
+		if field != query.index && streamCriterion(criteria) != nil {
+			return fmt.Errorf("The field %s must be the Key or the index used by the query to use InStream", field)
+		}
+	}
 
-	if len(query.sort) > 0 {
+	err = validateFields(query, query.distinct)
+	if err != nil {
+		return err
+	}
+
+	if key, ok := query.keyLookup(); ok {
+		return s.runKeyLookup(tx, storer, query, key, retrievedKeys, skip, action)
+	}
+
+	if len(query.sort) > 0 || query.dropLast > 0 || (len(query.distinct) > 0 && len(query.ors) > 0) ||
+		(query.reverse && (query.writable || query.subquery || query.bookmark != nil || len(query.ors) > 0)) {
+		// shared iterators can't be reversed, and or'd queries are merged, so reverse or deduplicate the entire
+		// result set
+		if query.indexSortable(storer) {
+			return s.runQueryIndexSort(tx, storer, query, action)
+		}
 		return s.runQuerySort(tx, dataType, query, action)
 	}
 
-	iter := s.newIterator(tx, storer.Type(), query, query.bookmark)
+	query.covering = query.coveredByIndex(storer)
+	defer func() {
+		query.covering = false
+	}()
+
+	iter := s.newIterator(tx, storer, query, query.bookmark)
 	if (query.writable || query.subquery) && query.bookmark == nil {
 		query.bookmark = iter.createBookmark()
 	}
@@ -774,54 +1831,124 @@ func (s *Store) runQuery(tx *badger.Txn, dataType interface{}, query *Query, ret
 	newKeys := make(KeyList, 0)
 
 	limit := query.limit - len(retrievedKeys)
+	distinct := s.distinctFilter(query)
+
+	// records only need to be decoded before matching if the criteria test the value, otherwise decoding
+	// is put off until the record is known to be returned
+	needsValue := query.needsValue()
+
+	// records are read in batches so they can be decoded by multiple workers, batches are a single record when
+	// decoding isn't spread across workers
+	batchSize := 1
+	if s.decodeWorkers > 1 && !query.writable {
+		batchSize = s.decodeWorkers * decodeBatchPerWorker
+	}
+
+	batch := make([]*record, 0, batchSize)
+	for done := false; !done; {
+		batch = batch[:0]
+		for len(batch) < batchSize {
+			k, v := iter.Next()
+			if k == nil {
+				done = true
+				break
+			}
+
+			if len(retrievedKeys) != 0 {
+				// don't check this record if it's already been retrieved
+				if retrievedKeys.In(k) {
+					continue
+				}
+			}
 
-	for k, v := iter.Next(); k != nil; k, v = iter.Next() {
-		if len(retrievedKeys) != 0 {
-			// don't check this record if it's already been retrieved
-			if retrievedKeys.in(k) {
+			if query.sizeGt > 0 && len(v) <= query.sizeGt {
 				continue
 			}
-		}
 
-		val := reflect.New(reflect.TypeOf(tp))
+			if batchSize > 1 {
+				// the value is decoded after the iterator has moved on to other records
+				v = append([]byte(nil), v...)
+			}
 
-		err := s.decode(v, val.Interface())
-		if err != nil {
-			return err
+			batch = append(batch, &record{
+				key:   k,
+				value: query.newRecordValue(),
+				raw:   v,
+			})
+		}
+
+		if needsValue {
+			batch, err = s.decodeRecords(query, batch)
+			if err != nil {
+				return err
+			}
 		}
 
 		query.tx = tx
 
-		ok, err := query.matchesAllFields(s, k, val, val.Interface())
-		if err != nil {
-			return err
-		}
+		matched := batch[:0]
+		for _, r := range batch {
+			ok, err := query.matchesAllFields(s, r.key, r.value, r.value.Interface())
+			if err != nil {
+				return err
+			}
+
+			if ok && query.except != nil {
+				query.except.tx = tx
+				excluded, err := query.except.matches(s, r.key, r.value, r.value.Interface())
+				if err != nil {
+					return err
+				}
+				ok = !excluded
+			}
+
+			if ok && distinct != nil {
+				ok, err = distinct(r.value)
+				if err != nil {
+					return err
+				}
+			}
+
+			if !ok {
+				query.releaseRecord(r)
+				continue
+			}
 
-		if ok {
 			if skip > 0 {
 				skip--
+				query.releaseRecord(r)
 				continue
 			}
+			matched = append(matched, r)
+		}
 
-			err = action(&record{
-				key:   k,
-				value: val,
-			})
+		if !needsValue && !query.skipDecode {
+			matched, err = s.decodeRecords(query, matched)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, r := range matched {
+			err = action(r)
 			if err != nil {
 				return err
 			}
 
 			// track that this key's entry has been added to the result list
-			newKeys.add(k)
+			newKeys.Add(r.key)
 
 			if query.limit != 0 {
 				limit--
 				if limit == 0 {
+					for _, unused := range matched[i+1:] {
+						query.releaseRecord(unused)
+					}
+					done = true
 					break
 				}
 			}
 		}
-
 	}
 
 	if iter.Error() != nil {
@@ -835,11 +1962,20 @@ func (s *Store) runQuery(tx *badger.Txn, dataType interface{}, query *Query, ret
 	if len(query.ors) > 0 {
 		iter.Close()
 		for i := range newKeys {
-			retrievedKeys.add(newKeys[i])
+			retrievedKeys.Add(newKeys[i])
 		}
 
 		for i := range query.ors {
+			query.ors[i].skipDecode = query.skipDecode
+			query.ors[i].depth = query.depth
+			query.ors[i].decodeErrors = query.decodeErrors
+			query.ors[i].except = query.except
+			query.ors[i].pool = query.pool
 			err := s.runQuery(tx, tp, query.ors[i], retrievedKeys, skip, action)
+			query.ors[i].skipDecode = false
+			query.ors[i].pool = nil
+			query.ors[i].decodeErrors = nil
+			query.ors[i].except = nil
 			if err != nil {
 				return err
 			}
@@ -849,292 +1985,1577 @@ func (s *Store) runQuery(tx *badger.Txn, dataType interface{}, query *Query, ret
 	return nil
 }
 
-// runQuerySort runs the query without sort, skip, or limit, then applies them to the entire result set
-func (s *Store) runQuerySort(tx *badger.Txn, dataType interface{}, query *Query, action func(r *record) error) error {
-	err := validateSortFields(query)
-	if err != nil {
-		return err
-	}
-
-	// Run query without sort, skip or limit
-	// apply sort, skip and limit to entire dataset
-	qCopy := *query
-	qCopy.sort = nil
-	qCopy.limit = 0
-	qCopy.skip = 0
-
-	var records []*record
-	err = s.runQuery(tx, dataType, &qCopy, nil, 0,
-		func(r *record) error {
-			records = append(records, r)
-
-			return nil
-		})
+// useStreamReads returns whether the query is read with badger's Stream, which is only used for full scans with no
+// order, as the records are read in no particular order
+func (s *Store) useStreamReads(query *Query) bool {
+	return s.streamReads && query.streamReadable()
+}
 
-	if err != nil {
-		return err
+func (q *Query) streamReadable() bool {
+	if (q.index != "" && !q.noIndex) || q.autoIndex || len(q.sort) > 0 || q.reverse || q.skip != 0 ||
+		q.limit != 0 || q.dropLast != 0 || len(q.distinct) > 0 || q.sizeGt > 0 || q.except != nil ||
+		q.bookmark != nil || q.writable {
+		return false
+	}
+	if _, ok := q.keyLookup(); ok {
+		return false
+	}
+	for _, criteria := range q.fieldCriteria {
+		if streamCriterion(criteria) != nil {
+			return false
+		}
+	}
+	for i := range q.ors {
+		if !q.ors[i].streamReadable() {
+			return false
+		}
 	}
+	return true
+}
 
+// bind sets the transaction and type the query and its or'd queries are matched in, and whether they're matched
+// against records read with badger's Stream, which have none of their criteria tested by an iterator
+func (q *Query) bind(tx *badger.Txn, dataType reflect.Type, streamRead bool) {
+	q.tx = tx
+	q.dataType = dataType
+	q.streamRead = streamRead
+	for i := range q.ors {
+		q.ors[i].bind(tx, dataType, streamRead)
+	}
+}
+
+// runStreamQuery runs the query against every record of the type, read with badger's Stream.  Each batch of records
+// sent by the stream is matched in its own read transaction, so no transaction is held open for the entire scan
+func (s *Store) runStreamQuery(storer Storer, query *Query, action func(r *record) error) error {
+	tp := query.dataType
+
+	stream := s.Badger().NewStream()
+	stream.Prefix = typePrefix(storer.Type())
+	stream.LogPrefix = "badgerhold.StreamReads"
+	stream.KeyToList = func(key []byte, itr *badger.Iterator) (*pb.KVList, error) {
+		// only the latest version of each record is read
+		item := itr.Item()
+		if item.IsDeletedOrExpired() {
+			return nil, nil
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.KVList{Kv: []*pb.KV{{Key: key, Value: value}}}, nil
+	}
+
+	// the stream may report its own cancellation rather than the error that stopped it
+	var sendErr error
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+
+		sendErr = s.view(func(tx *badger.Txn) error {
+			batch := make([]*record, 0, len(list.Kv))
+			for _, kv := range list.Kv {
+				batch = append(batch, &record{
+					key:   kv.Key,
+					value: query.newRecordValue(),
+					raw:   kv.Value,
+				})
+			}
+
+			batch, err := s.decodeRecords(query, batch)
+			if err != nil {
+				return err
+			}
+
+			query.bind(tx, tp, true)
+			for _, r := range batch {
+				ok, err := query.matches(s, r.key, r.value, r.value.Interface())
+				if err != nil {
+					return err
+				}
+				if !ok {
+					query.releaseRecord(r)
+					continue
+				}
+
+				err = action(r)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return sendErr
+	}
+
+	err := stream.Orchestrate(context.Background())
+	query.bind(nil, tp, false)
+	if sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// keyLookup returns the key value if the only criteria of the query is the Key equal to a value, so the record can be
+// read directly instead of iterating through the records
+func (q *Query) keyLookup() (interface{}, bool) {
+	if len(q.fieldCriteria) != 1 || len(q.fieldCriteria[Key]) != 1 || len(q.ors) != 0 || q.dropLast != 0 {
+		return nil, false
+	}
+
+	c := q.fieldCriteria[Key][0]
+	if c.operator != eq || c.jsonSegments != nil || c.value == nil {
+		return nil, false
+	}
+
+	switch c.value.(type) {
+	case Field, Comparer:
+		// compared by more than the encoded bytes
+		return nil, false
+	}
+
+	return c.value, true
+}
+
+// runKeyLookup runs the action against the record with the passed in key, if it exists
+func (s *Store) runKeyLookup(tx *badger.Txn, storer Storer, query *Query, key interface{}, retrievedKeys KeyList,
+	skip int, action func(r *record) error) error {
+	gk, err := s.encodeKey(key, storer.Type())
+	if err != nil {
+		return err
+	}
+
+	if skip > 0 || retrievedKeys.In(gk) {
+		return nil
+	}
+
+	item, err := tx.Get(gk)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if query.sizeGt > 0 && item.ValueSize() <= int64(query.sizeGt) {
+		return nil
+	}
+
+	raw, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	r := &record{
+		key:   gk,
+		value: query.newRecordValue(),
+		raw:   raw,
+	}
+
+	if !query.skipDecode || query.except != nil {
+		err = s.recordDecoder(query)(raw, r.value.Interface())
+		if err != nil {
+			return query.decodeFailed(gk, err)
+		}
+	}
+
+	query.tx = tx
+	if query.except != nil {
+		excluded, err := query.except.matches(s, r.key, r.value, r.value.Interface())
+		if err != nil {
+			return err
+		}
+		if excluded {
+			query.releaseRecord(r)
+			return nil
+		}
+	}
+
+	return action(r)
+}
+
+// runQuerySort runs the query without sort, skip, or limit, then applies them to the entire result set
+func (s *Store) runQuerySort(tx *badger.Txn, dataType interface{}, query *Query, action func(r *record) error) error {
+	err := validateSortFields(query)
+	if err != nil {
+		return err
+	}
+
+	// Run query without sort, skip or limit
+	// apply sort, skip and limit to entire dataset
+	qCopy := *query
+	qCopy.sort = nil
+	qCopy.limit = 0
+	qCopy.skip = 0
+	qCopy.dropLast = 0
+	qCopy.distinct = nil
+	qCopy.skipDecode = false
+	qCopy.reverse = false
+	qCopy.maxMatches = 0
+	// every record is held until they're sorted, so there's nothing to gain from pooling them
+	qCopy.pool = nil
+	if len(query.fields) > 0 {
+		// the records are sorted and deduplicated by their fields, so those are needed too
+		qCopy.fields = append(append(append([]string(nil), query.fields...), query.sort...), query.distinct...)
+	}
+
+	// records with the same distinct values only count once towards the most records a Find can return
+	matched := 0
+	distinctMatch := s.distinctFilter(query)
+
+	var records []*record
+	err = s.runQuery(tx, dataType, &qCopy, nil, 0,
+		func(r *record) error {
+			records = append(records, r)
+
+			if query.maxMatches > 0 {
+				ok := true
+				if distinctMatch != nil {
+					var err error
+					ok, err = distinctMatch(r.value)
+					if err != nil {
+						return err
+					}
+				}
+				if ok {
+					matched++
+					if query.exceedsMax(query.maxMatches, matched) {
+						return ErrResultTooLarge
+					}
+				}
+			}
+
+			return nil
+		})
+
+	if err != nil {
+		return err
+	}
+
+	// records with equal sort values are ordered by their key, so the results are deterministic
 	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i].key, records[j].key) < 0
+	})
+	sort.SliceStable(records, func(i, j int) bool {
 		return sortFunction(query, records[i].value, records[j].value)
 	})
+	if query.reverse && len(query.sort) == 0 {
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+
+	if distinct := s.distinctFilter(query); distinct != nil {
+		unique := records[:0]
+		for _, r := range records {
+			ok, err := distinct(r.value)
+			if err != nil {
+				return err
+			}
+			if ok {
+				unique = append(unique, r)
+			}
+		}
+		records = unique
+	}
+
+	startIndex, endIndex := getSkipAndLimitRange(query, len(records))
+	records = records[startIndex:endIndex]
+
+	for i := range records {
+		err = action(records[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexEntry is an entry of an index, with its value decoded
+type indexEntry struct {
+	key   []byte // the badger key of the entry
+	value interface{}
+}
+
+// sortedIndexEntries returns the entries of the index with values matching the criteria, decoded into valueType
+// and sorted by their values.  The index is ordered by the encoded values, which isn't necessarily the order of
+// the values themselves
+func (s *Store) sortedIndexEntries(tx *badger.Txn, storer Storer, indexName string, valueType reflect.Type,
+	criteria []*Criterion, reverse bool) ([]indexEntry, error) {
+	index := storer.Indexes()[indexName]
+	prefix := s.indexKeyPrefix(storer.Type(), indexName)
+
+	var entries []indexEntry
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	iter := tx.NewIterator(opts)
+	defer iter.Close()
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		key := iter.Item().KeyCopy(nil)
+		encoded := index.value(key[len(prefix):])
+
+		ok, err := s.matchesAllCriteria(criteria, encoded, true, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		value := reflect.New(valueType)
+		err = s.decode(encoded, value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, indexEntry{key: key, value: value.Elem().Interface()})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if reverse {
+			return sortCompare(entries[j].value, entries[i].value) < 0
+		}
+		return sortCompare(entries[i].value, entries[j].value) < 0
+	})
+	return entries, nil
+}
+
+// indexSortable returns whether the results of the query can be read in order from the index of its sort field,
+// rather than sorting every matching record in memory
+func (q *Query) indexSortable(storer Storer) bool {
+	if len(q.sort) != 1 || q.dropLast > 0 || q.collator != nil || len(q.ors) > 0 || q.writable || q.subquery ||
+		q.bookmark != nil || len(q.fields) > 0 {
+		// only entire records are read in index order
+		return false
+	}
+	if _, ok := storer.(*anonStorer); !ok {
+		// the values of custom indexes can be anything
+		return false
+	}
+
+	field := q.sort[0]
+	if q.index != "" && q.index != field {
+		// the query is already using another index
+		return false
+	}
+	index, ok := storer.Indexes()[field]
+	if !ok || index.Bucket > 0 || index.partial() {
+		return false
+	}
+	structField, ok := q.dataType.FieldByName(field)
+	if !ok {
+		return false
+	}
+	switch structField.Type.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		// nil values aren't in the index
+		return false
+	}
+
+	criteria := q.fieldCriteria[field]
+	return !needsRecord(criteria) && streamCriterion(criteria) == nil
+}
+
+// runQueryIndexSort runs a query sorted by an indexed field.  Only the distinct values in the index are sorted in
+// memory, the records are then read one value at a time, applying skip and limit as they're read
+func (s *Store) runQueryIndexSort(tx *badger.Txn, storer Storer, query *Query, action func(r *record) error) error {
+	field := query.sort[0]
+	structField, _ := query.dataType.FieldByName(field)
+	values, err := s.sortedIndexEntries(tx, storer, field, structField.Type, query.fieldCriteria[field],
+		query.reverse)
+	if err != nil {
+		return err
+	}
+
+	skip := query.skip
+	limit := query.limit
+	distinct := s.distinctFilter(query)
+	query.tx = tx
+	for start := 0; start < len(values); {
+		// records with equal sort values are ordered by their key, even if their values are stored separately
+		var keys KeyList
+		end := start
+		for ; end < len(values) && sortCompare(values[start].value, values[end].value) == 0; end++ {
+			item, err := tx.Get(values[end].key)
+			if err != nil {
+				return err
+			}
+			var entryKeys KeyList
+			err = item.Value(func(val []byte) error {
+				return s.decode(val, &entryKeys)
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range entryKeys {
+				keys.Add(k)
+			}
+		}
+		start = end
+
+		for _, k := range keys {
+			item, err := tx.Get(k)
+			if err != nil {
+				return err
+			}
+			if query.sizeGt > 0 && item.ValueSize() <= int64(query.sizeGt) {
+				continue
+			}
+			r := &record{
+				key:   k,
+				value: query.newRecordValue(),
+			}
+			err = item.Value(func(val []byte) error {
+				return s.decodeRecord(val, r.value.Interface())
+			})
+			if err != nil {
+				if err = query.decodeFailed(k, err); err != nil {
+					return err
+				}
+				query.releaseRecord(r)
+				continue
+			}
+
+			ok, err := query.matchesAllFields(s, r.key, r.value, r.value.Interface())
+			if err != nil {
+				return err
+			}
+			if ok && query.except != nil {
+				query.except.tx = tx
+				excluded, err := query.except.matches(s, r.key, r.value, r.value.Interface())
+				if err != nil {
+					return err
+				}
+				ok = !excluded
+			}
+			if ok && distinct != nil {
+				ok, err = distinct(r.value)
+				if err != nil {
+					return err
+				}
+			}
+			if !ok {
+				query.releaseRecord(r)
+				continue
+			}
+
+			if skip > 0 {
+				skip--
+				query.releaseRecord(r)
+				continue
+			}
+
+			err = action(r)
+			if err != nil {
+				return err
+			}
+
+			if query.limit != 0 {
+				limit--
+				if limit == 0 {
+					return nil
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// number of records read ahead for each decode worker
+const decodeBatchPerWorker = 16
+
+// decodeRecords decodes the values of the records, spread across the decode workers.  Records that fail to decode
+// are left out of the returned records if the query collects decode errors
+func (s *Store) decodeRecords(query *Query, records []*record) ([]*record, error) {
+	decode := s.recordDecoder(query)
+	if s.decodeWorkers <= 1 || len(records) < 2 {
+		decoded := records[:0]
+		for _, r := range records {
+			err := decode(r.raw, r.value.Interface())
+			if err != nil {
+				if err = query.decodeFailed(r.key, err); err != nil {
+					return nil, err
+				}
+				query.releaseRecord(r)
+				continue
+			}
+			decoded = append(decoded, r)
+		}
+		return decoded, nil
+	}
+
+	workers := s.decodeWorkers
+	if workers > len(records) {
+		workers = len(records)
+	}
+
+	errs := make([]error, len(records))
+	next := int64(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(records) {
+					return
+				}
+				errs[i] = decode(records[i].raw, records[i].value.Interface())
+			}
+		}()
+	}
+	wg.Wait()
+
+	decoded := records[:0]
+	for i := range records {
+		if errs[i] != nil {
+			if err := query.decodeFailed(records[i].key, errs[i]); err != nil {
+				return nil, err
+			}
+			query.releaseRecord(records[i])
+			continue
+		}
+		decoded = append(decoded, records[i])
+	}
+	return decoded, nil
+}
+
+// RecordError is the error for a single record that could not be read
+type RecordError struct {
+	Key []byte // the encoded key of the record
+	Err error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("The record with the key %x could not be read: %s", e.Key, e.Err)
+}
+
+// decodeFailed returns the error for a record that couldn't be decoded, or collects it and returns nil if the query
+// continues past records that can't be decoded
+func (q *Query) decodeFailed(key []byte, err error) error {
+	if q.decodeErrors == nil {
+		return err
+	}
+
+	for _, existing := range *q.decodeErrors {
+		if bytes.Equal(existing.(*RecordError).Key, key) {
+			// already reported by another part of the query
+			return nil
+		}
+	}
+
+	*q.decodeErrors = append(*q.decodeErrors, &RecordError{Key: key, Err: err})
+	return nil
+}
+
+func getSkipAndLimitRange(query *Query, recordsLen int) (startIndex, endIndex int) {
+	recordsLen -= query.dropLast
+	if recordsLen < 0 {
+		recordsLen = 0
+	}
+
+	if query.skip > recordsLen {
+		return 0, 0
+	}
+	startIndex = query.skip
+	endIndex = recordsLen
+	limitIndex := query.limit + startIndex
+
+	if query.limit > 0 && limitIndex <= recordsLen {
+		endIndex = limitIndex
+	}
+	return startIndex, endIndex
+}
+
+func sortFunction(query *Query, first, second reflect.Value) bool {
+	for _, field := range query.sort {
+		val, err := fieldValue(reflect.Indirect(first), field)
+		if err != nil {
+			panic(err.Error()) // shouldn't happen due to field check above
+		}
+		value := val.Interface()
+
+		val, err = fieldValue(reflect.Indirect(second), field)
+		if err != nil {
+			panic(err.Error()) // shouldn't happen due to field check above
+		}
+
+		other := val.Interface()
+
+		if query.reverse {
+			value, other = other, value
+		}
+
+		if query.collator != nil {
+			if valueS, ok := value.(string); ok {
+				if otherS, ok := other.(string); ok {
+					cmp := query.collator(valueS, otherS)
+					if cmp < 0 {
+						return true
+					} else if cmp == 0 {
+						continue
+					}
+					return false
+				}
+			}
+		}
+
+		cmp := sortCompare(value, other)
+		if cmp < 0 {
+			return true
+		} else if cmp == 0 {
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+// sortCompare compares two values of a sort field
+func sortCompare(value, other interface{}) int {
+	cmp, err := compare(value, other)
+	if err != nil {
+		// if for some reason there is an error on compare, fallback to a lexicographic compare
+		return strings.Compare(fmt.Sprintf("%s", value), fmt.Sprintf("%s", other))
+	}
+	return cmp
+}
+
+func validateSortFields(query *Query) error {
+	return validateFields(query, query.sort)
+}
+
+// validateFields returns an error if any of the fields don't exist in the type of the query
+func validateFields(query *Query, fields []string) error {
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+
+		current := query.dataType
+		for i := range path {
+			var structField reflect.StructField
+			found := false
+			if current.Kind() == reflect.Ptr {
+				structField, found = current.Elem().FieldByName(path[i])
+			} else {
+				structField, found = current.FieldByName(path[i])
+			}
+
+			if !found {
+				return fmt.Errorf("The field %s does not exist in the type %s", field, query.dataType)
+			}
+			current = structField.Type
+		}
+	}
+	return nil
+}
+
+// distinctFilter returns a function reporting whether a record is the first with its values of the query's
+// DistinctBy fields, or nil if the query has none
+func (s *Store) distinctFilter(query *Query) func(value reflect.Value) (bool, error) {
+	if len(query.distinct) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	return func(value reflect.Value) (bool, error) {
+		var tuple []byte
+		for _, field := range query.distinct {
+			fVal, err := fieldValue(reflect.Indirect(value), field)
+			if err != nil {
+				return false, err
+			}
+			encoded, err := s.encode(fVal.Interface())
+			if err != nil {
+				return false, err
+			}
+			// prefixed with their length so the values can't run together
+			tuple = append(strconv.AppendInt(tuple, int64(len(encoded)), 10), ':')
+			tuple = append(tuple, encoded...)
+		}
+
+		if _, ok := seen[string(tuple)]; ok {
+			return false, nil
+		}
+		seen[string(tuple)] = struct{}{}
+		return true, nil
+	}
+}
+
+func (s *Store) findQuery(tx *badger.Txn, result interface{}, query *Query) error {
+	if query == nil {
+		query = &Query{}
+	}
+
+	query.writable = false
+
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+
+	sliceVal := resultVal.Elem()
+
+	elType := sliceVal.Type().Elem()
+
+	tp := elType
+
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+
+	keyField, hasKeyField := getKeyField(tp)
+
+	val := reflect.New(tp)
+
+	query, err := s.planIndex(tx, s.newStorer(val.Interface()), query)
+	if err != nil {
+		return err
+	}
+
+	if isFindByIndexQuery(query) {
+		return s.findByIndexQuery(tx, resultVal, query)
+	}
+
+	maxResults := s.maxResults(query)
+	query.maxMatches = maxResults
+	defer func() {
+		query.maxMatches = 0
+	}()
+	found := 0
+
+	err = s.runQuery(tx, val.Interface(), query, nil, query.skip,
+		func(r *record) error {
+			// the result slice may already hold records, which don't count towards the maximum
+			if maxResults > 0 && found >= maxResults {
+				return ErrResultTooLarge
+			}
+			found++
+
+			var rowValue reflect.Value
+
+			if elType.Kind() == reflect.Ptr {
+				rowValue = r.value
+			} else {
+				rowValue = r.value.Elem()
+			}
+
+			if hasKeyField {
+				rowKey := rowValue
+				for rowKey.Kind() == reflect.Ptr {
+					rowKey = rowKey.Elem()
+				}
+				err := s.decodeKey(r.key, rowKey.FieldByName(keyField.Name).Addr().Interface(),
+					s.namespaced(tp.Name()))
+				if err != nil {
+					return err
+				}
+			}
+
+			sliceVal = reflect.Append(sliceVal, rowValue)
+
+			return nil
+		})
+
+	if err != nil {
+		return err
+	}
+
+	resultVal.Elem().Set(sliceVal.Slice(0, sliceVal.Len()))
+
+	return nil
+}
+
+// maxResults returns the most records a Find with the query can return, 0 means no limit
+func (s *Store) maxResults(query *Query) int {
+	if query.maxResults > 0 {
+		return query.maxResults
+	}
+	return s.maxFindResults
+}
+
+// exceedsMax returns whether a Find with the query returns more than max records once this many records have
+// matched, before the query's skip and limit are applied, so it can fail without reading the rest of the records
+func (q *Query) exceedsMax(max, matched int) bool {
+	if max <= 0 || (q.limit != 0 && q.limit <= max) {
+		return false
+	}
+	return matched-q.skip-q.dropLast > max
+}
+
+func (s *Store) findExceptQuery(tx *badger.Txn, result interface{}, include, exclude *Query) error {
+	if include == nil {
+		include = &Query{}
+	}
+	if exclude == nil {
+		return s.findQuery(tx, result, include)
+	}
+
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+
+	include.except = matchOnlyQuery(exclude, dereference(resultVal.Elem().Type().Elem()))
+	defer func() {
+		include.except = nil
+	}()
+
+	return s.findQuery(tx, result, include)
+}
+
+// matchOnlyQuery returns a copy of the query for testing records against with matches, rather than running it
+func matchOnlyQuery(query *Query, dataType reflect.Type) *Query {
+	match := *query
+	// an index only affects how records are read, all criteria need to be tested, including those on the Key
+	// which are otherwise tested by the iterator
+	match.index = ""
+	match.badIndex = true
+	match.dataType = dataType
+	match.ors = make([]*Query, len(query.ors))
+	for i := range query.ors {
+		match.ors[i] = matchOnlyQuery(query.ors[i], dataType)
+	}
+	return &match
+}
+
+func (s *Store) findAllButLastQuery(tx *badger.Txn, result interface{}, n int, query *Query) error {
+	if n < 0 {
+		panic("The number of records to leave out must be a positive number")
+	}
+
+	if query == nil {
+		query = &Query{}
+	}
+
+	query.dropLast = n
+	defer func() {
+		query.dropLast = 0
+	}()
+
+	return s.findQuery(tx, result, query)
+}
+
+func (s *Store) findTolerantQuery(tx *badger.Txn, result interface{}, query *Query) ([]error, error) {
+	if query == nil {
+		query = &Query{}
+	}
+
+	var badErrors []error
+	query.decodeErrors = &badErrors
+	defer func() {
+		query.decodeErrors = nil
+	}()
+
+	err := s.findQuery(tx, result, query)
+	if err != nil {
+		return badErrors, err
+	}
+
+	return badErrors, nil
+}
+
+func (s *Store) findMappedQuery(tx *badger.Txn, dataType interface{}, query *Query,
+	mapFn func(record interface{}) (interface{}, error), result interface{}) error {
+	if query == nil {
+		query = &Query{}
+	}
+
+	query.writable = false
+
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		panic("result argument must be a slice address")
+	}
+
+	sliceVal := resultVal.Elem()
+	elType := sliceVal.Type().Elem()
+
+	tp := dereference(reflect.TypeOf(dataType))
+	keyField, hasKeyField := getKeyField(tp)
+
+	val := reflect.New(tp)
+	typeName := s.newStorer(val.Interface()).Type()
+
+	return s.runQuery(tx, val.Interface(), query, nil, query.skip,
+		func(r *record) error {
+			if hasKeyField {
+				err := s.setKeyField(r.key, r.value, keyField, typeName)
+				if err != nil {
+					return err
+				}
+			}
+
+			mapped, err := mapFn(r.value.Interface())
+			if err != nil {
+				return err
+			}
+
+			mappedVal := reflect.ValueOf(mapped)
+			if mapped == nil {
+				mappedVal = reflect.Zero(elType)
+			} else if !mappedVal.Type().AssignableTo(elType) {
+				return fmt.Errorf("The mapped value of type %s can't be added to a slice of %s", mappedVal.Type(),
+					elType)
+			}
+
+			sliceVal.Set(reflect.Append(sliceVal, mappedVal))
+			return nil
+		})
+}
+
+func (s *Store) findMapQuery(tx *badger.Txn, result interface{}, query *Query) error {
+	if query == nil {
+		query = &Query{}
+	}
+
+	query.writable = false
+
+	resultVal := reflect.ValueOf(result)
+	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Map {
+		panic("result argument must be a map address")
+	}
+
+	mapVal := resultVal.Elem()
+	if mapVal.IsNil() {
+		mapVal.Set(reflect.MakeMap(mapVal.Type()))
+	}
+
+	keyType := mapVal.Type().Key()
+	elType := mapVal.Type().Elem()
+	tp := dereference(elType)
+
+	keyField, hasKeyField := getKeyField(tp)
+
+	val := reflect.New(tp)
+	typeName := s.newStorer(val.Interface()).Type()
+
+	return s.runQuery(tx, val.Interface(), query, nil, query.skip,
+		func(r *record) error {
+			key := reflect.New(keyType)
+			err := s.decodeKey(r.key, key.Interface(), typeName)
+			if err != nil {
+				return err
+			}
+
+			if hasKeyField {
+				err = s.setKeyField(r.key, r.value, keyField, typeName)
+				if err != nil {
+					return err
+				}
+			}
+
+			rowValue := r.value
+			if elType.Kind() != reflect.Ptr {
+				rowValue = r.value.Elem()
+			}
+
+			mapVal.SetMapIndex(key.Elem(), rowValue)
+
+			return nil
+		})
+}
+
+func isFindByIndexQuery(query *Query) bool {
+	if query.skipDecode || query.except != nil || query.noIndex || query.dropLast > 0 || query.index == "" || len(query.fieldCriteria) == 0 || len(query.fieldCriteria[query.index]) != 1 || len(query.ors) > 0 ||
+		len(query.fields) > 0 || len(query.distinct) > 0 || query.sizeGt > 0 {
+		return false
+	}
+
+	if needsRecord(query.fieldCriteria[query.index]) {
+		return false
+	}
+
+	operator := query.fieldCriteria[query.index][0].operator
+	return operator == eq || operator == in
+}
+
+func (s *Store) findKeysQuery(tx *badger.Txn, dataType interface{}, query *Query) ([]interface{}, error) {
+	if query == nil {
+		query = &Query{}
+	}
 
-	startIndex, endIndex := getSkipAndLimitRange(query, len(records))
-	records = records[startIndex:endIndex]
+	query.writable = false
+	query.skipDecode = true
+	defer func() {
+		query.skipDecode = false
+	}()
 
-	for i := range records {
-		err = action(records[i])
-		if err != nil {
-			return err
-		}
+	decodeKey, err := s.keyDecoder(dataType)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	var result []interface{}
 
-func getSkipAndLimitRange(query *Query, recordsLen int) (startIndex, endIndex int) {
-	if query.skip > recordsLen {
-		return 0, 0
+	err = s.runQuery(tx, dataType, query, nil, query.skip,
+		func(r *record) error {
+			key, err := decodeKey(r.key)
+			if err != nil {
+				return err
+			}
+
+			result = append(result, key)
+			return nil
+		})
+
+	if err != nil {
+		return nil, err
 	}
-	startIndex = query.skip
-	endIndex = recordsLen
-	limitIndex := query.limit + startIndex
 
-	if query.limit > 0 && limitIndex <= recordsLen {
-		endIndex = limitIndex
+	return result, nil
+}
+
+func (s *Store) findLazyQuery(tx *badger.Txn, dataType interface{}, query *Query, fn func(*LazyRecord) error) error {
+	if query == nil {
+		query = &Query{}
 	}
-	return startIndex, endIndex
+
+	query.writable = false
+	query.skipDecode = true
+	defer func() {
+		query.skipDecode = false
+	}()
+
+	typeName := s.newStorer(dataType).Type()
+
+	return s.runQuery(tx, dataType, query, nil, query.skip,
+		func(r *record) error {
+			return fn(&LazyRecord{
+				store:    s,
+				typeName: typeName,
+				key:      r.key,
+				value:    r.raw,
+			})
+		})
 }
 
-func sortFunction(query *Query, first, second reflect.Value) bool {
-	for _, field := range query.sort {
-		val, err := fieldValue(reflect.Indirect(first), field)
-		if err != nil {
-			panic(err.Error()) // shouldn't happen due to field check above
-		}
-		value := val.Interface()
+// keyDecoder returns a function for decoding record keys of the passed in dataType into the type of its key field
+func (s *Store) keyDecoder(dataType interface{}) (func(key []byte) (interface{}, error), error) {
+	tp := dereference(reflect.TypeOf(dataType))
+	keyField, hasKeyField := getKeyField(tp)
+	if !hasKeyField {
+		return nil, fmt.Errorf("The type %s does not have a key field to decode keys into", tp)
+	}
 
-		val, err = fieldValue(reflect.Indirect(second), field)
+	typeName := s.newStorer(dataType).Type()
+
+	return func(key []byte) (interface{}, error) {
+		value := reflect.New(keyField.Type)
+		err := s.decodeKey(key, value.Interface(), typeName)
 		if err != nil {
-			panic(err.Error()) // shouldn't happen due to field check above
+			return nil, err
 		}
+		return value.Elem().Interface(), nil
+	}, nil
+}
 
-		other := val.Interface()
+// orIndexUnion returns the query as a single query on an index, if it and all of its or'd queries only test the same
+// indexed field for equality, so the index entries of each value are read rather than each or'd query scanning for
+// its records.  The values are read in the order of the queries, as the records of each or'd query are returned
+// after those of the queries before it.  i.e. Where("A").Eq(1).Or(Where("A").Eq(2)) reads the index entries of 1,
+// then those of 2
+func (q *Query) orIndexUnion(storer Storer) (*Query, bool) {
+	// skips and limits are carried across or'd queries differently than across a single query, so those are left
+	// to run as they are
+	if len(q.ors) == 0 || q.noIndex || q.reverse || q.skip != 0 || q.limit != 0 || q.writable || q.subquery ||
+		q.bookmark != nil || q.streamRead {
+		return nil, false
+	}
+	field, value, ok := q.singleEq()
+	if !ok || (q.index != "" && q.index != field) {
+		return nil, false
+	}
+	index, ok := storer.Indexes()[field]
+	if !ok || index.partial() || index.Bucket > 0 {
+		return nil, false
+	}
 
-		if query.reverse {
-			value, other = other, value
+	values := []interface{}{value}
+	for _, or := range q.ors {
+		if len(or.ors) > 0 || or.noIndex || (or.index != "" && or.index != field) || or.skip != 0 || or.limit != 0 ||
+			len(or.sort) > 0 || or.reverse {
+			return nil, false
+		}
+		orField, orValue, ok := or.singleEq()
+		if !ok || orField != field {
+			return nil, false
 		}
+		values = append(values, orValue)
+	}
 
-		cmp, cerr := compare(value, other)
-		if cerr != nil {
-			// if for some reason there is an error on compare, fallback to a lexicographic compare
-			valS := fmt.Sprintf("%s", value)
-			otherS := fmt.Sprintf("%s", other)
-			if valS < otherS {
-				return true
-			} else if valS == otherS {
-				continue
+	next := 0
+	union := *q
+	union.ors = nil
+	union.index = field
+	union.autoIndex = false
+	union.fieldCriteria = map[string][]*Criterion{
+		field: {{query: &union, operator: ins, stream: func() (interface{}, bool) {
+			if next == len(values) {
+				return nil, false
 			}
+			next++
+			return values[next-1], true
+		}}},
+	}
+	return &union, true
+}
+
+// singleEq returns the field and value of the query's only criterion, if it's an equality test on a field
+func (q *Query) singleEq() (string, interface{}, bool) {
+	if len(q.fieldCriteria) != 1 {
+		return "", nil, false
+	}
+	for field, criteria := range q.fieldCriteria {
+		if field == Key || len(criteria) != 1 || criteria[0].operator != eq || needsRecord(criteria) {
+			return "", nil, false
+		}
+		return field, criteria[0].value, true
+	}
+	return "", nil, false
+}
+
+// coveredByIndex returns whether the index the query uses holds every field the query tests and returns, so the
+// records can be built from the index entries rather than read
+func (q *Query) coveredByIndex(storer Storer) bool {
+	if len(q.fields) == 0 || q.index == "" || q.writable || q.except != nil || len(q.sort) > 0 || len(q.ors) > 0 ||
+		len(q.distinct) > 0 || q.sizeGt > 0 {
+		return false
+	}
+	if _, ok := storer.(*anonStorer); !ok {
+		// the values of custom indexes can be anything
+		return false
+	}
+	index, ok := storer.Indexes()[q.index]
+	if !ok || index.Bucket > 0 || len(q.fieldCriteria[q.index]) == 0 {
+		return false
+	}
+	if _, ok := q.dataType.FieldByName(q.index); !ok {
+		// computed fields have no field to put the index value in
+		return false
+	}
+
+	for field, criteria := range q.fieldCriteria {
+		if (field != q.index && field != Key) || needsRecord(criteria) || streamCriterion(criteria) != nil {
 			return false
 		}
+	}
 
-		if cmp == -1 {
-			return true
-		} else if cmp == 0 {
-			continue
+	keyField, hasKeyField := getKeyField(q.dataType)
+	for _, field := range q.fields {
+		if field != q.index && field != Key && (!hasKeyField || field != keyField.Name) {
+			return false
 		}
-		return false
 	}
-	return false
+	return true
 }
 
-func validateSortFields(query *Query) error {
-	for _, field := range query.sort {
-		fields := strings.Split(field, ".")
+// needsValue returns whether the record value needs to be decoded to test this query, or whether the key
+// alone is enough
+func (q *Query) needsValue() bool {
+	if len(q.sort) > 0 || len(q.distinct) > 0 || q.except != nil {
+		return true
+	}
 
-		current := query.dataType
-		for i := range fields {
-			var structField reflect.StructField
-			found := false
-			if current.Kind() == reflect.Ptr {
-				structField, found = current.Elem().FieldByName(fields[i])
-			} else {
-				structField, found = current.FieldByName(fields[i])
-			}
+	for field, criteria := range q.fieldCriteria {
+		if field == q.index && !q.badIndex && !q.recheckIndex && !needsRecord(criteria) {
+			// already handled by index Iterator
+			continue
+		}
 
-			if !found {
-				return fmt.Errorf("The field %s does not exist in the type %s", field, query.dataType)
+		if field != Key {
+			return true
+		}
+
+		for i := range criteria {
+			if _, ok := criteria[i].value.(Field); ok {
+				return true
 			}
-			current = structField.Type
 		}
 	}
-	return nil
+
+	return false
 }
 
-func (s *Store) findQuery(tx *badger.Txn, result interface{}, query *Query) error {
+// deleteQuery deletes the records matching the query and returns them
+func (s *Store) deleteQuery(tx *badger.Txn, dataType interface{}, query *Query) ([]*record, error) {
 	if query == nil {
 		query = &Query{}
 	}
+	query.writable = true
 
-	query.writable = false
+	var records []*record
+	storer := s.newStorer(dataType)
 
-	resultVal := reflect.ValueOf(result)
-	if resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
-		panic("result argument must be a slice address")
+	query, err := s.planIndex(tx, storer, query)
+	if err != nil {
+		return nil, err
 	}
 
-	if isFindByIndexQuery(query) {
-		return s.findByIndexQuery(tx, resultVal, query)
+	if isDeleteByIndexQuery(storer, query) {
+		records, err = s.deleteByIndexRecords(tx, storer, dataType, query)
+	} else {
+		err = s.runQuery(tx, dataType, query, nil, query.skip,
+			func(r *record) error {
+				records = append(records, r)
+
+				return nil
+			})
 	}
 
-	sliceVal := resultVal.Elem()
+	if err != nil {
+		return nil, err
+	}
 
-	elType := sliceVal.Type().Elem()
+	for i := range records {
+		err := s.deleteRecord(storer, tx, records[i])
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	tp := elType
+	return records, nil
+}
 
-	for tp.Kind() == reflect.Ptr {
-		tp = tp.Elem()
+// isDeleteByIndexQuery returns whether the records a delete query matches can be read straight from the keys in the
+// index, rather than scanning for them, as the query is only an equality on an index that holds exactly the values
+func isDeleteByIndexQuery(storer Storer, query *Query) bool {
+	if !isFindByIndexQuery(query) || len(query.fieldCriteria) != 1 || query.skip != 0 || query.limit != 0 {
+		return false
 	}
 
-	keyField, hasKeyField := getKeyField(tp)
+	index, ok := storer.Indexes()[query.index]
+	return ok && index.Bucket == 0
+}
 
-	val := reflect.New(tp)
+// deleteByIndexRecords returns the records to delete for a query that meets isDeleteByIndexQuery
+func (s *Store) deleteByIndexRecords(tx *badger.Txn, storer Storer, dataType interface{}, query *Query) ([]*record,
+	error) {
+	query, err := query.resolve(s, tx)
+	if err != nil {
+		return nil, err
+	}
+	query.dataType = dereference(reflect.TypeOf(dataType))
+	err = query.validateIndex(dataType, storer)
+	if err != nil {
+		return nil, err
+	}
 
-	err := s.runQuery(tx, val.Interface(), query, nil, query.skip,
-		func(r *record) error {
-			var rowValue reflect.Value
+	criteria := query.fieldCriteria[query.index][0]
+	values := criteria.values
+	if criteria.operator != in {
+		values = []interface{}{criteria.value}
+	}
 
-			if elType.Kind() == reflect.Ptr {
-				rowValue = r.value
-			} else {
-				rowValue = r.value.Elem()
-			}
+	keyList, err := s.fetchIndexValues(tx, storer, query.index, values...)
+	if err != nil {
+		return nil, err
+	}
 
-			if hasKeyField {
-				rowKey := rowValue
-				for rowKey.Kind() == reflect.Ptr {
-					rowKey = rowKey.Elem()
-				}
-				err := s.decodeKey(r.key, rowKey.FieldByName(keyField.Name).Addr().Interface(), tp.Name())
-				if err != nil {
-					return err
-				}
+	records := make([]*record, 0, len(keyList))
+	found := make(map[string]bool, len(keyList))
+	for _, key := range keyList {
+		if found[string(key)] {
+			// the same value can be in the criteria more than once
+			continue
+		}
+		found[string(key)] = true
+
+		item, err := tx.Get(key)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := reflect.New(query.dataType)
+		err = item.Value(func(val []byte) error {
+			return s.decodeRecord(val, value.Interface())
+		})
+		if err != nil {
+			if err = query.decodeFailed(key, err); err != nil {
+				return nil, err
 			}
+			continue
+		}
 
-			sliceVal = reflect.Append(sliceVal, rowValue)
+		records = append(records, &record{key: key, value: value})
+	}
+
+	return records, nil
+}
+
+func (s *Store) deleteRecord(storer Storer, tx *badger.Txn, r *record) error {
+	err := tx.Delete(r.key)
+	if err != nil {
+		return err
+	}
+
+	// remove any indexes
+	err = s.indexDelete(storer, tx, r.key, r.value.Interface())
+	if err != nil {
+		return err
+	}
+
+	err = s.insertOrderDelete(storer, tx, r.key)
+	if err != nil {
+		return err
+	}
+
+	return s.deleteCascades(tx, storer, r.value.Type(), r.key)
+}
+
+func (s *Store) updateQuery(tx *badger.Txn, dataType interface{}, query *Query, update func(record interface{}) error) error {
+	if query == nil {
+		query = &Query{}
+	}
+
+	query.writable = true
+	var records []*record
+
+	err := s.runQuery(tx, dataType, query, nil, query.skip,
+		func(r *record) error {
+			records = append(records, r)
 
 			return nil
+
 		})
 
 	if err != nil {
 		return err
 	}
 
-	resultVal.Elem().Set(sliceVal.Slice(0, sliceVal.Len()))
+	storer := s.newStorer(dataType)
+	for i := range records {
+		err := s.updateRecord(storer, tx, records[i], update)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func isFindByIndexQuery(query *Query) bool {
-	if query.index == "" || len(query.fieldCriteria) == 0 || len(query.fieldCriteria[query.index]) != 1 || len(query.ors) > 0 {
-		return false
+func (s *Store) updateRecord(storer Storer, tx *badger.Txn, r *record, update func(record interface{}) error) error {
+	upVal := r.value.Interface()
+
+	// delete any existing indexes bad on original value
+	err := s.indexDelete(storer, tx, r.key, upVal)
+	if err != nil {
+		return err
 	}
 
-	operator := query.fieldCriteria[query.index][0].operator
-	return operator == eq || operator == in
+	err = update(upVal)
+	if err != nil {
+		return err
+	}
+
+	encVal, err := s.encode(upVal)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Set(r.key, encVal)
+	if err != nil {
+		return err
+	}
+
+	// insert any new indexes
+	return s.indexAdd(storer, tx, r.key, upVal)
 }
 
-func (s *Store) deleteQuery(tx *badger.Txn, dataType interface{}, query *Query) error {
+func (s *Store) forEachUpdateQuery(tx *badger.Txn, dataType interface{}, query *Query,
+	fn func(record interface{}) (bool, error)) error {
 	if query == nil {
 		query = &Query{}
 	}
+
 	query.writable = true
+	storer := s.newStorer(dataType)
 
-	var records []*record
+	return s.runQuery(tx, dataType, query, nil, query.skip, func(r *record) error {
+		return s.updateChangedRecord(storer, tx, r, fn)
+	})
+}
 
-	err := s.runQuery(tx, dataType, query, nil, query.skip,
-		func(r *record) error {
-			records = append(records, r)
+// updateChangedRecord runs fn against the record, and writes it back if fn changed it
+func (s *Store) updateChangedRecord(storer Storer, tx *badger.Txn, r *record,
+	fn func(record interface{}) (bool, error)) error {
+	if keyField, ok := getKeyField(r.value.Elem().Type()); ok {
+		err := s.setKeyField(r.key, r.value, keyField, storer.Type())
+		if err != nil {
+			return err
+		}
+	}
 
-			return nil
-		})
+	changed, err := fn(r.value.Interface())
+	if err != nil || !changed {
+		return err
+	}
 
+	// fn changed the record in place, so the indexes of the stored record are removed using a fresh copy
+	item, err := tx.Get(r.key)
+	if err != nil {
+		return err
+	}
+	original := reflect.New(r.value.Elem().Type())
+	err = item.Value(func(val []byte) error {
+		return s.decode(val, original.Interface())
+	})
 	if err != nil {
 		return err
 	}
 
-	storer := s.newStorer(dataType)
+	err = s.indexDelete(storer, tx, r.key, original.Interface())
+	if err != nil {
+		return err
+	}
 
-	for i := range records {
-		err := tx.Delete(records[i].key)
-		if err != nil {
-			return err
-		}
+	encVal, err := s.encode(r.value.Interface())
+	if err != nil {
+		return err
+	}
 
-		// remove any indexes
-		err = s.indexDelete(storer, tx, records[i].key, records[i].value.Interface())
-		if err != nil {
-			return err
-		}
+	err = tx.Set(r.key, encVal)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return s.indexAdd(storer, tx, r.key, r.value.Interface())
 }
 
-func (s *Store) updateQuery(tx *badger.Txn, dataType interface{}, query *Query, update func(record interface{}) error) error {
+// batchQuery runs the action against the records matching the query, committing the changes every
+// Options.BatchSize records, or sooner if the transaction grows too big for badger.  Each batch reads the records of
+// the type in key order, resuming after the last key of the previous batch, and matches them against the query in
+// its own transaction, so records changed by other transactions between batches are matched as they are when
+// they're changed
+func (s *Store) batchQuery(dataType interface{}, query *Query, action func(tx *badger.Txn, r *record) error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
 	if query == nil {
 		query = &Query{}
 	}
 
-	query.writable = true
-	var records []*record
+	if len(query.sort) > 0 || query.dropLast > 0 || len(query.distinct) > 0 || query.reverse {
+		return fmt.Errorf("SortBy, Reverse, DistinctBy and AllButLast can't be used when changes are committed " +
+			"in batches")
+	}
+	for _, criteria := range query.fieldCriteria {
+		if streamCriterion(criteria) != nil {
+			return fmt.Errorf("InStream can't be used when changes are committed in batches")
+		}
+	}
 
-	err := s.runQuery(tx, dataType, query, nil, query.skip,
-		func(r *record) error {
-			records = append(records, r)
+	storer := s.newStorer(dataType)
+	tp := dereference(reflect.TypeOf(dataType))
+	prefix := typePrefix(storer.Type())
 
-			return nil
+	skip, limit := query.skip, query.limit
+	size := s.batchSize
+	var last []byte
 
-		})
+	for {
+		var batchLast []byte
+		batchSkip, batchLimit := skip, limit
+		done := true
+		processed := 0
 
-	if err != nil {
-		return err
-	}
+		err := s.update(func(tx *badger.Txn) error {
+			run, err := query.resolve(s, tx)
+			if err != nil {
+				return err
+			}
+			// the records aren't read through an index, so all of the criteria are tested against them
+			run.bind(tx, tp, true)
+			defer run.bind(nil, tp, false)
 
-	storer := s.newStorer(dataType)
-	for i := range records {
-		upVal := records[i].value.Interface()
+			iter := tx.NewIterator(badger.DefaultIteratorOptions)
+			defer iter.Close()
 
-		// delete any existing indexes bad on original value
-		err := s.indexDelete(storer, tx, records[i].key, upVal)
-		if err != nil {
-			return err
-		}
+			seek := prefix
+			if last != nil {
+				// the smallest key after the last one read
+				seek = append(append([]byte{}, last...), 0)
+			}
 
-		err = update(upVal)
-		if err != nil {
-			return err
-		}
+			for iter.Seek(seek); iter.ValidForPrefix(prefix); iter.Next() {
+				if processed == size {
+					done = false
+					return nil
+				}
 
-		encVal, err := s.encode(upVal)
-		if err != nil {
-			return err
-		}
+				item := iter.Item()
+				key := item.KeyCopy(nil)
+
+				value := reflect.New(tp)
+				err := item.Value(func(v []byte) error {
+					if run.sizeGt > 0 && len(v) <= run.sizeGt {
+						value = reflect.Value{}
+						return nil
+					}
+					return s.decode(v, value.Interface())
+				})
+				if err != nil {
+					return err
+				}
+				batchLast = key
+				if !value.IsValid() {
+					continue
+				}
+
+				ok, err := run.matches(s, key, value, value.Interface())
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+
+				if batchSkip > 0 {
+					batchSkip--
+					continue
+				}
+
+				err = action(tx, &record{key: key, value: value})
+				if err != nil {
+					return err
+				}
+				processed++
 
-		err = tx.Set(records[i].key, encVal)
+				if batchLimit != 0 {
+					batchLimit--
+					if batchLimit == 0 {
+						return nil
+					}
+				}
+			}
+			return nil
+		})
+		if err == badger.ErrConflict {
+			// nothing from this batch was committed, so it's read and matched again
+			continue
+		}
+		if errors.Is(err, badger.ErrTxnTooBig) && processed > 0 {
+			// the changes to the record that didn't fit are incomplete, so the batch is run again without it
+			size = processed
+			continue
+		}
 		if err != nil {
 			return err
 		}
 
-		// insert any new indexes
-		err = s.indexAdd(storer, tx, records[i].key, upVal)
-		if err != nil {
-			return err
+		if done {
+			return nil
 		}
+		last = batchLast
+		skip, limit = batchSkip, batchLimit
 	}
-
-	return nil
 }
 
 func (s *Store) aggregateQuery(tx *badger.Txn, dataType interface{}, query *Query, groupBy ...string) ([]*AggregateResult, error) {
@@ -1153,6 +3574,7 @@ func (s *Store) aggregateQuery(tx *badger.Txn, dataType interface{}, query *Quer
 		func(r *record) error {
 			if len(groupBy) == 0 {
 				result[0].reduction = append(result[0].reduction, r.value)
+				result[0].keys = append(result[0].keys, r.key)
 				return nil
 			}
 
@@ -1195,6 +3617,7 @@ func (s *Store) aggregateQuery(tx *badger.Txn, dataType interface{}, query *Quer
 				if allEqual {
 					// group already exists, append results to reduction
 					result[i].reduction = append(result[i].reduction, r.value)
+					result[i].keys = append(result[i].keys, r.key)
 					return nil
 				}
 			}
@@ -1205,6 +3628,7 @@ func (s *Store) aggregateQuery(tx *badger.Txn, dataType interface{}, query *Quer
 			result[i] = &AggregateResult{
 				group:     grouping,
 				reduction: []reflect.Value{r.value},
+				keys:      [][]byte{r.key},
 			}
 
 			return nil
@@ -1214,6 +3638,16 @@ func (s *Store) aggregateQuery(tx *badger.Txn, dataType interface{}, query *Quer
 		return nil, err
 	}
 
+	if query.having != nil {
+		filtered := result[:0]
+		for i := range result {
+			if query.having(result[i]) {
+				filtered = append(filtered, result[i])
+			}
+		}
+		result = filtered
+	}
+
 	return result, nil
 }
 
@@ -1261,7 +3695,8 @@ func (s *Store) findOneQuery(tx *badger.Txn, result interface{}, query *Query) e
 				for rowKey.Kind() == reflect.Ptr {
 					rowKey = rowKey.Elem()
 				}
-				err := s.decodeKey(r.key, rowKey.FieldByName(keyField.Name).Addr().Interface(), tp.Name())
+				err := s.decodeKey(r.key, rowKey.FieldByName(keyField.Name).Addr().Interface(),
+					s.namespaced(tp.Name()))
 				if err != nil {
 					return err
 				}
@@ -1324,6 +3759,74 @@ func (s *Store) forEach(tx *badger.Txn, query *Query, fn interface{}) error {
 	})
 }
 
+// recordPool supplies the values records are decoded into for ForEachPooled
+type recordPool struct {
+	get     func() interface{}
+	release func(record interface{})
+}
+
+// newRecordValue returns a pointer to an empty value of the query's data type, taken from the query's pool if it
+// has one
+func (q *Query) newRecordValue() reflect.Value {
+	if q.pool == nil {
+		return reflect.New(q.dataType)
+	}
+
+	value := reflect.ValueOf(q.pool.get())
+	// decoders leave fields that aren't in the encoded record untouched
+	value.Elem().Set(reflect.Zero(q.dataType))
+	return value
+}
+
+// releaseRecord returns a record that won't be passed to the query action to the query's pool
+func (q *Query) releaseRecord(r *record) {
+	if q.pool != nil {
+		q.pool.release(r.value.Interface())
+	}
+}
+
+func (s *Store) forEachPooled(tx *badger.Txn, query *Query, newRecord func() interface{},
+	release func(record interface{}), fn func(record interface{}) error) error {
+	if query == nil {
+		query = &Query{}
+	}
+
+	dataType := newRecord()
+	tp := reflect.TypeOf(dataType)
+	if tp == nil || tp.Kind() != reflect.Ptr || tp.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("The newRecord func must return a pointer to a struct, not %v", tp)
+	}
+	release(dataType)
+
+	keyField, hasKeyField := getKeyField(tp.Elem())
+	storer := s.newStorer(dataType)
+
+	query.pool = &recordPool{
+		get: func() interface{} {
+			record := newRecord()
+			if reflect.TypeOf(record) != tp {
+				panic(fmt.Sprintf("The newRecord func returned a %T rather than a %v", record, tp))
+			}
+			return record
+		},
+		release: release,
+	}
+	defer func() {
+		query.pool = nil
+	}()
+
+	return s.runQuery(tx, dataType, query, nil, query.skip, func(r *record) error {
+		if hasKeyField {
+			err := s.decodeKey(r.key, r.value.Elem().FieldByName(keyField.Name).Addr().Interface(), storer.Type())
+			if err != nil {
+				return err
+			}
+		}
+
+		return fn(r.value.Interface())
+	})
+}
+
 func (s *Store) countQuery(tx *badger.Txn, dataType interface{}, query *Query) (uint64, error) {
 	if query == nil {
 		query = &Query{}
@@ -1344,14 +3847,132 @@ func (s *Store) countQuery(tx *badger.Txn, dataType interface{}, query *Query) (
 	return count, nil
 }
 
+func (s *Store) countDistinctQuery(tx *badger.Txn, dataType interface{}, query *Query, field string) (uint64,
+	error) {
+	if query == nil {
+		query = &Query{}
+	}
+
+	if s.distinctFromIndex(dataType, query, field) {
+		return s.countIndexValues(tx, s.newStorer(dataType), field), nil
+	}
+
+	values := make(map[string]struct{})
+	err := s.runQuery(tx, dataType, query, nil, query.skip,
+		func(r *record) error {
+			value, err := fieldValue(r.value, field)
+			if err != nil {
+				return err
+			}
+
+			encoded, err := s.encode(value.Interface())
+			if err != nil {
+				return err
+			}
+			values[string(encoded)] = struct{}{}
+			return nil
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(values)), nil
+}
+
+// distinctFromIndex returns whether the distinct values of the field can be counted from its index instead of the
+// records.  Only indexes set with tags are used, as they hold one entry per record keyed by the field's value
+func (s *Store) distinctFromIndex(dataType interface{}, query *Query, field string) bool {
+	if _, ok := dataType.(Storer); ok {
+		return false
+	}
+	if !query.IsEmpty() || query.except != nil || query.skip != 0 || query.limit != 0 || query.dropLast != 0 ||
+		len(query.distinct) > 0 || query.sizeGt > 0 {
+		return false
+	}
+
+	index, ok := s.newStorer(dataType).Indexes()[field]
+	return ok && !index.partial() && index.Bucket == 0
+}
+
+// countApproxSampleSize is the number of records CountApprox counts exactly before estimating the rest
+const countApproxSampleSize = 10000
+
+func (s *Store) countApprox(tx *badger.Txn, dataType interface{}) (uint64, error) {
+	prefix := typePrefix(s.newStorer(dataType).Type())
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	iter := tx.NewIterator(opts)
+	defer iter.Close()
+
+	var count uint64
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		count++
+		if count == countApproxSampleSize {
+			break
+		}
+	}
+	if count < countApproxSampleSize {
+		return count, nil
+	}
+
+	if estimate := s.estimateKeys(prefix); estimate > count {
+		return estimate, nil
+	}
+	return count, nil
+}
+
+// estimateKeys estimates the number of keys with the prefix from the key counts of badger's tables.  Tables that
+// only partly hold keys with the prefix are counted as holding half of them
+func (s *Store) estimateKeys(prefix []byte) uint64 {
+	end := append(append([]byte(nil), prefix[:len(prefix)-1]...), prefix[len(prefix)-1]+1)
+
+	var estimate uint64
+	for _, table := range s.Badger().Tables() {
+		if bytes.Compare(table.Right, prefix) < 0 || bytes.Compare(table.Left, end) >= 0 {
+			continue
+		}
+		if bytes.HasPrefix(table.Left, prefix) && bytes.HasPrefix(table.Right, prefix) {
+			estimate += uint64(table.KeyCount)
+		} else {
+			estimate += uint64(table.KeyCount) / 2
+		}
+	}
+	return estimate
+}
+
+// countIndexValues returns the number of distinct values stored in the index
+func (s *Store) countIndexValues(tx *badger.Txn, storer Storer, indexName string) uint64 {
+	prefix := s.indexKeyPrefix(storer.Type(), indexName)
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	iter := tx.NewIterator(opts)
+	defer iter.Close()
+
+	var count uint64
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		count++
+	}
+
+	return count
+}
+
 func (s *Store) findByIndexQuery(tx *badger.Txn, resultSlice reflect.Value, query *Query) (err error) {
+	query, err = query.resolve(s, tx)
+	if err != nil {
+		return err
+	}
 	criteria := query.fieldCriteria[query.index][0]
 	sliceType := resultSlice.Elem().Type()
 	query.dataType = dereference(sliceType.Elem())
 
 	data := reflect.New(query.dataType).Interface()
 	storer := s.newStorer(data)
-	err = query.validateIndex(data)
+	query.recheckIndex = storer.Indexes()[query.index].Bucket > 0
+	err = query.validateIndex(data, storer)
 	if err != nil {
 		return err
 	}
@@ -1362,21 +3983,59 @@ func (s *Store) findByIndexQuery(tx *badger.Txn, resultSlice reflect.Value, quer
 
 	var keyList KeyList
 	if criteria.operator == in {
-		keyList, err = s.fetchIndexValues(tx, query, storer.Type(), criteria.values...)
+		keyList, err = s.fetchIndexValues(tx, storer, query.index, criteria.values...)
 	} else {
-		keyList, err = s.fetchIndexValues(tx, query, storer.Type(), criteria.value)
+		keyList, err = s.fetchIndexValues(tx, storer, query.index, criteria.value)
 	}
 	if err != nil {
 		return err
 	}
 
+	if len(query.sort) > 0 {
+		// records with equal sort values are ordered by their key, so the results are deterministic
+		sort.Slice(keyList, func(i, j int) bool {
+			return bytes.Compare(keyList[i], keyList[j]) < 0
+		})
+	} else if query.reverse {
+		reverseKeys(keyList)
+	}
+
 	keyField, hasKeyField := getKeyField(query.dataType)
+	maxResults := s.maxResults(query)
+
+	// without a sort, skip and limit can be applied while fetching the records rather than afterwards
+	skip := 0
+	limit := 0
+	if len(query.sort) == 0 {
+		skip = query.skip
+		limit = query.limit
+		if len(query.fieldCriteria) == 1 && !query.recheckIndex {
+			// the index criteria is the only criteria, and the index holds exactly its values, so skipped records
+			// don't need to be fetched
+			if skip > len(keyList) {
+				skip = len(keyList)
+			}
+			keyList = keyList[skip:]
+			skip = 0
+		}
+	}
 
 	slice := reflect.MakeSlice(sliceType, 0, len(keyList))
 	for i := range keyList {
+		if limit != 0 && slice.Len() == limit {
+			break
+		}
+
 		item, err := tx.Get(keyList[i])
 		if err == badger.ErrKeyNotFound {
-			panic("inconsistency between keys stored in index and in Badger directly")
+			if !s.skipMissingRefs {
+				panic("inconsistency between keys stored in index and in Badger directly")
+			}
+			if s.logger != nil {
+				s.logger.Warningf("badgerhold: skipping the missing record %q in the index %s of %s", keyList[i],
+					query.index, storer.Type())
+			}
+			continue
 		}
 		if err != nil {
 			return err
@@ -1384,10 +4043,13 @@ func (s *Store) findByIndexQuery(tx *badger.Txn, resultSlice reflect.Value, quer
 
 		newElement := reflect.New(query.dataType)
 		err = item.Value(func(val []byte) error {
-			return s.decode(val, newElement.Interface())
+			return s.decodeRecord(val, newElement.Interface())
 		})
 		if err != nil {
-			return err
+			if err = query.decodeFailed(keyList[i], err); err != nil {
+				return err
+			}
+			continue
 		}
 		if hasKeyField {
 			err = s.setKeyField(keyList[i], newElement, keyField, storer.Type())
@@ -1404,34 +4066,107 @@ func (s *Store) findByIndexQuery(tx *badger.Txn, resultSlice reflect.Value, quer
 			continue
 		}
 
+		if skip > 0 {
+			skip--
+			continue
+		}
+
 		if sliceType.Elem().Kind() != reflect.Ptr {
 			newElement = newElement.Elem()
 		}
+		if len(query.sort) == 0 && maxResults > 0 && slice.Len() >= maxResults {
+			return ErrResultTooLarge
+		}
+		if len(query.sort) > 0 && query.exceedsMax(maxResults, slice.Len()+1) {
+			return ErrResultTooLarge
+		}
 		slice = reflect.Append(slice, newElement)
 	}
 
 	if len(query.sort) > 0 {
-		sort.Slice(slice.Interface(), func(i, j int) bool {
+		sort.SliceStable(slice.Interface(), func(i, j int) bool {
 			return sortFunction(query, slice.Index(i), slice.Index(j))
 		})
-	}
 
-	startIndex, endIndex := getSkipAndLimitRange(query, slice.Len())
-	slice = slice.Slice(startIndex, endIndex)
+		startIndex, endIndex := getSkipAndLimitRange(query, slice.Len())
+		slice = slice.Slice(startIndex, endIndex)
+		if maxResults > 0 && slice.Len() > maxResults {
+			return ErrResultTooLarge
+		}
+	}
 
 	resultSlice.Elem().Set(slice)
 	return nil
 }
 
-func (s *Store) fetchIndexValues(tx *badger.Txn, query *Query, typeName string, indexKeys ...interface{}) (KeyList, error) {
-	keyList := KeyList{}
-	for i := range indexKeys {
-		indexKeyValue, err := s.encode(indexKeys[i])
+// indexEntryKeys returns the badger keys of the index entries of the values
+func (s *Store) indexEntryKeys(storer Storer, indexName string, values []interface{}) ([][]byte, error) {
+	index := storer.Indexes()[indexName]
+	var keys [][]byte
+	var fetched map[string]bool
+	if index.Bucket > 0 {
+		fetched = make(map[string]bool)
+	}
+	for i := range values {
+		value := values[i]
+		if index.Bucket > 0 {
+			value = bucketValue(value, index.Bucket)
+		}
+
+		indexKeyValue, err := s.encode(value)
 		if err != nil {
 			return nil, err
 		}
 
-		indexKey := newIndexKey(typeName, query.index, indexKeyValue)
+		if fetched != nil {
+			// several values can fall in the same bucket
+			if fetched[string(indexKeyValue)] {
+				continue
+			}
+			fetched[string(indexKeyValue)] = true
+		}
+
+		keys = append(keys, s.newIndexKey(storer.Type(), indexName, index.keyValue(indexKeyValue)))
+	}
+	return keys, nil
+}
+
+// indexEntriesSize returns the total size of the encoded key lists of the index entries of the values, which grows
+// with the number of records they hold, without reading the entries
+func (s *Store) indexEntriesSize(tx *badger.Txn, storer Storer, indexName string, values ...interface{}) (int64,
+	error) {
+	indexKeys, err := s.indexEntryKeys(storer, indexName, values)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, indexKey := range indexKeys {
+		item, err := tx.Get(indexKey)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += item.ValueSize()
+	}
+	return size, nil
+}
+
+func (s *Store) fetchIndexValues(tx *badger.Txn, storer Storer, indexName string, indexKeys ...interface{}) (KeyList,
+	error) {
+	entryKeys, err := s.indexEntryKeys(storer, indexName, indexKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	keyList := KeyList{}
+	for _, indexKey := range entryKeys {
+		if cached, ok := s.cachedIndexValue(storer.Type(), indexName, indexKey); ok {
+			keyList = append(keyList, cached...)
+			continue
+		}
 
 		item, err := tx.Get(indexKey)
 		if err == badger.ErrKeyNotFound {
@@ -0,0 +1,196 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"container/list"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// queryCache is a least recently used cache of the results of Find, set with the QueryCache option.  A nil
+// queryCache caches nothing
+type queryCache struct {
+	sync.Mutex
+	size    int
+	entries *list.List // of *queryCacheEntry, with the most recently used first
+	byKey   map[queryCacheKey]*list.Element
+	counts  map[string]int // the number of entries of each type
+
+	// generations count the writes to each type and to the store as a whole, so results read while a write was
+	// made aren't cached
+	typeGenerations map[string]uint64
+	generation      uint64
+	writing         int
+}
+
+type queryCacheKey struct {
+	resultType reflect.Type // the type of the result slice
+	typeName   string
+	query      string // the query encoded as JSON
+}
+
+type queryCacheEntry struct {
+	key     queryCacheKey
+	records reflect.Value
+}
+
+// queryCacheState is the state of the cache when a query started.  Its results are only cached if nothing has been
+// written since
+type queryCacheState struct {
+	typeGeneration uint64
+	generation     uint64
+}
+
+func newQueryCache(size int) *queryCache {
+	if size <= 0 {
+		return nil
+	}
+	return &queryCache{
+		size:            size,
+		entries:         list.New(),
+		byKey:           make(map[queryCacheKey]*list.Element),
+		counts:          make(map[string]int),
+		typeGenerations: make(map[string]uint64),
+	}
+}
+
+// get returns the cached records for the key
+func (c *queryCache) get(key queryCacheKey) (reflect.Value, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, ok := c.byKey[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	c.entries.MoveToFront(element)
+	return element.Value.(*queryCacheEntry).records, true
+}
+
+// state returns the current state of the cache for the type
+func (c *queryCache) state(typeName string) queryCacheState {
+	c.Lock()
+	defer c.Unlock()
+
+	return queryCacheState{
+		typeGeneration: c.typeGenerations[typeName],
+		generation:     c.generation,
+	}
+}
+
+// put caches the records for the key, unless the type has been written to since state was read, or a write is
+// still in progress
+func (c *queryCache) put(key queryCacheKey, state queryCacheState, records reflect.Value) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.writing > 0 || c.generation != state.generation || c.typeGenerations[key.typeName] != state.typeGeneration {
+		return
+	}
+
+	if element, ok := c.byKey[key]; ok {
+		element.Value.(*queryCacheEntry).records = records
+		c.entries.MoveToFront(element)
+		return
+	}
+
+	c.byKey[key] = c.entries.PushFront(&queryCacheEntry{key: key, records: records})
+	c.counts[key.typeName]++
+	if c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+	}
+}
+
+func (c *queryCache) remove(element *list.Element) {
+	key := element.Value.(*queryCacheEntry).key
+	c.entries.Remove(element)
+	delete(c.byKey, key)
+	c.counts[key.typeName]--
+	if c.counts[key.typeName] == 0 {
+		delete(c.counts, key.typeName)
+	}
+}
+
+// invalidate removes the cached results of the type, as it's been written to
+func (c *queryCache) invalidate(typeName string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	c.typeGenerations[typeName]++
+	for element := c.entries.Front(); element != nil && c.counts[typeName] > 0; {
+		next := element.Next()
+		if element.Value.(*queryCacheEntry).key.typeName == typeName {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// beginWrite marks the start of a write transaction run by the store, during which no results are cached, as they
+// could be read before the transaction commits
+func (c *queryCache) beginWrite() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	c.writing++
+	c.Unlock()
+}
+
+// endWrite marks the end of a write transaction started with beginWrite
+func (c *queryCache) endWrite() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	c.writing--
+	c.generation++
+	c.Unlock()
+}
+
+// findCached runs find, unless the results of the query are cached, in which case they're appended to result
+// instead.  Only queries that can be marshalled to JSON are cached, so those with funcs or ValueFuncs are always run
+func (s *Store) findCached(result interface{}, query *Query, find func() error) error {
+	resultVal := reflect.ValueOf(result)
+	if s.queryCache == nil || resultVal.Kind() != reflect.Ptr || resultVal.Elem().Kind() != reflect.Slice {
+		return find()
+	}
+
+	encoded, err := json.Marshal(query)
+	if err != nil {
+		return find()
+	}
+
+	sliceVal := resultVal.Elem()
+	key := queryCacheKey{
+		resultType: sliceVal.Type(),
+		typeName:   s.newStorer(reflect.New(dereference(sliceVal.Type().Elem())).Interface()).Type(),
+		query:      string(encoded),
+	}
+
+	if records, ok := s.queryCache.get(key); ok {
+		sliceVal.Set(reflect.AppendSlice(sliceVal, records))
+		return nil
+	}
+
+	state := s.queryCache.state(key.typeName)
+	start := sliceVal.Len()
+	err = find()
+	if err != nil {
+		return err
+	}
+
+	// copied, so appending to the result doesn't change the cached records
+	found := sliceVal.Slice(start, sliceVal.Len())
+	records := reflect.MakeSlice(found.Type(), found.Len(), found.Len())
+	reflect.Copy(records, found)
+	s.queryCache.put(key, state, records)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Snapshot is a consistent, read-only view of the store.  All reads from a snapshot see the store as it was when the
+// snapshot was taken, regardless of any writes made afterwards
+type Snapshot struct {
+	store *Store
+	tx    *badger.Txn
+	done  func()
+}
+
+// Snapshot returns a read-only snapshot of the store as it is now, so multiple queries can be run against the same
+// data.  Snapshots hold a read transaction open, which keeps badger from discarding older versions of records, so
+// the snapshot must always be closed when it is no longer needed
+func (s *Store) Snapshot() *Snapshot {
+	tx, done := s.newTransaction(false)
+	return &Snapshot{
+		store: s,
+		tx:    tx,
+		done:  done,
+	}
+}
+
+// Get is the same as Store.Get, but reads from the snapshot
+func (s *Snapshot) Get(key, result interface{}) error {
+	return s.store.TxGet(s.tx, key, result)
+}
+
+// Find is the same as Store.Find, but reads from the snapshot
+func (s *Snapshot) Find(result interface{}, query *Query) error {
+	return s.store.TxFind(s.tx, result, query)
+}
+
+// FindOne is the same as Store.FindOne, but reads from the snapshot
+func (s *Snapshot) FindOne(result interface{}, query *Query) error {
+	return s.store.TxFindOne(s.tx, result, query)
+}
+
+// Count is the same as Store.Count, but reads from the snapshot
+func (s *Snapshot) Count(dataType interface{}, query *Query) (uint64, error) {
+	return s.store.TxCount(s.tx, dataType, query)
+}
+
+// ForEach is the same as Store.ForEach, but reads from the snapshot
+func (s *Snapshot) ForEach(query *Query, fn interface{}) error {
+	return s.store.TxForEach(s.tx, query, fn)
+}
+
+// Close releases the snapshot's read transaction.  The snapshot can't be used after it's closed
+func (s *Snapshot) Close() {
+	s.tx.Discard()
+	s.done()
+}
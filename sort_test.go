@@ -5,7 +5,9 @@
 package badgerhold_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/timshannon/badgerhold/v4"
@@ -259,3 +261,241 @@ func TestSortedFindWithNonSlicePtr(t *testing.T) {
 		_ = store.Find(result, badgerhold.Where("Name").Eq("blah").SortBy("Name"))
 	})
 }
+
+func TestSortTiesInKeyOrder(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Tied struct {
+			ID       int    `badgerhold:"key"`
+			Category string `badgerhold:"index"`
+			Group    int
+		}
+
+		for i := 0; i < 300; i++ {
+			ok(t, store.Insert(i, &Tied{Category: fmt.Sprintf("%d", i%3), Group: i % 2}))
+		}
+
+		var expected []Tied
+		ok(t, store.Find(&expected, badgerhold.Where("Group").Eq(0)))
+
+		for i := 0; i < 3; i++ {
+			var result []Tied
+			ok(t, store.Find(&result, badgerhold.Where("Category").Eq("2").
+				Or(badgerhold.Where("Category").Eq("0")).
+				Or(badgerhold.Where("Category").Eq("1")).SortBy("Group")))
+
+			equals(t, expected, result[:len(expected)])
+		}
+
+		var indexed []Tied
+		ok(t, store.Find(&indexed, badgerhold.Where("Category").In("2", "1", "0").Index("Category").SortBy("Group")))
+		equals(t, expected, indexed[:len(expected)])
+	})
+}
+
+func TestFindAllButLast(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		tests := []struct {
+			name   string
+			n      int
+			query  *badgerhold.Query
+			result []int
+		}{
+			{"Sorted", 2, badgerhold.Where("Category").Eq("animal").SortBy("Name"), []int{9, 5, 14, 8, 13}},
+			{"Sorted with skip and limit", 2, badgerhold.Where("Category").Eq("animal").SortBy("Name").
+				Skip(1).Limit(3), []int{5, 14, 8}},
+			{"Sorted with limit past the end", 5, badgerhold.Where("Category").Eq("animal").SortBy("Name").
+				Limit(3), []int{9, 5}},
+			{"More than the result set", 10, badgerhold.Where("Category").Eq("animal").SortBy("Name"), []int{}},
+			{"Unsorted", 3, badgerhold.Where("Category").Eq("food"), []int{4, 7}},
+			{"Indexed", 3, badgerhold.Where("Category").Eq("food").Index("Category"), []int{4, 7}},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				var result []ItemTest
+				ok(t, store.FindAllButLast(&result, tst.n, tst.query))
+				equals(t, len(tst.result), len(result))
+				for i := range result {
+					assert(t, result[i].equal(&testData[tst.result[i]]), "Expected index %d to be %v, Got %v",
+						i, testData[tst.result[i]], result[i])
+				}
+			})
+		}
+
+		var result []ItemTest
+		ok(t, store.Find(&result, tests[0].query))
+		equals(t, 7, len(result))
+	})
+}
+
+func TestSortCollate(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Fruit struct {
+			Name  string
+			Count int
+		}
+
+		for i, name := range []string{"cherry", "Zebra", "apple", "Banana"} {
+			ok(t, store.Insert(i, &Fruit{Name: name, Count: i % 2}))
+		}
+
+		caseInsensitive := func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		}
+
+		names := func(query *badgerhold.Query) []string {
+			var result []Fruit
+			ok(t, store.Find(&result, query))
+			found := []string{}
+			for i := range result {
+				found = append(found, result[i].Name)
+			}
+			return found
+		}
+
+		equals(t, []string{"Banana", "Zebra", "apple", "cherry"}, names(badgerhold.Where("Name").Ne("").SortBy("Name")))
+		equals(t, []string{"apple", "Banana", "cherry", "Zebra"},
+			names(badgerhold.Where("Name").Ne("").SortBy("Name").Collate(caseInsensitive)))
+		equals(t, []string{"Zebra", "cherry", "Banana", "apple"},
+			names(badgerhold.Where("Name").Ne("").SortBy("Name").Collate(caseInsensitive).Reverse()))
+		equals(t, []string{"apple", "cherry", "Banana", "Zebra"},
+			names(badgerhold.Where("Name").Ne("").SortBy("Count", "Name").Collate(caseInsensitive)))
+	})
+}
+
+func TestSortByIndexedField(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Score struct {
+			Player string
+			Points int `badgerhold:"index"`
+		}
+
+		// negative and large values aren't in the same order once they're encoded
+		points := []int{300, -5, 7, 300, 0, -1000, 7, 65536, 2, -5, 1}
+		for i, p := range points {
+			ok(t, store.Insert(i, &Score{Player: fmt.Sprintf("player%d", i), Points: p}))
+		}
+
+		players := func(query *badgerhold.Query) []string {
+			found := []string{}
+			ok(t, store.ForEach(query, func(record *Score) error {
+				found = append(found, record.Player)
+				return nil
+			}))
+			return found
+		}
+
+		queries := []func() *badgerhold.Query{
+			func() *badgerhold.Query { return badgerhold.Where("Points").Ne(1) },
+			func() *badgerhold.Query { return badgerhold.Where("Points").Gt(-10).And("Player").Ne("player1") },
+			func() *badgerhold.Query { return badgerhold.Where("Player").Ne("player2").Skip(2).Limit(4) },
+			func() *badgerhold.Query { return badgerhold.Where("Points").Lt(500).Limit(3) },
+		}
+
+		// sorting with a collator reads every record and sorts them in memory
+		inMemory := func(a, b string) int { return strings.Compare(a, b) }
+
+		for i, query := range queries {
+			t.Run(fmt.Sprintf("Query %d", i), func(t *testing.T) {
+				equals(t, players(query().SortBy("Points").Collate(inMemory)), players(query().SortBy("Points")))
+				equals(t, players(query().SortBy("Points").Collate(inMemory).Reverse()),
+					players(query().SortBy("Points").Reverse()))
+			})
+		}
+
+		var result []Score
+		ok(t, store.Find(&result, badgerhold.Where("Points").Ge(0).SortBy("Points").Skip(1).Limit(3)))
+		equals(t, 3, len(result))
+		equals(t, 1, result[0].Points)
+		equals(t, 2, result[1].Points)
+		equals(t, 7, result[2].Points)
+
+		count, err := store.Count(&Score{}, badgerhold.Where("Points").Gt(0).SortBy("Points"))
+		ok(t, err)
+		equals(t, 7, int(count))
+	})
+}
+
+func TestDistinctBy(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		// the first name of each category, in name order
+		first := make(map[string]string)
+		for i := range testData {
+			name, ok := first[testData[i].Category]
+			if !ok || testData[i].Name < name {
+				first[testData[i].Category] = testData[i].Name
+			}
+		}
+
+		var result []ItemTest
+		ok(t, store.Find(&result, (&badgerhold.Query{}).DistinctBy("Category")))
+		equals(t, len(first), len(result))
+		categories := make(map[string]bool)
+		for i := range result {
+			assert(t, !categories[result[i].Category], "Category %s returned more than once", result[i].Category)
+			categories[result[i].Category] = true
+		}
+
+		result = nil
+		ok(t, store.Find(&result, (&badgerhold.Query{}).DistinctBy("Category").SortBy("Name")))
+		equals(t, len(first), len(result))
+		for i := range result {
+			equals(t, first[result[i].Category], result[i].Name)
+			if i > 0 {
+				assert(t, result[i-1].Name <= result[i].Name, "Results are not sorted by name")
+			}
+		}
+
+		var page []ItemTest
+		ok(t, store.Find(&page, (&badgerhold.Query{}).DistinctBy("Category").SortBy("Name").Skip(1).Limit(2)))
+		equals(t, 2, len(page))
+		equals(t, result[1].Name, page[0].Name)
+		equals(t, result[2].Name, page[1].Name)
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("animal").Or(badgerhold.Where("Category").
+			Eq("food")).DistinctBy("Category")))
+		equals(t, 2, len(result))
+
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").In("animal", "food").Index("Category").
+			DistinctBy("Category")))
+		equals(t, 2, len(result))
+
+		// sorted by the index of the field
+		result = nil
+		ok(t, store.Find(&result, (&badgerhold.Query{}).SortBy("Category").DistinctBy("Category").Reverse()))
+		equals(t, len(first), len(result))
+		for i := 1; i < len(result); i++ {
+			assert(t, result[i-1].Category > result[i].Category, "Results are not sorted by category")
+		}
+
+		encoded, err := json.Marshal((&badgerhold.Query{}).DistinctBy("Category"))
+		ok(t, err)
+		decoded := &badgerhold.Query{}
+		ok(t, json.Unmarshal(encoded, decoded))
+		result = nil
+		ok(t, store.Find(&result, decoded))
+		equals(t, len(first), len(result))
+
+		count, err := store.Count(&ItemTest{}, (&badgerhold.Query{}).DistinctBy("Category", "Color"))
+		ok(t, err)
+		tuples := make(map[string]bool)
+		for i := range testData {
+			tuples[testData[i].Category+"/"+testData[i].Color] = true
+		}
+		equals(t, len(tuples), int(count))
+
+		err = store.Find(&result, (&badgerhold.Query{}).DistinctBy("BadField"))
+		assert(t, err != nil, "No error for a DistinctBy field that doesn't exist")
+
+		defer func() {
+			assert(t, recover() != nil, "DistinctBy with Key didn't panic")
+		}()
+		(&badgerhold.Query{}).DistinctBy(badgerhold.Key)
+	})
+}
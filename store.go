@@ -5,9 +5,12 @@
 package badgerhold
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -19,6 +22,9 @@ const (
 	// BadgerholdKeyTag is the struct tag used to define a field as a key for use in a Find query
 	BadgerholdKeyTag = "badgerholdKey"
 
+	// BadgerholdAggregateTag is the struct tag used to define the aggregate a field is filled with by Aggregate
+	BadgerholdAggregateTag = "badgerholdAgg"
+
 	// badgerholdPrefixTag is the prefix for an alternate (more standard) version of a struct tag
 	badgerholdPrefixTag         = "badgerhold"
 	badgerholdPrefixIndexValue  = "index"
@@ -26,34 +32,132 @@ const (
 	badgerholdPrefixUniqueValue = "unique"
 )
 
+// ErrReadOnly is returned when writing to a store that was opened with the ReadOnly option
+var ErrReadOnly = errors.New("This badgerhold store was opened read-only")
+
 // Store is a badgerhold wrapper around a badger DB
 type Store struct {
-	db               *badger.DB
-	sequenceBandwith uint64
-	sequences        *sync.Map
-
-	encode EncodeFunc
-	decode DecodeFunc
+	db                  *badger.DB
+	sequenceBandwidth   uint64
+	sequences           *sync.Map
+	accessors           *sync.Map
+	computed            *sync.Map // the indexed accessors of each type registered with RegisterComputed
+	indexCaches         *sync.Map
+	defaults            *sync.Map // the default field values of each type
+	cascades            *sync.Map // the types deleted along with the records of each type
+	lites               *sync.Map // the full type of each type registered with RegisterLite
+	maxSubQueryDepth    int
+	readOnly            bool
+	batchSize           int
+	trackInsertionOrder bool
+	decodeWorkers       int
+	maxFindResults      int
+	streamReads         bool
+	namespace           string
+	indexKeyFunc        func(typeName, indexName string, value []byte) []byte
+	queryCache          *queryCache
+	skipMissingRefs     bool
+	strictKeyTypes      bool
+	slowTxnWarning      time.Duration
+	logger              badger.Logger
+
+	encoder         EncodeFunc
+	decoder         DecodeFunc
+	fallbackDecoder DecodeFunc
+	codecs          *sync.Map
 }
 
 // Options allows you set different options from the defaults
 // For example the encoding and decoding funcs which default to Gob
 type Options struct {
-	Encoder          EncodeFunc
-	Decoder          DecodeFunc
+	Encoder EncodeFunc
+	Decoder DecodeFunc
+	// FallbackDecoder is tried whenever the Decoder fails, so a store can be read while its records are migrated
+	// from one format to another, such as from Gob to JSON: set the Encoder and Decoder to the new format and the
+	// FallbackDecoder to the old one.  Records are written in the new format as they're changed.  Keys and index
+	// values are encoded with the Encoder too, so lookups by key or index value only find records written with the
+	// new format.  If both decoders fail, the Decoder's error is returned.  Types with their own codec don't use it
+	FallbackDecoder DecodeFunc
+	// SequenceBandwidth is how many sequence numbers are leased from badger at a time for NextSequence keys.
+	// Leasing a larger range means the lease is persisted less often, which speeds up inserts, but any numbers
+	// leased and not used when the store is closed uncleanly are lost, leaving gaps in the sequence.  Defaults to 100
+	SequenceBandwidth uint64
+	// Deprecated: use SequenceBandwidth.  Only used if SequenceBandwidth is 0
 	SequenceBandwith uint64
+	// MaxSubQueryDepth limits how deeply sub-queries run from a MatchFunc can be nested, after which
+	// ErrSubQueryDepth is returned. 0 means no limit
+	MaxSubQueryDepth int
+	// BatchSize has DeleteMatching, UpdateMatching and ForEachUpdate commit their changes every BatchSize records,
+	// or sooner when the transaction reaches badger's size limit, rather than in a single transaction, so they can
+	// change more records than fit in one badger transaction.  Changes are no longer all or nothing: if an error
+	// occurs, the batches already committed are kept.  Each batch reads the records in key order, resuming after
+	// the last key of the batch before, and matches them in its own transaction.  A batch that conflicts with
+	// another transaction, or that's too big and is cut short, is discarded and run again, so the update func can
+	// be called more than once for its records.  Queries using SortBy, Reverse, DistinctBy, AllButLast or
+	// InStream can't be run in batches.  0 means a single transaction
+	BatchSize int
+	// TrackInsertionOrder keeps a list of the records of each type in the order they were inserted, so they can be
+	// read back in that order with ForEachInOrder regardless of their keys.  Each insert and delete costs two extra
+	// writes, plus a write to persist the insertion sequence every SequenceBandwidth inserts
+	TrackInsertionOrder bool
+	// DecodeWorkers spreads the decoding of the records read by queries across this many goroutines, which can
+	// speed up queries returning many large records.  Records are read ahead in batches to give the workers enough
+	// to do, so a query may decode a few more records than it returns.  Results are in the same order either way.
+	// The Decoder must be safe to call concurrently.  Writes, such as UpdateMatching, always decode on a single
+	// goroutine.  0 or 1 decodes on the goroutine running the query
+	DecodeWorkers int
+	// MaxFindResults has Find return ErrResultTooLarge, rather than building the result, when a query matches more
+	// than this many records.  A safety valve for queries built from user input.  Query.MaxResults overrides it for a
+	// single query.  0 means no limit
+	MaxFindResults int
+	// StreamReads has Find and ForEach read the records of queries that need a full scan with badger's Stream,
+	// which reads ranges of records concurrently, each in its own short lived read transaction, rather than
+	// holding one read transaction open for the entire scan.  Long scans then don't hold up value log GC or pin
+	// memory, but they don't read from a single snapshot: records written while the scan runs may or may not be
+	// seen.  Records are returned in no particular order.  Queries with an index, sort, reverse, skip or limit are
+	// read in a transaction as usual, as are the Tx variants, which run in the transaction passed to them
+	StreamReads bool
+	// IndexKeyFunc builds the badger keys of index entries from the type name, the index name and the encoded index
+	// value, in place of the default layout, such as to use a different prefix scheme.  The entries of an index are
+	// read as the keys starting with IndexKeyFunc(typeName, indexName, nil), so every key must be that prefix
+	// followed by the value, and the prefix of one index must not be a prefix of another's.  Indexes already written
+	// with a different layout must be rebuilt
+	IndexKeyFunc func(typeName, indexName string, value []byte) []byte
+	// QueryCache caches the results of up to this many Find queries, evicting the least recently used, so repeated
+	// identical queries return without reading any records.  Only queries that can be marshalled to JSON are
+	// cached.  A write to a type through the store drops every cached result of that type, and results aren't
+	// cached while the store is running a write transaction.  Writes made in your own transactions with the Tx
+	// methods drop the cached results when they're made rather than when they're committed, so a Find run before
+	// the commit can cache results without them, and writes made directly to badger aren't seen at all.  Cached
+	// records are copied into the result slice, but pointers, slices and maps in them are shared with the cache and
+	// must not be changed.  0 disables the cache
+	QueryCache int
+	// SkipMissingIndexReferences has queries read by index skip index entries whose record no longer exists, such as
+	// one deleted while the index was read, logging a warning with badger's Logger, rather than panicking.  The
+	// query returns the records that do exist.  VerifyIndexes removes such entries
+	SkipMissingIndexReferences bool
+	// StrictKeyTypes has Insert return ErrKeyTypeMismatch, rather than leaving the key field unset, when the key
+	// isn't the same type as the field tagged as the record's key
+	StrictKeyTypes bool
+	// SlowTransactionWarning logs a warning with badger's Logger when a transaction run by the store, such as the
+	// read transaction of a ForEach over a large type, is still open after this long, and again once it's closed
+	// with how long it was open.  Long running transactions hold back badger's value log GC.  The transactions of
+	// Snapshots and ImportType are tracked too, but transactions passed to the Tx methods aren't.  0 disables the
+	// warning
+	SlowTransactionWarning time.Duration
 	badger.Options
 }
 
 // DefaultOptions are a default set of options for opening a BadgerHold database
 // Includes badgers own default options
 var DefaultOptions = Options{
-	Options:          badger.DefaultOptions(""),
-	Encoder:          DefaultEncode,
-	Decoder:          DefaultDecode,
-	SequenceBandwith: 100,
+	Options: badger.DefaultOptions(""),
+	Encoder: DefaultEncode,
+	Decoder: DefaultDecode,
 }
 
+const defaultSequenceBandwidth = 100
+
 // Open opens or creates a badgerhold file.
 func Open(options Options) (*Store, error) {
 	db, err := badger.Open(options.Options)
@@ -61,13 +165,42 @@ func Open(options Options) (*Store, error) {
 		return nil, err
 	}
 
-	return &Store{
-		db:               db,
-		sequenceBandwith: options.SequenceBandwith,
-		sequences:        &sync.Map{},
+	sequenceBandwidth := options.SequenceBandwidth
+	if sequenceBandwidth == 0 {
+		sequenceBandwidth = options.SequenceBandwith
+	}
+	if sequenceBandwidth == 0 {
+		sequenceBandwidth = defaultSequenceBandwidth
+	}
 
-		encode: options.Encoder,
-		decode: options.Decoder,
+	return &Store{
+		db:                  db,
+		sequenceBandwidth:   sequenceBandwidth,
+		sequences:           &sync.Map{},
+		accessors:           &sync.Map{},
+		computed:            &sync.Map{},
+		indexCaches:         &sync.Map{},
+		defaults:            &sync.Map{},
+		cascades:            &sync.Map{},
+		lites:               &sync.Map{},
+		maxSubQueryDepth:    options.MaxSubQueryDepth,
+		readOnly:            options.ReadOnly,
+		batchSize:           options.BatchSize,
+		trackInsertionOrder: options.TrackInsertionOrder,
+		decodeWorkers:       options.DecodeWorkers,
+		maxFindResults:      options.MaxFindResults,
+		streamReads:         options.StreamReads,
+		indexKeyFunc:        options.IndexKeyFunc,
+		queryCache:          newQueryCache(options.QueryCache),
+		skipMissingRefs:     options.SkipMissingIndexReferences,
+		strictKeyTypes:      options.StrictKeyTypes,
+		slowTxnWarning:      options.SlowTransactionWarning,
+		logger:              options.Logger,
+
+		encoder:         options.Encoder,
+		decoder:         options.Decoder,
+		fallbackDecoder: options.FallbackDecoder,
+		codecs:          &sync.Map{},
 	}, nil
 }
 
@@ -76,6 +209,58 @@ func (s *Store) Badger() *badger.DB {
 	return s.db
 }
 
+// update runs fn in a read-write transaction, failing with ErrReadOnly if the store was opened read-only
+func (s *Store) update(fn func(tx *badger.Txn) error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	s.queryCache.beginWrite()
+	defer s.queryCache.endWrite()
+	defer s.watchTxn("read-write")()
+	return s.Badger().Update(fn)
+}
+
+// view runs fn in a read transaction
+func (s *Store) view(fn func(tx *badger.Txn) error) error {
+	defer s.watchTxn("read")()
+	return s.Badger().View(fn)
+}
+
+// newTransaction starts a transaction that isn't run by update or view, such as that of a Snapshot, tracked by the
+// SlowTransactionWarning the same way.  done must be called once the transaction is closed
+func (s *Store) newTransaction(update bool) (tx *badger.Txn, done func()) {
+	kind := "read"
+	if update {
+		kind = "read-write"
+	}
+	done = s.watchTxn(kind)
+	return s.Badger().NewTransaction(update), done
+}
+
+// watchTxn warns if the transaction being started is still open after the SlowTransactionWarning.  The returned
+// func must be called once the transaction is closed, calling it again does nothing
+func (s *Store) watchTxn(kind string) func() {
+	if s.slowTxnWarning <= 0 || s.logger == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	timer := time.AfterFunc(s.slowTxnWarning, func() {
+		s.logger.Warningf("A badgerhold %s transaction has been open for more than %s, which holds back badger's "+
+			"value log GC", kind, s.slowTxnWarning)
+	})
+	closed := false
+	return func() {
+		if closed {
+			return
+		}
+		closed = true
+		if !timer.Stop() {
+			s.logger.Warningf("A slow badgerhold %s transaction closed after %s", kind, time.Since(start))
+		}
+	}
+}
+
 // Close closes the badger db
 func (s *Store) Close() error {
 	var err error
@@ -126,6 +311,15 @@ func (t *anonStorer) Indexes() map[string]Index {
 // if the Type doesn't meet the requirements of a Storer (i.e. doesn't have a name) it panics
 // You can avoid any reflection costs, by implementing the Storer interface on a type
 func (s *Store) newStorer(dataType interface{}) Storer {
+	storer := s.typeStorer(dataType)
+	if s.namespace == "" {
+		return storer
+	}
+	return &namespacedStorer{Storer: storer, namespace: s.namespace}
+}
+
+// typeStorer returns the Storer for the type, ignoring the namespace of the store
+func (s *Store) typeStorer(dataType interface{}) Storer {
 	if storer, ok := dataType.(Storer); ok {
 		return storer
 	}
@@ -153,11 +347,14 @@ func (s *Store) newStorer(dataType interface{}) Storer {
 
 		indexName := ""
 		unique := false
+		var bucket time.Duration
 
 		if strings.Contains(string(storer.rType.Field(i).Tag), BadgerHoldIndexTag) {
 			indexName = storer.rType.Field(i).Tag.Get(BadgerHoldIndexTag)
 
 			if indexName != "" {
+				// invalid options are reported by ValidateType, the field is still indexed without them
+				bucket, _ = indexBucket(indexName)
 				indexName = storer.rType.Field(i).Name
 			}
 		} else if tag := storer.rType.Field(i).Tag.Get(badgerholdPrefixTag); tag != "" {
@@ -178,9 +375,25 @@ func (s *Store) newStorer(dataType interface{}) Storer {
 						tp = tp.Elem()
 					}
 
-					return s.encode(tp.FieldByName(name).Interface())
+					field := tp.FieldByName(name).Interface()
+					if bucket > 0 {
+						field = bucketValue(field, bucket)
+					}
+					return s.encode(field)
 				},
 				Unique: unique,
+				Bucket: bucket,
+			}
+		}
+	}
+
+	if computed, ok := s.computed.Load(tp); ok {
+		for name, compute := range computed.(map[string]Accessor) {
+			compute := compute
+			storer.indexes[name] = Index{
+				IndexFunc: func(_ string, value interface{}) ([]byte, error) {
+					return s.encode(compute(recordPointer(reflect.ValueOf(value)).Interface()))
+				},
 			}
 		}
 	}
@@ -188,10 +401,94 @@ func (s *Store) newStorer(dataType interface{}) Storer {
 	return storer
 }
 
+// Accessor returns the value of a virtual field from a record.  record is always a pointer to the type
+// the accessor was registered against
+type Accessor func(record interface{}) interface{}
+
+type accessorKey struct {
+	tp    reflect.Type
+	field string
+}
+
+// RegisterAccessor registers a virtual field for dataType that can be used in query criteria like any other field.
+// When the field is queried, its value comes from the accessor rather than the struct.  This allows querying on
+// values that aren't exported fields, such as unexported fields or computed values:
+//
+//	store.RegisterAccessor(&Item{}, "FullName", func(record interface{}) interface{} {
+//		return record.(*Item).first + " " + record.(*Item).last
+//	})
+//	store.Find(&result, badgerhold.Where("FullName").Eq("John Doe"))
+//
+// Accessors take precedence over struct fields with the same name.  Virtual fields can't be sorted on, and can only
+// be indexed by registering them with RegisterComputed instead.
+// Like all query fields, name must start with an upper-case letter, otherwise this panics
+func (s *Store) RegisterAccessor(dataType interface{}, name string, accessor Accessor) {
+	if !startsUpper(name) || name == Key {
+		panic("The first letter of a virtual field must be upper-case")
+	}
+
+	s.accessors.Store(accessorKey{
+		tp:    dereference(reflect.TypeOf(dataType)),
+		field: name,
+	}, accessor)
+}
+
+// accessorValue returns the value of the virtual field from the record if an accessor has been registered for it
+func (s *Store) accessorValue(record reflect.Value, field string) (reflect.Value, bool) {
+	accessor, ok := s.accessors.Load(accessorKey{
+		tp:    dereference(record.Type()),
+		field: field,
+	})
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	return reflect.ValueOf(accessor.(Accessor)(recordPointer(record).Interface())), true
+}
+
+// recordPointer returns a single pointer to the record, as accessors are passed
+func recordPointer(record reflect.Value) reflect.Value {
+	for record.Kind() == reflect.Ptr && record.Elem().Kind() == reflect.Ptr {
+		record = record.Elem()
+	}
+	if record.Kind() != reflect.Ptr {
+		ptr := reflect.New(record.Type())
+		ptr.Elem().Set(record)
+		record = ptr
+	}
+	return record
+}
+
+// RegisterComputed registers a virtual field for dataType in the same way as RegisterAccessor, which is also indexed
+// under its name, so it can be queried with Index(name) like any other index:
+//
+//	store.RegisterComputed(&Person{}, "FullName", func(record interface{}) interface{} {
+//		return record.(*Person).First + " " + record.(*Person).Last
+//	})
+//	store.Find(&result, badgerhold.Where("FullName").Eq("John Doe").Index("FullName"))
+//
+// Records written before the field is registered aren't in its index until they're written again, so register it
+// before the store is written to.  Types that implement Storer only get the virtual field, as they have their own
+// indexes
+func (s *Store) RegisterComputed(dataType interface{}, name string, compute func(record interface{}) interface{}) {
+	s.RegisterAccessor(dataType, name, compute)
+
+	tp := dereference(reflect.TypeOf(dataType))
+	computed := make(map[string]Accessor)
+	if existing, ok := s.computed.Load(tp); ok {
+		for n, c := range existing.(map[string]Accessor) {
+			computed[n] = c
+		}
+	}
+	// copied, so storers reading the computed fields concurrently don't see them change
+	computed[name] = compute
+	s.computed.Store(tp, computed)
+}
+
 func (s *Store) getSequence(typeName string) (uint64, error) {
 	seq, ok := s.sequences.Load(typeName)
 	if !ok {
-		newSeq, err := s.Badger().GetSequence([]byte(typeName), s.sequenceBandwith)
+		newSeq, err := s.Badger().GetSequence([]byte(typeName), s.sequenceBandwidth)
 		if err != nil {
 			return 0, err
 		}
@@ -206,6 +503,111 @@ func typePrefix(typeName string) []byte {
 	return []byte("bh_" + typeName + ":")
 }
 
+// ValidateType checks the badgerhold struct tags of dataType for mistakes that would otherwise only show up when
+// records are written, or cause the tags to be silently ignored, such as more than one key field, tags on unexported
+// fields, or tags that aren't recognized.  Call it at startup for each type stored to fail fast
+func (s *Store) ValidateType(dataType interface{}) error {
+	tp := reflect.TypeOf(dataType)
+	if tp == nil {
+		return errors.New("The type to validate can't be nil")
+	}
+	tp = dereference(tp)
+
+	if tp.Kind() != reflect.Struct {
+		return fmt.Errorf("The type %s is not a struct", tp)
+	}
+	if tp.Name() == "" {
+		return fmt.Errorf("The type %s is unnamed", tp)
+	}
+
+	_, isStorer := dataType.(Storer)
+
+	var problems []string
+	var keyFields []string
+
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		tag := string(field.Tag)
+		exported := field.PkgPath == ""
+
+		isKey := false
+		if strings.Contains(tag, BadgerholdKeyTag) {
+			if !strings.HasPrefix(tag, BadgerholdKeyTag) {
+				problems = append(problems, fmt.Sprintf("the %s tag on the field %s must be the first tag",
+					BadgerholdKeyTag, field.Name))
+			}
+			isKey = true
+		}
+
+		isIndex := false
+		if !isStorer && strings.Contains(tag, BadgerHoldIndexTag) {
+			isIndex = true
+			if field.Tag.Get(BadgerHoldIndexTag) == "" {
+				problems = append(problems, fmt.Sprintf("the %s tag on the field %s has no name, so it isn't indexed",
+					BadgerHoldIndexTag, field.Name))
+			}
+			bucket, err := indexBucket(field.Tag.Get(BadgerHoldIndexTag))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("the %s tag on the field %s is invalid: %s",
+					BadgerHoldIndexTag, field.Name, err))
+			} else if bucket > 0 && !isTimeType(field.Type) {
+				problems = append(problems, fmt.Sprintf("the field %s is bucketed, but only time fields can be",
+					field.Name))
+			}
+		}
+
+		if value, ok := field.Tag.Lookup(badgerholdPrefixTag); ok {
+			switch value {
+			case badgerholdPrefixKeyValue:
+				isKey = true
+			case badgerholdPrefixIndexValue, badgerholdPrefixUniqueValue:
+				isIndex = !isStorer
+			default:
+				if !strings.HasPrefix(value, badgerholdDefaultPrefix) {
+					problems = append(problems, fmt.Sprintf("the %s tag value %q on the field %s is not recognized",
+						badgerholdPrefixTag, value, field.Name))
+				} else if _, err := parseDefault(field.Type,
+					strings.TrimPrefix(value, badgerholdDefaultPrefix)); err != nil {
+					problems = append(problems, fmt.Sprintf("the default value of the field %s is invalid: %s",
+						field.Name, err))
+				}
+			}
+		}
+
+		if isKey {
+			keyFields = append(keyFields, field.Name)
+			if !exported {
+				problems = append(problems, fmt.Sprintf("the key field %s is unexported, so it can't be set",
+					field.Name))
+			}
+		}
+
+		if isIndex && !exported {
+			problems = append(problems, fmt.Sprintf("the indexed field %s is unexported, so it can't be indexed",
+				field.Name))
+		}
+
+		if isKey || isIndex {
+			switch dereference(field.Type).Kind() {
+			case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+				problems = append(problems, fmt.Sprintf("the field %s is of type %s, which can't be used as a key "+
+					"or index", field.Name, field.Type))
+			}
+		}
+	}
+
+	if len(keyFields) > 1 {
+		problems = append(problems, fmt.Sprintf("only one field can be the key, but %s are all tagged as keys",
+			strings.Join(keyFields, ", ")))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("The type %s has invalid badgerhold tags: %s", tp.Name(), strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
 func getKeyField(tp reflect.Type) (reflect.StructField, bool) {
 	for i := 0; i < tp.NumField(); i++ {
 		if strings.HasPrefix(string(tp.Field(i).Tag), BadgerholdKeyTag) {
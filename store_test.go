@@ -5,15 +5,21 @@
 package badgerhold_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger/v4"
 	"github.com/timshannon/badgerhold/v4"
 )
 
@@ -38,6 +44,37 @@ func TestOpen(t *testing.T) {
 	}
 }
 
+func TestOpenReadOnly(t *testing.T) {
+	opt := testOptions()
+	defer os.RemoveAll(opt.Dir)
+
+	store, err := badgerhold.Open(opt)
+	ok(t, err)
+	ok(t, store.Insert("key", &ItemTest{Name: "read only"}))
+	ok(t, store.Close())
+
+	opt.ReadOnly = true
+	store, err = badgerhold.Open(opt)
+	ok(t, err)
+	defer store.Close()
+
+	result := &ItemTest{}
+	ok(t, store.Get("key", result))
+	equals(t, "read only", result.Name)
+
+	equals(t, badgerhold.ErrReadOnly, store.Insert("other", &ItemTest{}))
+	equals(t, badgerhold.ErrReadOnly, store.Insert(badgerhold.NextSequence(), &ItemTest{}))
+	equals(t, badgerhold.ErrReadOnly, store.Update("key", &ItemTest{}))
+	equals(t, badgerhold.ErrReadOnly, store.Upsert("key", &ItemTest{}))
+	equals(t, badgerhold.ErrReadOnly, store.Delete("key", &ItemTest{}))
+	equals(t, badgerhold.ErrReadOnly, store.DeleteMatching(&ItemTest{}, nil))
+	equals(t, badgerhold.ErrReadOnly, store.UpdateMatching(&ItemTest{}, nil, func(interface{}) error {
+		return nil
+	}))
+
+	ok(t, store.Get("key", result))
+}
+
 func TestBadger(t *testing.T) {
 	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
 		b := store.Badger()
@@ -253,3 +290,557 @@ func equals(tb testing.TB, exp, act interface{}) {
 		tb.FailNow()
 	}
 }
+
+func TestValidateType(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		ok(t, store.ValidateType(&ItemTest{}))
+		ok(t, store.ValidateType(ItemTest{}))
+
+		type Valid struct {
+			ID       string `badgerhold:"key"`
+			Category string `badgerhold:"index"`
+			Email    string `badgerhold:"unique"`
+			Name     string `badgerholdIndex:"Name"`
+		}
+		ok(t, store.ValidateType(&Valid{}))
+
+		type TwoKeys struct {
+			ID    string `badgerhold:"key"`
+			Other string `badgerholdKey:"Other"`
+		}
+
+		type UnexportedKey struct {
+			id string `badgerhold:"key"`
+		}
+
+		type UnexportedIndex struct {
+			category string `badgerhold:"index"`
+		}
+
+		type KeyNotFirst struct {
+			ID string `json:"id" badgerholdKey:"ID"`
+		}
+
+		type EmptyIndexName struct {
+			Category string `badgerholdIndex:""`
+		}
+
+		type UnknownTag struct {
+			Category string `badgerhold:"indx"`
+		}
+
+		type FuncIndex struct {
+			Fn func() `badgerhold:"index"`
+		}
+
+		type BadBucket struct {
+			Created time.Time `badgerholdIndex:"CreatedHour;bucket=hourly"`
+		}
+
+		type StringBucket struct {
+			Name string `badgerholdIndex:"Name;bucket=1h"`
+		}
+
+		type UnknownOption struct {
+			Category string `badgerholdIndex:"Category;sparse"`
+		}
+
+		type Bucketed struct {
+			Created time.Time `badgerholdIndex:"CreatedHour;bucket=1h"`
+		}
+		ok(t, store.ValidateType(&Bucketed{}))
+
+		// unknown options fail validation, but don't stop the field from being indexed
+		ok(t, store.Insert(1, &UnknownOption{Category: "vegetable"}))
+		var unknown []UnknownOption
+		ok(t, store.Find(&unknown, badgerhold.Where("Category").Eq("vegetable").Index("Category")))
+		equals(t, 1, len(unknown))
+
+		for _, invalid := range []interface{}{
+			&TwoKeys{}, &UnexportedKey{}, &UnexportedIndex{}, &KeyNotFirst{}, &EmptyIndexName{}, &UnknownTag{},
+			&FuncIndex{}, &BadBucket{}, &StringBucket{}, &UnknownOption{}, "not a struct",
+		} {
+			assert(t, store.ValidateType(invalid) != nil, fmt.Sprintf("%T did not fail validation", invalid))
+		}
+	})
+}
+
+type CodecItem struct {
+	ID   int    `badgerhold:"key"`
+	Name string `badgerhold:"index"`
+}
+
+func TestRegisterCodec(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		encoded := 0
+		store.RegisterCodec(&CodecItem{}, func(value interface{}) ([]byte, error) {
+			encoded++
+			return json.Marshal(value)
+		}, json.Unmarshal)
+
+		ok(t, store.Insert(1, &CodecItem{Name: "first"}))
+		ok(t, store.Insert(2, &CodecItem{Name: "second"}))
+		equals(t, 2, encoded)
+
+		// other types still use the store's encoder
+		insertTestData(t, store)
+		equals(t, 2, encoded)
+
+		key, err := store.EncodeKey(1, "CodecItem")
+		ok(t, err)
+		ok(t, store.Badger().View(func(tx *badger.Txn) error {
+			item, err := tx.Get(key)
+			if err != nil {
+				return err
+			}
+			return item.Value(func(val []byte) error {
+				var raw map[string]interface{}
+				return json.Unmarshal(val, &raw)
+			})
+		}))
+
+		var result CodecItem
+		ok(t, store.Get(2, &result))
+		equals(t, CodecItem{ID: 2, Name: "second"}, result)
+
+		var found []CodecItem
+		ok(t, store.Find(&found, badgerhold.Where("Name").Eq("first").Index("Name")))
+		equals(t, []CodecItem{{ID: 1, Name: "first"}}, found)
+	})
+}
+
+func TestVerifyIndexes(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		repaired, err := store.VerifyIndexes(&ItemTest{})
+		ok(t, err)
+		equals(t, 0, repaired)
+
+		// change the records behind badgerhold's back, leaving their index entries stale
+		deleted := testData[0]
+		changed := testData[1]
+		changed.Category = "changed"
+		ok(t, store.Badger().Update(func(tx *badger.Txn) error {
+			key, err := store.EncodeKey(deleted.Key, "ItemTest")
+			if err != nil {
+				return err
+			}
+			err = tx.Delete(key)
+			if err != nil {
+				return err
+			}
+
+			key, err = store.EncodeKey(changed.Key, "ItemTest")
+			if err != nil {
+				return err
+			}
+			value, err := badgerhold.DefaultEncode(&changed)
+			if err != nil {
+				return err
+			}
+			return tx.Set(key, value)
+		}))
+
+		// the deleted record has entries in both indexes, the changed one only in Category
+		repaired, err = store.VerifyIndexes(&ItemTest{})
+		ok(t, err)
+		equals(t, 3, repaired)
+
+		repaired, err = store.VerifyIndexes(&ItemTest{})
+		ok(t, err)
+		equals(t, 0, repaired)
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq(testData[1].Category).Index("Category")))
+		for i := range result {
+			assert(t, result[i].Key != deleted.Key && result[i].Key != changed.Key,
+				fmt.Sprintf("stale index entry for %d was not removed", result[i].Key))
+		}
+	})
+}
+
+func TestNamespace(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		tenantA := store.Namespace("tenantA")
+		tenantB := store.Namespace("tenantB")
+
+		insertTestData(t, tenantA)
+		ok(t, tenantB.Insert(testData[0].Key, &ItemTest{Key: testData[0].Key, Name: "only in b", Category: "animal"}))
+
+		count, err := store.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		count, err = tenantA.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(len(testData)), count)
+
+		var result []ItemTest
+		ok(t, tenantB.Find(&result, badgerhold.Where("Category").Eq("animal").Index("Category")))
+		equals(t, 1, len(result))
+		equals(t, "only in b", result[0].Name)
+		equals(t, testData[0].Key, result[0].Key)
+
+		var item ItemTest
+		ok(t, tenantA.Get(testData[0].Key, &item))
+		equals(t, testData[0].Name, item.Name)
+
+		ok(t, tenantB.Delete(testData[0].Key, &ItemTest{}))
+		ok(t, tenantA.Get(testData[0].Key, &item))
+
+		// sequences are kept per namespace
+		ok(t, tenantB.Insert(badgerhold.NextSequence(), &ItemTest{Name: "sequenced"}))
+		result = nil
+		ok(t, tenantB.Find(&result, badgerhold.Where("Name").Eq("sequenced")))
+		equals(t, 1, len(result))
+
+		nested := tenantA.Namespace("nested")
+		count, err = nested.Count(&ItemTest{}, nil)
+		ok(t, err)
+		equals(t, uint64(0), count)
+
+		keyA, err := tenantA.EncodeKey(1, "ItemTest")
+		ok(t, err)
+		keyB, err := tenantB.EncodeKey(1, "ItemTest")
+		ok(t, err)
+		assert(t, string(keyA) != string(keyB), "namespaces encoded the same key")
+
+		var decoded int
+		ok(t, tenantA.DecodeKey(keyA, &decoded, "ItemTest"))
+		equals(t, 1, decoded)
+		assert(t, tenantB.DecodeKey(keyA, &decoded, "ItemTest") != nil,
+			"a key from another namespace was decoded")
+	})
+}
+
+type ExportUser struct {
+	Email string `badgerhold:"unique"`
+	Team  string `badgerholdIndex:"Team"`
+}
+
+func TestExportType(t *testing.T) {
+	testWrap(t, func(source *badgerhold.Store, t *testing.T) {
+		insertTestData(t, source)
+		ok(t, source.Insert("a", &ExportUser{Email: "a@example.com", Team: "red"}))
+		ok(t, source.Insert("b", &ExportUser{Email: "b@example.com", Team: "red"}))
+
+		var items, users bytes.Buffer
+		ok(t, source.ExportType(&ItemTest{}, &items))
+		ok(t, source.ExportType(&ExportUser{}, &users))
+
+		testWrap(t, func(target *badgerhold.Store, t *testing.T) {
+			ok(t, target.ImportType(bytes.NewReader(items.Bytes())))
+
+			var expected, result []ItemTest
+			ok(t, source.Find(&expected, nil))
+			ok(t, target.Find(&result, nil))
+			equals(t, expected, result)
+
+			// index entries are imported along with the records
+			expected, result = nil, nil
+			ok(t, source.Find(&expected, badgerhold.Where("Category").Eq("animal").Index("Category")))
+			ok(t, target.Find(&result, badgerhold.Where("Category").Eq("animal").Index("Category")))
+			equals(t, expected, result)
+
+			equals(t, badgerhold.ErrKeyExists, target.ImportType(bytes.NewReader(items.Bytes())))
+
+			// imported index entries are merged with the existing entries
+			ok(t, target.Insert("c", &ExportUser{Email: "c@example.com", Team: "red"}))
+			ok(t, target.ImportType(bytes.NewReader(users.Bytes())))
+			count, err := target.Count(&ExportUser{}, badgerhold.Where("Team").Eq("red").Index("Team"))
+			ok(t, err)
+			equals(t, uint64(3), count)
+
+			// records can be imported into a namespace
+			tenant := target.Namespace("tenant")
+			ok(t, tenant.ImportType(bytes.NewReader(users.Bytes())))
+			var tenantUsers []ExportUser
+			ok(t, tenant.Find(&tenantUsers, badgerhold.Where("Team").Eq("red").Index("Team")))
+			equals(t, []ExportUser{{Email: "a@example.com", Team: "red"}, {Email: "b@example.com", Team: "red"}},
+				tenantUsers)
+		})
+
+		testWrap(t, func(target *badgerhold.Store, t *testing.T) {
+			ok(t, target.Insert("other", &ExportUser{Email: "a@example.com"}))
+			equals(t, badgerhold.ErrUniqueExists, target.ImportType(bytes.NewReader(users.Bytes())))
+		})
+	})
+}
+
+func TestIndexKeyFunc(t *testing.T) {
+	opt := testOptions()
+	opt.IndexKeyFunc = func(typeName, indexName string, value []byte) []byte {
+		return append([]byte("idx/"+typeName+"/"+indexName+"/"), value...)
+	}
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		var result, expected []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food").Index("Category")))
+		ok(t, store.Find(&expected, badgerhold.Where("Category").Eq("food").NoIndex()))
+		assert(t, len(expected) > 0, "No records matched")
+		equals(t, expected, result)
+
+		ok(t, store.Delete(expected[0].Key, &ItemTest{}))
+		result = nil
+		ok(t, store.Find(&result, badgerhold.Where("Category").Gt("animal").Index("Category")))
+		for i := range result {
+			assert(t, result[i].Key != expected[0].Key, "The deleted record was still in the index")
+		}
+
+		ok(t, store.Badger().View(func(tx *badger.Txn) error {
+			iter := tx.NewIterator(badger.DefaultIteratorOptions)
+			defer iter.Close()
+
+			custom, found := 0, 0
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				if bytes.HasPrefix(iter.Item().Key(), []byte("idx/ItemTest/Category/")) {
+					custom++
+				}
+				if bytes.HasPrefix(iter.Item().Key(), []byte("_bhIndex")) {
+					found++
+				}
+			}
+			assert(t, custom > 0, "No index entries were stored with the IndexKeyFunc")
+			equals(t, 0, found)
+			return nil
+		}))
+	})
+}
+
+func TestFallbackDecoder(t *testing.T) {
+	opt := testOptions()
+	defer os.RemoveAll(opt.Dir)
+
+	store, err := badgerhold.Open(opt)
+	ok(t, err)
+	insertTestData(t, store)
+	ok(t, store.Close())
+
+	opt.Encoder = json.Marshal
+	opt.Decoder = json.Unmarshal
+	store, err = badgerhold.Open(opt)
+	ok(t, err)
+
+	var result []ItemTest
+	assert(t, store.Find(&result, nil) != nil, "Find of Gob records with a JSON decoder did not fail")
+	ok(t, store.Close())
+
+	opt.FallbackDecoder = badgerhold.DefaultDecode
+	store, err = badgerhold.Open(opt)
+	ok(t, err)
+	defer store.Close()
+
+	ok(t, store.Insert(100, &ItemTest{Name: "json", Category: "food"}))
+
+	result = nil
+	ok(t, store.Find(&result, nil))
+	equals(t, len(testData)+1, len(result))
+
+	result = nil
+	ok(t, store.Find(&result, badgerhold.Where("Category").Eq("food")))
+	equals(t, 6, len(result))
+}
+
+func TestKeyList(t *testing.T) {
+	var list badgerhold.KeyList
+	list.Add([]byte("b"))
+	list.Add([]byte("a"))
+	list.Add([]byte("c"))
+	list.Add([]byte("a"))
+	equals(t, badgerhold.KeyList{[]byte("a"), []byte("b"), []byte("c")}, list)
+
+	assert(t, list.In([]byte("b")), "b is not in the list")
+	list.Remove([]byte("bb"))
+	equals(t, 3, len(list))
+	list.Remove([]byte("b"))
+	assert(t, !list.In([]byte("b")), "b is still in the list")
+	equals(t, badgerhold.KeyList{[]byte("a"), []byte("c")}, list)
+
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		value, err := badgerhold.DefaultEncode(testData[0].Category)
+		ok(t, err)
+		key, err := badgerhold.DefaultEncode(testData[0].Key)
+		ok(t, err)
+
+		ok(t, store.Badger().View(func(tx *badger.Txn) error {
+			item, err := tx.Get(append([]byte("_bhIndex:ItemTest:Category:"), value...))
+			ok(t, err)
+
+			var keys badgerhold.KeyList
+			ok(t, item.Value(func(val []byte) error {
+				return badgerhold.DefaultDecode(val, &keys)
+			}))
+			count := 0
+			for i := range testData {
+				if testData[i].Category == testData[0].Category {
+					count++
+				}
+			}
+			equals(t, count, len(keys))
+			assert(t, keys.In(append([]byte("bh_ItemTest:"), key...)), "The record's key is not in the index")
+			return nil
+		}))
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		type Counter struct {
+			Count int
+		}
+
+		ok(t, store.Insert("items", &Counter{}))
+
+		insert := func(txn *badgerhold.Txn, key int, item *ItemTest) error {
+			err := txn.Insert(key, item)
+			if err != nil {
+				return err
+			}
+
+			counter := &Counter{}
+			err = txn.Get("items", counter)
+			if err != nil {
+				return err
+			}
+			counter.Count++
+			return txn.Update("items", counter)
+		}
+
+		ok(t, store.Transaction(func(txn *badgerhold.Txn) error {
+			return insert(txn, 1, &ItemTest{Name: "one", Category: "food"})
+		}))
+
+		// an error discards everything the transaction did
+		fail := errors.New("fail")
+		equals(t, fail, store.Transaction(func(txn *badgerhold.Txn) error {
+			err := insert(txn, 2, &ItemTest{Name: "two", Category: "food"})
+			if err != nil {
+				return err
+			}
+			return fail
+		}))
+
+		err := store.Transaction(func(txn *badgerhold.Txn) error {
+			return insert(txn, 1, &ItemTest{Name: "duplicate"})
+		})
+		equals(t, badgerhold.ErrKeyExists, err)
+
+		counter := &Counter{}
+		ok(t, store.Get("items", counter))
+		equals(t, 1, counter.Count)
+
+		ok(t, store.Transaction(func(txn *badgerhold.Txn) error {
+			count, err := txn.Count(&ItemTest{}, badgerhold.Where("Category").Eq("food"))
+			if err != nil {
+				return err
+			}
+			equals(t, uint64(1), count)
+			return nil
+		}))
+	})
+}
+
+type warningLogger struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *warningLogger) Errorf(format string, args ...interface{}) {}
+func (l *warningLogger) Infof(format string, args ...interface{})  {}
+func (l *warningLogger) Debugf(format string, args ...interface{}) {}
+func (l *warningLogger) Warningf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+// matching returns the warnings logged so far that contain substr
+func (l *warningLogger) matching(substr string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var result []string
+	for _, warning := range l.warnings {
+		if strings.Contains(warning, substr) {
+			result = append(result, warning)
+		}
+	}
+	return result
+}
+
+func TestSkipMissingIndexReferences(t *testing.T) {
+	logger := &warningLogger{}
+	opt := testOptions()
+	opt.SkipMissingIndexReferences = true
+	opt.Logger = logger
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		// delete the record behind badgerhold's back, leaving its index entry behind
+		deleted := testData[0]
+		ok(t, store.Badger().Update(func(tx *badger.Txn) error {
+			key, err := store.EncodeKey(deleted.Key, "ItemTest")
+			if err != nil {
+				return err
+			}
+			return tx.Delete(key)
+		}))
+
+		var want []ItemTest
+		ok(t, store.Find(&want, badgerhold.Where("Category").Eq(deleted.Category)))
+
+		var result []ItemTest
+		ok(t, store.Find(&result, badgerhold.Where("Category").Eq(deleted.Category).Index("Category")))
+		equals(t, len(want), len(result))
+
+		equals(t, 1, len(logger.matching("badgerhold: ")))
+	})
+}
+
+func TestSlowTransactionWarning(t *testing.T) {
+	logger := &warningLogger{}
+	opt := testOptions()
+	opt.SlowTransactionWarning = 50 * time.Millisecond
+	opt.Logger = logger
+	testWrapWithOpt(t, opt, func(store *badgerhold.Store, t *testing.T) {
+		insertTestData(t, store)
+
+		// warnings about other slow transactions aren't counted
+		warnings := func(substr string) int {
+			return len(logger.matching(substr))
+		}
+		opened, closed := warnings("read transaction has been open"), warnings("read transaction closed after")
+
+		first := true
+		ok(t, store.ForEach(nil, func(record *ItemTest) error {
+			if first {
+				first = false
+				time.Sleep(250 * time.Millisecond)
+				// warned while the transaction is still open
+				equals(t, opened+1, warnings("read transaction has been open"))
+				equals(t, closed, warnings("read transaction closed after"))
+			}
+			return nil
+		}))
+		equals(t, closed+1, warnings("read transaction closed after"))
+
+		opened, closed = warnings("read-write transaction has been open"), warnings("read-write transaction closed after")
+		ok(t, store.Transaction(func(txn *badgerhold.Txn) error {
+			time.Sleep(250 * time.Millisecond)
+			return nil
+		}))
+		equals(t, opened+1, warnings("read-write transaction has been open"))
+		equals(t, closed+1, warnings("read-write transaction closed after"))
+
+		opened, closed = warnings("read transaction has been open"), warnings("read transaction closed after")
+		snapshot := store.Snapshot()
+		time.Sleep(250 * time.Millisecond)
+		equals(t, opened+1, warnings("read transaction has been open"))
+		snapshot.Close()
+		snapshot.Close()
+		equals(t, closed+1, warnings("read transaction closed after"))
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var errStreamClosed = errors.New("This result stream has been closed")
+
+// ResultStream is a cursor over the results of a query, read with Next and Scan:
+//
+//	stream, err := store.FindStream(&Item{}, query, 100)
+//	if err != nil {
+//		return err
+//	}
+//	defer stream.Close()
+//	for stream.Next() {
+//		var item Item
+//		err = stream.Scan(&item)
+//		...
+//	}
+//	return stream.Err()
+type ResultStream struct {
+	store     *Store
+	typeName  string
+	records   chan *streamRecord
+	closed    chan struct{}
+	closeOnce sync.Once
+	current   *streamRecord
+	err       error
+}
+
+type streamRecord struct {
+	key   []byte
+	value []byte
+}
+
+// FindStream runs the query in the background, sending the matching records to the returned stream as they're
+// found.  Up to buffer records are read ahead of the records taken from the stream with Next.  Records aren't decoded
+// until they're passed to Scan.
+// The query runs in its own read transaction, which stays open until every record has been read from the stream or
+// the stream is closed, so the stream must always be closed.  The query must not be changed or run elsewhere while
+// the stream is open
+func (s *Store) FindStream(dataType interface{}, query *Query, buffer int) (*ResultStream, error) {
+	if buffer < 0 {
+		return nil, errors.New("The result stream buffer can't be negative")
+	}
+	if query == nil {
+		query = &Query{}
+	}
+
+	stream := &ResultStream{
+		store:    s,
+		typeName: s.newStorer(dataType).Type(),
+		records:  make(chan *streamRecord, buffer),
+		closed:   make(chan struct{}),
+	}
+
+	query.writable = false
+	query.skipDecode = true
+
+	go func() {
+		err := s.view(func(tx *badger.Txn) error {
+			return s.runQuery(tx, dataType, query, nil, query.skip, func(r *record) error {
+				rec := &streamRecord{
+					key:   append([]byte(nil), r.key...),
+					value: append([]byte(nil), r.raw...),
+				}
+				select {
+				case stream.records <- rec:
+					return nil
+				case <-stream.closed:
+					return errStreamClosed
+				}
+			})
+		})
+		query.skipDecode = false
+		if err != errStreamClosed {
+			stream.err = err
+		}
+		close(stream.records)
+	}()
+
+	return stream, nil
+}
+
+// Next moves the stream to the next record, waiting for it if it hasn't been found yet.  Returns false when there
+// are no more records or the query failed, which is reported by Err
+func (r *ResultStream) Next() bool {
+	rec, ok := <-r.records
+	if !ok {
+		r.current = nil
+		return false
+	}
+
+	r.current = rec
+	return true
+}
+
+// Scan decodes the current record into dest, which must be a pointer to the type being queried.  If the type has
+// a field tagged as the key, it's set to the record's key
+func (r *ResultStream) Scan(dest interface{}) error {
+	if r.current == nil {
+		return errors.New("Scan called without a current record, Next must return true first")
+	}
+
+	err := r.store.decodeRecord(r.current.value, dest)
+	if err != nil {
+		return err
+	}
+
+	destVal := reflect.ValueOf(dest)
+	for destVal.Kind() == reflect.Ptr && destVal.Elem().Kind() == reflect.Ptr {
+		destVal = destVal.Elem()
+	}
+
+	if destVal.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	if keyField, ok := getKeyField(destVal.Elem().Type()); ok {
+		return r.store.setKeyField(r.current.key, destVal, keyField, r.typeName)
+	}
+
+	return nil
+}
+
+// Err returns the error, if any, that stopped the query.  Only valid after Next returns false
+func (r *ResultStream) Err() error {
+	return r.err
+}
+
+// Close stops the query if it's still running and ends its transaction.  Returns the error that stopped the query,
+// if any.  Close can be called more than once
+func (r *ResultStream) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	// wait for the query to finish
+	for range r.records {
+	}
+
+	r.current = nil
+	return r.err
+}
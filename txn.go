@@ -0,0 +1,241 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"io"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Txn is a transaction started with Store.Transaction.  Its methods are the same as the Store's Tx methods, run in
+// the transaction, so several operations can be made atomically without using badger directly
+type Txn struct {
+	store *Store
+	tx    *badger.Txn
+}
+
+// Transaction runs fn in a new read-write transaction, which is committed if fn returns nil and discarded if it
+// returns an error, so either all of the operations fn makes are stored, or none of them are
+func (s *Store) Transaction(fn func(txn *Txn) error) error {
+	return s.update(func(tx *badger.Txn) error {
+		return fn(&Txn{store: s, tx: tx})
+	})
+}
+
+// Badger returns the underlying badger transaction
+func (t *Txn) Badger() *badger.Txn {
+	return t.tx
+}
+
+// Aggregate is the same as Store.TxAggregate, run in the transaction
+func (t *Txn) Aggregate(dataType interface{}, query *Query, into interface{}) error {
+	return t.store.TxAggregate(t.tx, dataType, query, into)
+}
+
+// Count is the same as Store.TxCount, run in the transaction
+func (t *Txn) Count(dataType interface{}, query *Query) (uint64, error) {
+	return t.store.TxCount(t.tx, dataType, query)
+}
+
+// CountBy is the same as Store.TxCountBy, run in the transaction
+func (t *Txn) CountBy(dataType interface{}, query *Query, field string) (map[interface{}]uint64, error) {
+	return t.store.TxCountBy(t.tx, dataType, query, field)
+}
+
+// CountDistinct is the same as Store.TxCountDistinct, run in the transaction
+func (t *Txn) CountDistinct(dataType interface{}, query *Query, field string) (uint64, error) {
+	return t.store.TxCountDistinct(t.tx, dataType, query, field)
+}
+
+// Delete is the same as Store.TxDelete, run in the transaction
+func (t *Txn) Delete(key, dataType interface{}) error {
+	return t.store.TxDelete(t.tx, key, dataType)
+}
+
+// DeleteMatching is the same as Store.TxDeleteMatching, run in the transaction
+func (t *Txn) DeleteMatching(dataType interface{}, query *Query) error {
+	return t.store.TxDeleteMatching(t.tx, dataType, query)
+}
+
+// DeleteMatchingKeys is the same as Store.TxDeleteMatchingKeys, run in the transaction
+func (t *Txn) DeleteMatchingKeys(dataType interface{}, query *Query) ([]interface{}, error) {
+	return t.store.TxDeleteMatchingKeys(t.tx, dataType, query)
+}
+
+// DeleteReturn is the same as Store.TxDeleteReturn, run in the transaction
+func (t *Txn) DeleteReturn(key, result interface{}) error {
+	return t.store.TxDeleteReturn(t.tx, key, result)
+}
+
+// ExportType is the same as Store.TxExportType, run in the transaction
+func (t *Txn) ExportType(dataType interface{}, w io.Writer) error {
+	return t.store.TxExportType(t.tx, dataType, w)
+}
+
+// Find is the same as Store.TxFind, run in the transaction
+func (t *Txn) Find(result interface{}, query *Query) error {
+	return t.store.TxFind(t.tx, result, query)
+}
+
+// FindAbovePercentile is the same as Store.TxFindAbovePercentile, run in the transaction
+func (t *Txn) FindAbovePercentile(dataType interface{}, query *Query, field string, pct float64,
+	result interface{}) error {
+	return t.store.TxFindAbovePercentile(t.tx, dataType, query, field, pct, result)
+}
+
+// FindAggregate is the same as Store.TxFindAggregate, run in the transaction
+func (t *Txn) FindAggregate(dataType interface{}, query *Query, groupBy ...string) ([]*AggregateResult, error) {
+	return t.store.TxFindAggregate(t.tx, dataType, query, groupBy...)
+}
+
+// FindAllButLast is the same as Store.TxFindAllButLast, run in the transaction
+func (t *Txn) FindAllButLast(result interface{}, n int, query *Query) error {
+	return t.store.TxFindAllButLast(t.tx, result, n, query)
+}
+
+// FindExcept is the same as Store.TxFindExcept, run in the transaction
+func (t *Txn) FindExcept(result interface{}, include, exclude *Query) error {
+	return t.store.TxFindExcept(t.tx, result, include, exclude)
+}
+
+// FindGrouped is the same as Store.TxFindGrouped, run in the transaction
+func (t *Txn) FindGrouped(dataType interface{}, query *Query, groupBy string) (map[interface{}][]interface{}, error) {
+	return t.store.TxFindGrouped(t.tx, dataType, query, groupBy)
+}
+
+// FindKeys is the same as Store.TxFindKeys, run in the transaction
+func (t *Txn) FindKeys(dataType interface{}, query *Query) ([]interface{}, error) {
+	return t.store.TxFindKeys(t.tx, dataType, query)
+}
+
+// FindLazy is the same as Store.TxFindLazy, run in the transaction
+func (t *Txn) FindLazy(dataType interface{}, query *Query, fn func(record *LazyRecord) error) error {
+	return t.store.TxFindLazy(t.tx, dataType, query, fn)
+}
+
+// FindMap is the same as Store.TxFindMap, run in the transaction
+func (t *Txn) FindMap(result interface{}, query *Query) error {
+	return t.store.TxFindMap(t.tx, result, query)
+}
+
+// FindMapped is the same as Store.TxFindMapped, run in the transaction
+func (t *Txn) FindMapped(dataType interface{}, query *Query, mapFn func(record interface{}) (interface{}, error),
+	result interface{}) error {
+	return t.store.TxFindMapped(t.tx, dataType, query, mapFn, result)
+}
+
+// FindOne is the same as Store.TxFindOne, run in the transaction
+func (t *Txn) FindOne(result interface{}, query *Query) error {
+	return t.store.TxFindOne(t.tx, result, query)
+}
+
+// FindTolerant is the same as Store.TxFindTolerant, run in the transaction
+func (t *Txn) FindTolerant(result interface{}, query *Query) ([]error, error) {
+	return t.store.TxFindTolerant(t.tx, result, query)
+}
+
+// FindUnion is the same as Store.TxFindUnion, run in the transaction
+func (t *Txn) FindUnion(queries ...TypedQuery) ([]TypedResult, error) {
+	return t.store.TxFindUnion(t.tx, queries...)
+}
+
+// FindWithRunningTotal is the same as Store.TxFindWithRunningTotal, run in the transaction
+func (t *Txn) FindWithRunningTotal(query *Query, sortField, valueField, totalField string, result interface{}) error {
+	return t.store.TxFindWithRunningTotal(t.tx, query, sortField, valueField, totalField, result)
+}
+
+// ForEach is the same as Store.TxForEach, run in the transaction
+func (t *Txn) ForEach(query *Query, fn interface{}) error {
+	return t.store.TxForEach(t.tx, query, fn)
+}
+
+// ForEachIndexRange is the same as Store.TxForEachIndexRange, run in the transaction
+func (t *Txn) ForEachIndexRange(dataType interface{}, indexName string, from, to interface{}, batch int,
+	fn func(records []interface{}) error) error {
+	return t.store.TxForEachIndexRange(t.tx, dataType, indexName, from, to, batch, fn)
+}
+
+// ForEachInOrder is the same as Store.TxForEachInOrder, run in the transaction
+func (t *Txn) ForEachInOrder(query *Query, fn interface{}) error {
+	return t.store.TxForEachInOrder(t.tx, query, fn)
+}
+
+// ForEachPooled is the same as Store.TxForEachPooled, run in the transaction
+func (t *Txn) ForEachPooled(query *Query, newRecord func() interface{}, release func(record interface{}),
+	fn func(record interface{}) error) error {
+	return t.store.TxForEachPooled(t.tx, query, newRecord, release, fn)
+}
+
+// ForEachUpdate is the same as Store.TxForEachUpdate, run in the transaction
+func (t *Txn) ForEachUpdate(dataType interface{}, query *Query,
+	fn func(record interface{}) (changed bool, err error)) error {
+	return t.store.TxForEachUpdate(t.tx, dataType, query, fn)
+}
+
+// Get is the same as Store.TxGet, run in the transaction
+func (t *Txn) Get(key, result interface{}) error {
+	return t.store.TxGet(t.tx, key, result)
+}
+
+// GetLite is the same as Store.TxGetLite, run in the transaction
+func (t *Txn) GetLite(key, liteResult interface{}) error {
+	return t.store.TxGetLite(t.tx, key, liteResult)
+}
+
+// GetRaw is the same as Store.TxGetRaw, run in the transaction
+func (t *Txn) GetRaw(key, dataType interface{}) ([]byte, error) {
+	return t.store.TxGetRaw(t.tx, key, dataType)
+}
+
+// GetRelated is the same as Store.TxGetRelated, run in the transaction
+func (t *Txn) GetRelated(record interface{}, field string, relatedResult interface{}) error {
+	return t.store.TxGetRelated(t.tx, record, field, relatedResult)
+}
+
+// Increment is the same as Store.TxIncrement, run in the transaction
+func (t *Txn) Increment(key, dataType interface{}, field string, delta int64) (int64, error) {
+	return t.store.TxIncrement(t.tx, key, dataType, field, delta)
+}
+
+// IndexBoundaries is the same as Store.TxIndexBoundaries, run in the transaction
+func (t *Txn) IndexBoundaries(dataType interface{}, indexName string, parts int) ([]interface{}, error) {
+	return t.store.TxIndexBoundaries(t.tx, dataType, indexName, parts)
+}
+
+// Insert is the same as Store.TxInsert, run in the transaction
+func (t *Txn) Insert(key, data interface{}) error {
+	return t.store.TxInsert(t.tx, key, data)
+}
+
+// Update is the same as Store.TxUpdate, run in the transaction
+func (t *Txn) Update(key interface{}, data interface{}) error {
+	return t.store.TxUpdate(t.tx, key, data)
+}
+
+// UpdateIfUnchanged is the same as Store.TxUpdateIfUnchanged, run in the transaction
+func (t *Txn) UpdateIfUnchanged(key, oldData, newData interface{}) error {
+	return t.store.TxUpdateIfUnchanged(t.tx, key, oldData, newData)
+}
+
+// UpdateMatching is the same as Store.TxUpdateMatching, run in the transaction
+func (t *Txn) UpdateMatching(dataType interface{}, query *Query, update func(record interface{}) error) error {
+	return t.store.TxUpdateMatching(t.tx, dataType, query, update)
+}
+
+// Upsert is the same as Store.TxUpsert, run in the transaction
+func (t *Txn) Upsert(key interface{}, data interface{}) error {
+	return t.store.TxUpsert(t.tx, key, data)
+}
+
+// UpsertReport is the same as Store.TxUpsertReport, run in the transaction
+func (t *Txn) UpsertReport(key interface{}, data interface{}) (bool, error) {
+	return t.store.TxUpsertReport(t.tx, key, data)
+}
+
+// VerifyIndexes is the same as Store.TxVerifyIndexes, run in the transaction
+func (t *Txn) VerifyIndexes(dataType interface{}) (int, error) {
+	return t.store.TxVerifyIndexes(t.tx, dataType)
+}
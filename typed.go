@@ -0,0 +1,36 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+// Find is the same as Store.Find, but returns the records as a slice of T, so the type of the result is checked at
+// compile time.  T is the type of record, or a pointer to it
+//
+//	items, err := badgerhold.Find[Item](store, badgerhold.Where("Category").Eq("food"))
+func Find[T interface{}](s *Store, query *Query) ([]T, error) {
+	var result []T
+	err := s.Find(&result, query)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindOne is the same as Store.FindOne, but returns the record as a T.  T is the type of record, not a pointer to
+// it.  Returns ErrNotFound if no record matches the query
+func FindOne[T interface{}](s *Store, query *Query) (T, error) {
+	var result T
+	err := s.FindOne(&result, query)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// Count is the same as Store.Count, for the records of type T
+func Count[T interface{}](s *Store, query *Query) (uint64, error) {
+	var dataType T
+	return s.Count(&dataType, query)
+}
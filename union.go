@@ -0,0 +1,101 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// TypedQuery is a query against a specific type for use in FindUnion
+type TypedQuery struct {
+	DataType interface{}
+	Query    *Query
+}
+
+// TypedResult is a single record returned from FindUnion
+type TypedResult struct {
+	Type  string      // the type name of the record, as reported by its Storer
+	Value interface{} // always a pointer to the record
+}
+
+// FindUnion runs each of the passed in typed queries in the same transaction, and returns the combined results in
+// the order the queries were passed in.  Use SortUnion to order the combined results by a field the types share
+func (s *Store) FindUnion(queries ...TypedQuery) ([]TypedResult, error) {
+	var result []TypedResult
+	err := s.view(func(tx *badger.Txn) error {
+		var txErr error
+		result, txErr = s.TxFindUnion(tx, queries...)
+		return txErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TxFindUnion is the same as FindUnion, but you specify your own transaction
+func (s *Store) TxFindUnion(tx *badger.Txn, queries ...TypedQuery) ([]TypedResult, error) {
+	var result []TypedResult
+
+	for i := range queries {
+		tp := dereference(reflect.TypeOf(queries[i].DataType))
+		typeName := storerType(s.newStorer(queries[i].DataType))
+
+		records := reflect.New(reflect.SliceOf(reflect.PtrTo(tp)))
+		err := s.findQuery(tx, records.Interface(), queries[i].Query)
+		if err != nil {
+			return nil, err
+		}
+
+		records = records.Elem()
+		for j := 0; j < records.Len(); j++ {
+			result = append(result, TypedResult{
+				Type:  typeName,
+				Value: records.Index(j).Interface(),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// SortUnion sorts the results of a FindUnion by a field shared between all of the types in the results.  The values
+// are compared the same way as query criteria, so types implementing Comparer can control how they are ordered
+// against other types
+func SortUnion(results []TypedResult, field string) error {
+	var err error
+	sort.SliceStable(results, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+
+		var value, other reflect.Value
+		value, err = fieldValue(reflect.ValueOf(results[i].Value), field)
+		if err != nil {
+			return false
+		}
+
+		other, err = fieldValue(reflect.ValueOf(results[j].Value), field)
+		if err != nil {
+			return false
+		}
+
+		var c int
+		c, err = compare(value.Interface(), other.Interface())
+		if err != nil {
+			err = fmt.Errorf("Cannot sort %s by the field %s: %s", results[i].Type, field, err)
+			return false
+		}
+
+		return c < 0
+	})
+
+	return err
+}
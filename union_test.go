@@ -0,0 +1,54 @@
+// Copyright 2019 Tim Shannon. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package badgerhold_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timshannon/badgerhold/v4"
+)
+
+type UnionArticle struct {
+	ID      int `badgerhold:"key"`
+	Title   string
+	Created time.Time
+}
+
+type UnionComment struct {
+	ID      int `badgerhold:"key"`
+	Body    string
+	Created time.Time
+}
+
+func TestFindUnion(t *testing.T) {
+	testWrap(t, func(store *badgerhold.Store, t *testing.T) {
+		now := time.Now()
+
+		ok(t, store.Insert(1, &UnionArticle{Title: "first", Created: now.Add(-3 * time.Hour)}))
+		ok(t, store.Insert(2, &UnionArticle{Title: "second", Created: now.Add(-1 * time.Hour)}))
+		ok(t, store.Insert(1, &UnionComment{Body: "a comment", Created: now.Add(-2 * time.Hour)}))
+		ok(t, store.Insert(2, &UnionComment{Body: "skipped", Created: now}))
+
+		results, err := store.FindUnion(
+			badgerhold.TypedQuery{DataType: &UnionArticle{}},
+			badgerhold.TypedQuery{DataType: UnionComment{}, Query: badgerhold.Where("Body").Ne("skipped")},
+		)
+		ok(t, err)
+		equals(t, 3, len(results))
+		equals(t, "UnionArticle", results[0].Type)
+		equals(t, "UnionComment", results[2].Type)
+
+		ok(t, badgerhold.SortUnion(results, "Created"))
+
+		equals(t, "first", results[0].Value.(*UnionArticle).Title)
+		equals(t, 1, results[0].Value.(*UnionArticle).ID)
+		equals(t, "a comment", results[1].Value.(*UnionComment).Body)
+		equals(t, "second", results[2].Value.(*UnionArticle).Title)
+
+		err = badgerhold.SortUnion(results, "Title")
+		assert(t, err != nil, "Sorting on a field not shared between all types did not return an error")
+	})
+}